@@ -26,4 +26,13 @@ for (const e of errors) {
     code += `\t// ${e[2]}\n\t${e[0]}: "${e[1]}",\n`;
 }
 
+code += `}
+
+var errorCodeHint = map[CommonErrorCode]string{
+`
+
+for (const e of errors) {
+    code += `\t${e[0]}: "${e[2]}",\n`;
+}
+
 code += '}\n';
@@ -3,13 +3,15 @@ package biliopen
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"fmt"
-	jsoniter "github.com/json-iterator/go"
 	"go.uber.org/zap"
 	"io"
 	"net/http"
+	"net/url"
 	"nhooyr.io/websocket"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -32,6 +34,49 @@ type noCopy struct{}
 func (*noCopy) Lock()   {}
 func (*noCopy) Unlock() {}
 
+const (
+	// defaultWsHeartbeatInterval WebSocket 长连默认心跳间隔
+	defaultWsHeartbeatInterval = time.Second * 5
+	// defaultReconnectInitialBackoff 断线重连默认的首次等待时间
+	defaultReconnectInitialBackoff = time.Second
+	// defaultReconnectMaxBackoff 断线重连默认的最大等待时间
+	defaultReconnectMaxBackoff = time.Second * 30
+	// apiResponseBodyLimit 接口响应体的最大字节数，超过时返回错误，避免异常响应占用过多内存
+	apiResponseBodyLimit = 8 << 20
+)
+
+// ReconnectPolicy WebSocket 断线重连策略，每次失败后等待时间翻倍，直到 MaxBackoff
+type ReconnectPolicy struct {
+	// MaxAttempts 最大重连次数，0 表示不重连，负数表示无限重连
+	MaxAttempts int
+	// InitialBackoff 首次重连前的等待时间，默认 1 秒
+	InitialBackoff time.Duration
+	// MaxBackoff 重连等待时间的上限，默认 30 秒
+	MaxBackoff time.Duration
+}
+
+func (p ReconnectPolicy) enabled() bool {
+	return p.MaxAttempts != 0
+}
+
+func (p ReconnectPolicy) initialBackoff() time.Duration {
+	if p.InitialBackoff <= 0 {
+		return defaultReconnectInitialBackoff
+	}
+	return p.InitialBackoff
+}
+
+func (p ReconnectPolicy) nextBackoff(cur time.Duration) time.Duration {
+	maxBackoff := p.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = defaultReconnectMaxBackoff
+	}
+	if cur *= 2; cur > maxBackoff {
+		cur = maxBackoff
+	}
+	return cur
+}
+
 // LiveClient 直播 API 客户端实现
 //
 // 协议根据官方开发文档实现：https://open-live.bilibili.com/document/74eec767-e594-7ddd-6aba-257e8317c05d
@@ -40,19 +85,86 @@ type LiveClient struct {
 	AppKey    string
 	AppSecret string
 	ProjectID int64
-
-	OnDanmaku func(Danmaku)
-	OnClose   func(error)
+	// Codec JSON 编解码器，为空时使用 StdCodec
+	Codec Codec
+
+	// Transport API 请求和 WebSocket 握手共用的底层 RoundTripper，设置后忽略下方的 TLSConfig、ProxyURL 和 DialTimeout
+	Transport http.RoundTripper
+	// TLSConfig 自定义 TLS 配置，例如通过 RootCAs 信任自签名证书，
+	// 下方的网络配置修改后从下一次请求开始生效，TLSConfig 需要替换为新的对象，只修改字段不会生效
+	TLSConfig *tls.Config
+	// ProxyURL 代理地址，支持 http、https 和 socks5 协议，为空时读取 HTTPS_PROXY 等环境变量
+	ProxyURL *url.URL
+	// Header 额外的请求头，附加到 API 请求和 WebSocket 握手请求上
+	Header http.Header
+	// DialTimeout 建立 TCP 连接的超时时间
+	DialTimeout time.Duration
+	// HandshakeTimeout TLS 握手超时时间，同时也是 WebSocket 从拨号到握手完成的超时时间
+	HandshakeTimeout time.Duration
+	// RequestTimeout API 请求超时时间，默认 60 秒
+	RequestTimeout time.Duration
+	// RateLimiter API 请求限流器，为空时使用 SharedRateLimiter(AppKey)，即同一个 AppKey 的客户端共享限流
+	RateLimiter *RateLimiter
+	// Clock API 签名使用的时钟，默认 SystemClock，本地时钟的偏差会根据服务端响应自动校准
+	Clock Clock
+
+	// WsHeartbeatInterval WebSocket 长连心跳间隔，默认 5 秒
+	WsHeartbeatInterval time.Duration
+	// AppHeartbeatInterval 项目心跳 /v2/app/heartbeat 的调用间隔，为 0 或负数时不发送，
+	// 官方要求 20 秒一次，超过 60 秒未收到心跳会关闭项目，需要保持项目开启时建议设置为 20 秒
+	AppHeartbeatInterval time.Duration
+	// Reconnect WebSocket 断线重连策略，默认不重连
+	Reconnect ReconnectPolicy
+	// Recorder 录制收到的每一帧原始数据，用于离线复现问题，配合 Replayer 回放
+	Recorder FrameRecorder
+	// Dedup 根据 msg_id 过滤重复消息，为空时不去重，开启断线重连时建议设置
+	Dedup *Deduplicator
+	// Identities 在分发事件前补全用户的 OpenID 或 UID，迁移期间同一用户的 Identity 保持不变，为空时不处理
+	Identities *IdentityMap
+	// DisableRecover 为 true 时不捕获消息处理过程中的 panic，默认会捕获去重、解析、OnSchemaDrift、中间件、回调和路由中的 panic，
+	// 记录日志和调用栈后丢弃该消息，避免读取循环退出，调试时可以关闭以获得原始的崩溃现场
+	DisableRecover bool
+
+	OnDanmaku      func(Danmaku)
+	OnGift         func(Gift)
+	OnSuperChat    func(SuperChat)
+	OnSuperChatDel func(SuperChatDel)
+	OnGuard        func(Guard)
+	OnLike         func(Like)
+	OnClose        func(error)
+
+	// StrictSchema 严格模式，开启后检查每条消息的字段是否和模型一致
+	StrictSchema bool
+	// OnSchemaDrift 严格模式下发现消息中有模型未声明的字段 unknown，或者缺失模型声明的字段 missing 时触发，
+	// 同一个 cmd 下的同一个字段只会上报一次，未设置时输出警告日志
+	OnSchemaDrift func(cmd string, unknown, missing []string)
 
 	noCopy noCopy
 
+	transportMu  sync.Mutex
+	transport    *http.Transport
+	transportKey transportKey
+
 	mu          sync.Mutex
 	client      *http.Client
 	clientState clientState
 	liveCode    string
 	gameID      string
 	wsInfo      websocketInfo
+	wsLinkIndex int
 	wsClient    *liveWebsocketClient
+
+	appHeartbeatCancel context.CancelFunc
+	schemaDrift        schemaDriftState
+	clockOffset        ClockOffset
+
+	middlewareMu sync.Mutex
+	middlewares  []Middleware
+	// eventChain 由 Use 组装的中间件链，为空时直接触发回调
+	eventChain atomic.Pointer[Handler]
+	routeSeq   uint64
+	// routes 通过 Route 注册的路由，修改时整体替换
+	routes atomic.Pointer[[]route]
 }
 
 func (c *LiveClient) getApiHost() string {
@@ -63,6 +175,18 @@ func (c *LiveClient) getApiHost() string {
 	return host
 }
 
+func (c *LiveClient) getCodec() Codec {
+	if c.Codec == nil {
+		return StdCodec{}
+	}
+	return c.Codec
+}
+
+// ClockOffset 根据服务端响应校准得到的时钟偏差，即服务端时间减去本地时间
+func (c *LiveClient) ClockOffset() time.Duration {
+	return c.clockOffset.Get()
+}
+
 func (c *LiveClient) logger() *zap.Logger {
 	return zap.L().With(zap.String("logger", "LiveClient"))
 }
@@ -77,16 +201,15 @@ func (c *LiveClient) Connect(ctx context.Context, liveCode string) error {
 		return fmt.Errorf("client state should be idle")
 	}
 	c.liveCode = liveCode
-	c.client = &http.Client{
-		Timeout:   time.Second * 60,
-		Transport: ApiTransport{AppKey: c.AppKey, AppSecret: c.AppSecret},
-	}
+	c.client = c.newApiClient()
 	// 调用 /v2/app/start 获取基本信息
 	if err := c.callAppStart(ctx); err != nil {
 		return fmt.Errorf("start app fail: %w", err)
 	}
 	c.clientState = clientStateActive
+	c.startAppHeartbeat()
 	// 拿到基本信息后，自动建立 WebSocket 连接
+	c.wsLinkIndex = 0
 	if err := c.connectWs(ctx); err != nil {
 		return fmt.Errorf("connect ws fail: %w", err)
 	}
@@ -100,31 +223,138 @@ func (c *LiveClient) connectWs(ctx context.Context) error {
 			c.logger().Warn("close last websocket client fail", zap.Error(err))
 		}
 	}
-	// 创建新的 WebSocket 连接客户端
-	c.wsClient = &liveWebsocketClient{
-		url:       c.wsInfo.WSSLink[0],
-		authBody:  c.wsInfo.AuthBody,
-		onDanmaku: c.OnDanmaku,
-		onClose:   c.onWsClose,
+	ws, err := c.newWsClient()
+	if err != nil {
+		return err
 	}
-	if err := c.wsClient.connect(ctx); err != nil {
+	c.wsClient = ws
+	return c.startWs(ctx, ws)
+}
+
+// newWsClient 使用当前节点创建 WebSocket 连接客户端，调用方需要持有锁
+func (c *LiveClient) newWsClient() (*liveWebsocketClient, error) {
+	if len(c.wsInfo.WSSLink) == 0 {
+		return nil, fmt.Errorf("no websocket link available")
+	}
+	return &liveWebsocketClient{
+		url:               c.wsInfo.WSSLink[c.wsLinkIndex%len(c.wsInfo.WSSLink)],
+		authBody:          c.wsInfo.AuthBody,
+		dialer:            c.newWsDialer(),
+		codec:             c.getCodec(),
+		heartbeatInterval: c.WsHeartbeatInterval,
+		recorder:          c.Recorder,
+		onCmd:             c.handleCmd,
+		onClose:           c.onWsClose,
+	}, nil
+}
+
+// startWs 建立 WebSocket 连接并完成鉴权
+func (c *LiveClient) startWs(ctx context.Context, ws *liveWebsocketClient) error {
+	if err := ws.connect(ctx); err != nil {
 		c.logger().Error("connect websocket fail", zap.Error(err),
-			zap.String("url", c.wsClient.url), zap.String("auth_body", c.wsClient.authBody))
+			zap.String("url", ws.url), zap.String("auth_body", ws.authBody))
 		return fmt.Errorf("connect websocket fail: %w", err)
 	}
 	return nil
 }
 
-// onWsClose 在 WebSocket 连接断线的时候一起触发 Disconnect 函数
+// onWsClose 在 WebSocket 连接断线的时候按重连策略尝试重连，否则一起触发 Disconnect 函数
 func (c *LiveClient) onWsClose(err error) {
-	if err := c.Disconnect(context.Background()); err != nil {
-		c.logger().Warn("disconnect fail", zap.Error(err))
+	if err != nil && c.Reconnect.enabled() {
+		go c.reconnect(err)
+		return
+	}
+	c.closeWithError(err)
+}
+
+// closeWithError 断开连接并通知 OnClose 回调
+func (c *LiveClient) closeWithError(err error) {
+	// 主动关闭时 err 为空，此时调用方已经持有锁并在处理断开流程
+	if err != nil {
+		if err := c.Disconnect(context.Background()); err != nil {
+			c.logger().Warn("disconnect fail", zap.Error(err))
+		}
 	}
 	if c.OnClose != nil {
 		c.OnClose(err)
 	}
 }
 
+// reconnect 按照重连策略重新建立 WebSocket 连接，每次尝试轮换使用下一个节点，全部失败后断开连接
+func (c *LiveClient) reconnect(cause error) {
+	backoff := c.Reconnect.initialBackoff()
+	for attempt := 1; c.Reconnect.MaxAttempts < 0 || attempt <= c.Reconnect.MaxAttempts; attempt++ {
+		time.Sleep(backoff)
+		c.mu.Lock()
+		if c.clientState != clientStateActive {
+			// 等待期间已经主动断开
+			c.mu.Unlock()
+			return
+		}
+		c.wsLinkIndex++
+		ws, err := c.newWsClient()
+		c.mu.Unlock()
+		if err == nil {
+			// 拨号和鉴权期间不持有锁，避免阻塞 Disconnect
+			err = c.startWs(context.Background(), ws)
+		}
+		if err == nil {
+			c.mu.Lock()
+			active := c.clientState == clientStateActive
+			var last *liveWebsocketClient
+			if active {
+				last, c.wsClient = c.wsClient, ws
+			}
+			c.mu.Unlock()
+			if !active {
+				// 连接期间已经主动断开，丢弃新连接
+				ws.silent.Store(true)
+				_ = ws.Close()
+				return
+			}
+			if last != nil {
+				_ = last.Close()
+			}
+			c.logger().Info("websocket reconnected", zap.Int("attempt", attempt), zap.NamedError("cause", cause))
+			return
+		}
+		c.logger().Warn("websocket reconnect fail", zap.Int("attempt", attempt), zap.Error(err))
+		backoff = c.Reconnect.nextBackoff(backoff)
+	}
+	c.closeWithError(cause)
+}
+
+// startAppHeartbeat 启动项目心跳循环，调用方需要持有锁
+func (c *LiveClient) startAppHeartbeat() {
+	interval := c.AppHeartbeatInterval
+	if interval <= 0 || c.gameID == "" {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.appHeartbeatCancel = cancel
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				// 请求期间不持有锁，Disconnect 取消 ctx 后请求会立即返回
+				c.mu.Lock()
+				active, client, gameID := c.clientState == clientStateActive, c.client, c.gameID
+				c.mu.Unlock()
+				if !active {
+					return
+				}
+				if err := c.callAppHeartbeat(ctx, client, gameID); err != nil && ctx.Err() == nil {
+					c.logger().Warn("app heartbeat fail", zap.Error(err))
+				}
+			}
+		}
+	}()
+}
+
 // Disconnect 断开连接
 func (c *LiveClient) Disconnect(ctx context.Context) error {
 	c.mu.Lock()
@@ -132,6 +362,10 @@ func (c *LiveClient) Disconnect(ctx context.Context) error {
 	defer func() {
 		c.clientState = clientStateIdle
 	}()
+	if c.appHeartbeatCancel != nil {
+		c.appHeartbeatCancel()
+		c.appHeartbeatCancel = nil
+	}
 	if c.clientState == clientStateActive {
 		if err := c.callAppEnd(ctx); err != nil {
 			c.logger().Warn("call app end fail", zap.Error(err))
@@ -153,30 +387,60 @@ func (c *LiveClient) IsActive() bool {
 	return c.clientState == clientStateActive
 }
 
+// CallApi 调用任意开放平台接口，req 使用 Codec 序列化为请求体，响应反序列化到 rsp，通常为 *CommonResponse[T]
+//
+// req 为 []byte 时作为请求体原样发送，不经过 Codec，签名使用的正是这些字节，便于和 sign 子命令的输出对照
+//
+// 不需要先调用 Connect，返回的错误不包含响应中的业务错误码，需要自行检查 CommonResponse.Err
+func (c *LiveClient) CallApi(ctx context.Context, path string, req any, rsp any) error {
+	c.mu.Lock()
+	if c.client == nil {
+		c.client = c.newApiClient()
+	}
+	client := c.client
+	c.mu.Unlock()
+	return c.doCallApi(ctx, client, path, req, rsp)
+}
+
+// commonCallApi 调用开放平台接口，调用方需要持有 c.mu
 func (c *LiveClient) commonCallApi(ctx context.Context, path string, req any, rsp any) error {
-	reqJson, err := jsoniter.Marshal(req)
-	if err != nil {
-		return fmt.Errorf("marshal fail: %w", err)
+	return c.doCallApi(ctx, c.client, path, req, rsp)
+}
+
+func (c *LiveClient) doCallApi(ctx context.Context, client *http.Client, path string, req any, rsp any) error {
+	reqJson, ok := req.([]byte)
+	if !ok {
+		var err error
+		if reqJson, err = c.getCodec().Marshal(req); err != nil {
+			return fmt.Errorf("marshal fail: %w", err)
+		}
 	}
 	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.getApiHost()+path, bytes.NewReader(reqJson))
 	if err != nil {
 		return err
 	}
+	for k, v := range c.Header {
+		httpReq.Header[k] = append([]string(nil), v...)
+	}
 	httpReq.Header.Set("Accept", "application/json")
 	httpReq.Header.Set("Content-Type", "application/json")
-	httpRsp, err := c.client.Do(httpReq)
+	httpRsp, err := client.Do(httpReq)
 	if err != nil {
 		return fmt.Errorf("do http request fail: %w", err)
 	}
+	defer httpRsp.Body.Close()
 	if httpRsp.StatusCode != http.StatusOK {
-		return fmt.Errorf("http response is not ok: status code %d", httpRsp.StatusCode)
+		body, _ := io.ReadAll(io.LimitReader(httpRsp.Body, httpErrorBodyLimit))
+		return newHTTPError(httpRsp.StatusCode, path, body)
 	}
-	defer httpRsp.Body.Close()
-	rspBytes, err := io.ReadAll(httpRsp.Body)
+	rspBytes, err := io.ReadAll(io.LimitReader(httpRsp.Body, apiResponseBodyLimit+1))
 	if err != nil {
 		return fmt.Errorf("read body fail: %w", err)
 	}
-	if err = jsoniter.Unmarshal(rspBytes, rsp); err != nil {
+	if len(rspBytes) > apiResponseBodyLimit {
+		return fmt.Errorf("response body of %s exceeds %d bytes", path, apiResponseBodyLimit)
+	}
+	if err = c.getCodec().Unmarshal(rspBytes, rsp); err != nil {
 		return fmt.Errorf("unmarshal response fail: %w", err)
 	}
 	return nil
@@ -217,18 +481,11 @@ func (c *LiveClient) callAppEnd(ctx context.Context) error {
 	return nil
 }
 
-// callAppHeartbeat 发送心跳包
-func (c *LiveClient) callAppHeartbeat(ctx context.Context) error {
-	if c.clientState != clientStateActive {
-		return fmt.Errorf("client state should be alive")
-	}
-	if c.gameID == "" {
-		// 一些直播应用会拿不到 Game ID，此时无需触发心跳
-		return nil
-	}
-	req := map[string]any{"game_id": c.gameID}
+// callAppHeartbeat 发送心跳包，不需要持有锁
+func (c *LiveClient) callAppHeartbeat(ctx context.Context, client *http.Client, gameID string) error {
+	req := map[string]any{"game_id": gameID}
 	var rsp CommonResponse[any]
-	if err := c.commonCallApi(ctx, "/v2/app/heartbeat", req, &rsp); err != nil {
+	if err := c.doCallApi(ctx, client, "/v2/app/heartbeat", req, &rsp); err != nil {
 		return err
 	}
 	if err := rsp.Err(); err != nil {
@@ -251,13 +508,22 @@ const (
 
 // liveWebsocketClient 封装长连 Websocket 协议的客户端
 type liveWebsocketClient struct {
-	url       string
-	authBody  string
-	onDanmaku func(Danmaku)
-	onClose   func(error)
-
-	state           websocketClientState
-	conn            *websocket.Conn
+	url      string
+	authBody string
+	dialer   wsDialer
+	codec    Codec
+	recorder FrameRecorder
+	onCmd    func(cmd string, data []byte) error
+	onClose  func(error)
+
+	heartbeatInterval time.Duration
+
+	state  websocketClientState
+	conn   *websocket.Conn
+	closed atomic.Bool
+	// silent 为 true 时关闭连接不通知 onClose，用于丢弃重连期间已经被主动断开的连接
+	silent          atomic.Bool
+	closeOnce       sync.Once
 	seqID           int32
 	heartbeatTicker *time.Ticker
 	loopCtx         context.Context
@@ -265,21 +531,22 @@ type liveWebsocketClient struct {
 
 	eventCh      chan *wsProtoMsg
 	eventHandler map[wsProtoOp]func(*wsProtoMsg) error
+
+	log *zap.Logger
 }
 
 func (c *liveWebsocketClient) logger() *zap.Logger {
-	return zap.L().With(zap.String("logger", "liveWebsocketClient"))
+	if c.log == nil {
+		c.log = zap.L().With(zap.String("logger", "liveWebsocketClient"))
+	}
+	return c.log
 }
 
 func (c *liveWebsocketClient) connect(ctx context.Context) error {
 	if c.state != websocketClientStateIdle {
 		return fmt.Errorf("websocket client state should be idle")
 	}
-	conn, _, err := websocket.Dial(ctx, c.url, &websocket.DialOptions{
-		HTTPHeader: http.Header{
-			"User-Agent": []string{"bili-open-live-go/1.0"},
-		},
-	})
+	conn, err := c.dialer.dial(ctx, c.url)
 	if err != nil {
 		return fmt.Errorf("dial fail: %w", err)
 	}
@@ -287,19 +554,19 @@ func (c *liveWebsocketClient) connect(ctx context.Context) error {
 
 	// init states
 	c.eventCh = make(chan *wsProtoMsg)
-	c.eventHandler = map[wsProtoOp]func(*wsProtoMsg) error{
-		wsProtoOpAuthReply:      c.handleOpAuth,
-		wsProtoOpHeartbeatReply: c.handleOpHeartbeat,
-		wsProtoOpSendMsgReply:   c.handleOpMsg,
-	}
+	c.initHandlers()
 	c.seqID = 0
 	c.state = websocketClientStateAuth
 
 	// init loops
 	c.loopCtx, c.loopCancel = context.WithCancel(context.Background())
-	c.heartbeatTicker = time.NewTicker(time.Second * 5)
-	go c.readLoop()
-	go c.eventLoop()
+	heartbeatInterval := c.heartbeatInterval
+	if heartbeatInterval <= 0 {
+		heartbeatInterval = defaultWsHeartbeatInterval
+	}
+	c.heartbeatTicker = time.NewTicker(heartbeatInterval)
+	go c.readLoop(c.loopCtx)
+	go c.eventLoop(c.loopCtx, c.heartbeatTicker)
 
 	// start auth
 	if err = c.sendAuth(); err != nil {
@@ -309,20 +576,36 @@ func (c *liveWebsocketClient) connect(ctx context.Context) error {
 	return nil
 }
 
+func (c *liveWebsocketClient) initHandlers() {
+	c.eventHandler = map[wsProtoOp]func(*wsProtoMsg) error{
+		wsProtoOpAuthReply:      c.handleOpAuth,
+		wsProtoOpHeartbeatReply: c.handleOpHeartbeat,
+		wsProtoOpSendMsgReply:   c.handleOpMsg,
+	}
+}
+
 // Close 主动关闭连接
 func (c *liveWebsocketClient) Close() error {
-	if c.conn == nil {
+	conn := c.conn
+	if conn == nil {
 		return nil
 	}
+	c.closed.Store(true)
 	defer c.internalClose(nil)
-	if err := c.conn.Close(websocket.StatusNormalClosure, "client close"); err != nil {
+	if err := conn.Close(websocket.StatusNormalClosure, "client close"); err != nil {
 		return err
 	}
 	return nil
 }
 
 // internalClose 回收连接相关的状态、上下文，并通知 onClose 回调，若为主动关闭则传入空失败区分
+//
+// 主动关闭和服务端断开可能同时发生，只有先到达的一方会执行
 func (c *liveWebsocketClient) internalClose(err error) {
+	c.closeOnce.Do(func() { c.doInternalClose(err) })
+}
+
+func (c *liveWebsocketClient) doInternalClose(err error) {
 	if c.loopCancel != nil {
 		c.loopCancel()
 		c.loopCancel = nil
@@ -333,45 +616,90 @@ func (c *liveWebsocketClient) internalClose(err error) {
 	}
 	c.state = websocketClientStateIdle
 	c.conn = nil
-	if c.onClose != nil {
+	if c.onClose != nil && !c.silent.Load() {
 		c.onClose(err)
 	}
 }
 
 // readLoop WebSocket 数据流读取循环，反序列化出接口消息写入 channel 队列待处理
-func (c *liveWebsocketClient) readLoop() {
+func (c *liveWebsocketClient) readLoop(ctx context.Context) {
+	conn := c.conn
 	for {
-		if c.conn == nil {
+		if c.closed.Load() {
 			c.logger().Info("connection is closed. exit read loop")
 			return
 		}
-		_, buf, err := c.conn.Read(context.Background())
+		buf, err := c.readFrame(conn)
 		if err != nil {
-			if closeStatus := websocket.CloseStatus(err); closeStatus != -1 {
-				c.logger().Info("connection receive close message", zap.Error(err))
-				c.internalClose(err)
+			if c.closed.Load() {
 				return
 			}
-			c.logger().Warn("failed to read message from conn", zap.Error(err))
-			continue
+			// 读取错误说明连接已经不可用，之后的读取会立即返回同样的错误，关闭连接并交给断线重连处理
+			if websocket.CloseStatus(err) != -1 {
+				c.logger().Info("connection receive close message", zap.Error(err))
+			} else {
+				c.logger().Warn("failed to read message from conn", zap.Error(err))
+			}
+			c.internalClose(err)
+			return
 		}
-		msg, err := parseWsProtoMsg(buf)
+		msg, err := c.parseFrame(buf)
 		if err != nil {
+			// 单帧无法解析不影响连接，跳过该帧
 			c.logger().Warn("failed to parse message", zap.Error(err))
 			continue
 		}
-		c.logger().Debug("recv msg", zap.Any("msg", msg))
-		c.eventCh <- msg
+		if ce := c.logger().Check(zap.DebugLevel, "recv msg"); ce != nil {
+			ce.Write(zap.Int32("operation", int32(msg.Operation)),
+				zap.Int32("seq", msg.SequenceID), zap.ByteString("body", msg.Body))
+		}
+		select {
+		case c.eventCh <- msg:
+		case <-ctx.Done():
+			releaseWsProtoMsg(msg)
+			return
+		}
+	}
+}
+
+// readFrame 从连接中读取一帧数据到池化的缓冲中，返回的错误均为连接层面的错误
+func (c *liveWebsocketClient) readFrame(conn *websocket.Conn) (*bytes.Buffer, error) {
+	_, r, err := conn.Reader(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	buf := wsBufPool.Get().(*bytes.Buffer)
+	if _, err = buf.ReadFrom(r); err != nil {
+		putWsBuf(buf)
+		return nil, err
+	}
+	if c.recorder != nil {
+		// 在解析之前录制，无法解析的帧也会保留下来
+		if err = c.recorder.RecordFrame(time.Now(), buf.Bytes()); err != nil {
+			c.logger().Warn("record frame fail", zap.Error(err))
+		}
 	}
+	return buf, nil
+}
+
+// parseFrame 解析 readFrame 读取的一帧，buf 由返回的消息持有，处理完毕后需要 releaseWsProtoMsg
+func (c *liveWebsocketClient) parseFrame(buf *bytes.Buffer) (*wsProtoMsg, error) {
+	msg := acquireWsProtoMsg()
+	msg.buf = buf
+	if err := parseWsProtoMsgInto(msg, buf.Bytes()); err != nil {
+		releaseWsProtoMsg(msg)
+		return nil, fmt.Errorf("parse message fail: %w", err)
+	}
+	return msg, nil
 }
 
 // eventLoop 接口消息消费循环
-func (c *liveWebsocketClient) eventLoop() {
+func (c *liveWebsocketClient) eventLoop(ctx context.Context, heartbeatTicker *time.Ticker) {
 	for {
 		select {
-		case <-c.loopCtx.Done():
+		case <-ctx.Done():
 			return
-		case <-c.heartbeatTicker.C:
+		case <-heartbeatTicker.C:
 			if err := c.sendHeartbeat(); err != nil {
 				c.logger().Warn("heartbeat send fail", zap.Error(err))
 			}
@@ -379,18 +707,24 @@ func (c *liveWebsocketClient) eventLoop() {
 			if msg == nil {
 				continue
 			}
-			handler, ok := c.eventHandler[msg.Operation]
-			if !ok {
-				c.logger().Warn("no handlers for this message", zap.Int32("operation", int32(msg.Operation)))
-				continue
-			}
-			if err := handler(msg); err != nil {
-				c.logger().Warn("handle msg fail", zap.Error(err))
-			}
+			c.dispatchMsg(msg)
+			releaseWsProtoMsg(msg)
 		}
 	}
 }
 
+// dispatchMsg 根据 op 将消息分发给对应的处理函数
+func (c *liveWebsocketClient) dispatchMsg(msg *wsProtoMsg) {
+	handler, ok := c.eventHandler[msg.Operation]
+	if !ok {
+		c.logger().Warn("no handlers for this message", zap.Int32("operation", int32(msg.Operation)))
+		return
+	}
+	if err := handler(msg); err != nil {
+		c.logger().Warn("handle msg fail", zap.Error(err))
+	}
+}
+
 func (c *liveWebsocketClient) createMsg(op wsProtoOp, body []byte) *wsProtoMsg {
 	msg := &wsProtoMsg{
 		Operation:  op,
@@ -402,12 +736,11 @@ func (c *liveWebsocketClient) createMsg(op wsProtoOp, body []byte) *wsProtoMsg {
 }
 
 func (c *liveWebsocketClient) writeMsg(msg *wsProtoMsg) error {
-	w, err := c.conn.Writer(context.Background(), websocket.MessageBinary)
-	if err != nil {
-		return fmt.Errorf("open writer fail: %w", err)
-	}
-	defer w.Close()
-	return writeWsProtoMsg(w, msg)
+	buf := wsBufPool.Get().(*bytes.Buffer)
+	defer putWsBuf(buf)
+	buf.Grow(wsProtoRawHeaderSize + len(msg.Body))
+	b := appendWsProtoMsg(buf.Bytes(), msg)
+	return c.conn.Write(context.Background(), websocket.MessageBinary, b)
 }
 
 func (c *liveWebsocketClient) sendHeartbeat() error {
@@ -431,7 +764,7 @@ func (c *liveWebsocketClient) handleOpAuth(msg *wsProtoMsg) error {
 		return fmt.Errorf("receive op msg at unexpected state %d", c.state)
 	}
 	var rsp wsAuthResponse
-	if err := jsoniter.Unmarshal(msg.Body, &rsp); err != nil {
+	if err := c.codec.Unmarshal(msg.Body, &rsp); err != nil {
 		return fmt.Errorf("unmarshal auth response fail: %w", err)
 	}
 	if rsp.Code != 0 {
@@ -448,20 +781,12 @@ func (c *liveWebsocketClient) handleOpHeartbeat(msg *wsProtoMsg) error {
 }
 
 func (c *liveWebsocketClient) handleOpMsg(msg *wsProtoMsg) error {
-	cmd := jsoniter.Get(msg.Body, "cmd").ToString()
-	if cmd == CmdLiveOpenPlatformDm {
-		var dm Danmaku
-		dataNode := jsoniter.Get(msg.Body, "data")
-		dataNode.ToVal(&dm)
-		if err := dataNode.LastError(); err != nil {
-			return fmt.Errorf("unmarshal danmaku fail: %w", err)
-		}
-		if c.onDanmaku != nil {
-			c.onDanmaku(dm)
-		}
-	} else {
-		c.logger().Warn("unsupported cmd", zap.String("cmd", cmd), zap.String("msg", string(msg.Body)))
+	env, err := decodeWsCmdEnvelope(msg.Body)
+	if err != nil {
+		return fmt.Errorf("decode cmd envelope fail: %w", err)
 	}
-
-	return nil
+	if c.onCmd == nil {
+		return nil
+	}
+	return c.onCmd(env.Cmd, env.Data)
 }
@@ -0,0 +1,79 @@
+package biliopen
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// clockSkewTolerance 测量到的偏差和当前偏差相差不超过该值时不更新，Date 头只精确到秒
+const clockSkewTolerance = time.Second * 2
+
+// Clock 签名使用的时钟，生成 X-Bili-Timestamp 和 X-Bili-Signature-Nonce，测试时可以替换为固定的实现
+type Clock interface {
+	Now() time.Time
+	Nonce(timestamp int64) string
+}
+
+// SystemClock 使用系统时间和随机数的 Clock 实现
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (SystemClock) Nonce(timestamp int64) string {
+	return NewSignatureNonce(timestamp)
+}
+
+// ClockOffset 本地时钟与服务端时钟的偏差，即服务端时间减去本地时间，零值可以直接使用，并发安全
+type ClockOffset struct {
+	ns atomic.Int64
+}
+
+// Get 当前偏差
+func (o *ClockOffset) Get() time.Duration {
+	return time.Duration(o.ns.Load())
+}
+
+// Set 手动设置偏差
+func (o *ClockOffset) Set(d time.Duration) {
+	o.ns.Store(int64(d))
+}
+
+// observe 根据服务端响应的 Date 头和本地接收时间校准偏差，返回偏差是否发生了变化
+func (o *ClockOffset) observe(date string, local time.Time) bool {
+	measured, ok := measureClockOffset(date, local)
+	if !ok {
+		return false
+	}
+	diff := measured - o.Get()
+	if diff > -clockSkewTolerance && diff < clockSkewTolerance {
+		return false
+	}
+	o.Set(measured)
+	return true
+}
+
+// calibrate 和 observe 相同，但不受 clockSkewTolerance 限制，用于服务端已经明确返回请求过期的情况，Date 头无法解析时返回 false
+func (o *ClockOffset) calibrate(date string, local time.Time) bool {
+	measured, ok := measureClockOffset(date, local)
+	if !ok {
+		return false
+	}
+	o.Set(measured)
+	return true
+}
+
+// measureClockOffset 根据 Date 头计算服务端时间减去本地时间
+func measureClockOffset(date string, local time.Time) (time.Duration, bool) {
+	if date == "" {
+		return 0, false
+	}
+	server, err := http.ParseTime(date)
+	if err != nil {
+		return 0, false
+	}
+	// Date 头截断到秒，取中间值
+	return server.Add(time.Millisecond * 500).Sub(local), true
+}
@@ -0,0 +1,129 @@
+package biliopen
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testClock struct {
+	now time.Time
+}
+
+func (c testClock) Now() time.Time {
+	return c.now
+}
+
+func (c testClock) Nonce(timestamp int64) string {
+	return "nonce" + strconv.FormatInt(timestamp, 10)
+}
+
+func TestApiTransportClockSkew(t *testing.T) {
+	local := time.Unix(1700000000, 0)
+	server := local.Add(time.Hour)
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != `{"a":1}` || r.Header.Get(HeaderBiliContentMD5) != ContentMD5(body) {
+			t.Errorf("unexpected body %q", body)
+		}
+		ts, _ := strconv.ParseInt(r.Header.Get(HeaderBiliTimestamp), 10, 64)
+		if r.Header.Get(HeaderBiliSignatureNonce) != "nonce"+strconv.FormatInt(ts, 10) {
+			t.Errorf("unexpected nonce %q", r.Header.Get(HeaderBiliSignatureNonce))
+		}
+		w.Header().Set("Date", server.UTC().Format(http.TimeFormat))
+		if d := time.Unix(ts, 0).Sub(server); d < -time.Minute*10 || d > time.Minute*10 {
+			_, _ = w.Write([]byte(`{"code":4003,"message":"请求过期"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"code":0}`))
+	}))
+	defer srv.Close()
+
+	offset := &ClockOffset{}
+	client := &http.Client{Transport: ApiTransport{AppKey: "key", AppSecret: "secret", Clock: testClock{local}, Offset: offset}}
+	call := func() string {
+		rsp, err := client.Post(srv.URL, "application/json", bytes.NewReader([]byte(`{"a":1}`)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rsp.Body.Close()
+		body, _ := io.ReadAll(rsp.Body)
+		return string(body)
+	}
+	if body := call(); body != `{"code":0}` || requests.Load() != 2 {
+		t.Fatalf("expect retry after recalibration, got %s after %d requests", body, requests.Load())
+	}
+	if d := offset.Get(); d < time.Hour || d > time.Hour+time.Second {
+		t.Fatalf("unexpected offset %v", d)
+	}
+	// 校准后的请求不再需要重试
+	if body := call(); body != `{"code":0}` || requests.Load() != 3 {
+		t.Fatalf("unexpected %s after %d requests", body, requests.Load())
+	}
+}
+
+func TestApiTransportExpiredRetry(t *testing.T) {
+	local := time.Unix(1700000000, 0)
+	var requests atomic.Int32
+	var date string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if date != "" {
+			w.Header().Set("Date", date)
+		} else {
+			w.Header()["Date"] = nil
+		}
+		// 第一次请求总是过期，第二次请求成功
+		if requests.Add(1)%2 == 1 {
+			_, _ = w.Write([]byte(`{"code":4003}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"code":0}`))
+	}))
+	defer srv.Close()
+
+	offset := &ClockOffset{}
+	client := &http.Client{Transport: ApiTransport{AppKey: "key", AppSecret: "secret", Clock: testClock{local}, Offset: offset}}
+	call := func() string {
+		rsp, err := client.Post(srv.URL, "application/json", bytes.NewReader([]byte(`{}`)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rsp.Body.Close()
+		body, _ := io.ReadAll(rsp.Body)
+		return string(body)
+	}
+	// 偏差在容差内时同样按 Date 头校准并重试
+	date = local.Add(time.Second).UTC().Format(http.TimeFormat)
+	if body := call(); body != `{"code":0}` || requests.Load() != 2 {
+		t.Fatalf("expect retry, got %s after %d requests", body, requests.Load())
+	}
+	if d := offset.Get(); d != time.Second*3/2 {
+		t.Fatalf("expect forced calibration, got %v", d)
+	}
+	// 没有 Date 头时保留偏差并重试
+	date = ""
+	if body := call(); body != `{"code":0}` || requests.Load() != 4 || offset.Get() != time.Second*3/2 {
+		t.Fatalf("expect retry without date, got %s after %d requests, offset %v", body, requests.Load(), offset.Get())
+	}
+}
+
+func TestClockOffsetObserve(t *testing.T) {
+	var o ClockOffset
+	local := time.Unix(1700000000, 0)
+	if o.observe("", local) || o.observe("invalid", local) {
+		t.Fatal("invalid date should be ignored")
+	}
+	if o.observe(local.Add(time.Second).UTC().Format(http.TimeFormat), local) {
+		t.Fatal("small skew should be ignored")
+	}
+	if !o.observe(local.Add(-time.Minute).UTC().Format(http.TimeFormat), local) || o.Get() > -time.Second*59 {
+		t.Fatalf("unexpected offset %v", o.Get())
+	}
+}
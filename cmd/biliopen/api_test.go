@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestPrintSignature(t *testing.T) {
+	var buf bytes.Buffer
+	printSignature(&buf, "key", "secret", 1700000000, "nonce", []byte("{}"))
+	canonical := strings.Join([]string{
+		"x-bili-accesskeyid:key",
+		"x-bili-content-md5:99914b932bd37a50b983c5e7c90ae93b",
+		"x-bili-signature-method:HMAC-SHA256",
+		"x-bili-signature-nonce:nonce",
+		"x-bili-signature-version:1.0",
+		"x-bili-timestamp:1700000000",
+	}, "\n")
+	hm := hmac.New(sha256.New, []byte("secret"))
+	hm.Write([]byte(canonical))
+	auth := hex.EncodeToString(hm.Sum(nil))
+	out := buf.String()
+	for _, want := range []string{
+		"# signature string\n" + canonical + "\n",
+		"# content-md5\n99914b932bd37a50b983c5e7c90ae93b\n",
+		"# authorization\n" + auth + "\n",
+		"Authorization: " + auth + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("output should contain %q, got:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// biliopen 开放平台命令行工具
+//
+// 用法：
+//
+//	biliopen tail [flags]               连接直播间并输出收到的消息
+//	biliopen api [flags] <path> [json]  发送签名的 API 请求并输出响应
+//	biliopen sign [flags] [json]        输出签名过程中的原文、Content-MD5 和 Authorization
+//
+// 凭据依次从环境变量（LIVE_APP_KEY 等）、-config 指定的配置文件和命令行参数中读取，后者覆盖前者
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	biliopen "github.com/fython/bili-open-live-go"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{"tail", "连接直播间并输出收到的消息", runTail},
+	{"api", "发送签名的 API 请求并输出响应", runApi},
+	{"sign", "输出签名过程中的原文、Content-MD5 和 Authorization", runSign},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		printUsage()
+		os.Exit(2)
+	}
+	name := os.Args[1]
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		if err := cmd.run(os.Args[2:]); err != nil {
+			if err != flag.ErrHelp {
+				fmt.Fprintf(os.Stderr, "biliopen %s: %v\n", name, err)
+			}
+			os.Exit(1)
+		}
+		return
+	}
+	if name != "-h" && name != "-help" && name != "--help" && name != "help" {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+	}
+	printUsage()
+	os.Exit(2)
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "usage: biliopen <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", cmd.name, cmd.usage)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "run 'biliopen <command> -h' for command flags")
+}
+
+// configFlags 各子命令共用的凭据参数
+type configFlags struct {
+	file      string
+	apiHost   string
+	appKey    string
+	appSecret string
+	projectID int64
+	liveCode  string
+}
+
+func addConfigFlags(fs *flag.FlagSet) *configFlags {
+	f := &configFlags{}
+	fs.StringVar(&f.file, "config", "", "配置文件路径，支持 .yaml、.yml 和 .json")
+	fs.StringVar(&f.apiHost, "api-host", "", "开放平台 API 地址 (env LIVE_API_HOST)")
+	fs.StringVar(&f.appKey, "app-key", "", "App Key (env LIVE_APP_KEY)")
+	fs.StringVar(&f.appSecret, "app-secret", "", "App Secret (env LIVE_APP_SECRET)")
+	fs.Int64Var(&f.projectID, "project-id", 0, "应用项目 ID (env LIVE_PROJECT_ID)")
+	fs.StringVar(&f.liveCode, "code", "", "主播身份码 (env LIVE_CODE)")
+	return f
+}
+
+// load 合并环境变量、配置文件和命令行参数，不做校验
+func (f *configFlags) load() (biliopen.Config, error) {
+	cfg, err := biliopen.LoadConfigFromEnv(biliopen.DefaultEnvPrefix)
+	if err != nil {
+		return cfg, err
+	}
+	if f.file != "" {
+		fileCfg, err := biliopen.LoadConfigFile(f.file)
+		if err != nil {
+			return cfg, err
+		}
+		mergeConfig(&cfg, fileCfg)
+	}
+	mergeConfig(&cfg, biliopen.Config{
+		ApiHost:   f.apiHost,
+		AppKey:    f.appKey,
+		AppSecret: f.appSecret,
+		ProjectID: f.projectID,
+		LiveCode:  f.liveCode,
+	})
+	return cfg, nil
+}
+
+// mergeConfig 用 src 中的非零值覆盖 dst
+func mergeConfig(dst *biliopen.Config, src biliopen.Config) {
+	if src.ApiHost != "" {
+		dst.ApiHost = src.ApiHost
+	}
+	if src.AppKey != "" {
+		dst.AppKey = src.AppKey
+	}
+	if src.AppSecret != "" {
+		dst.AppSecret = src.AppSecret
+	}
+	if src.ProjectID != 0 {
+		dst.ProjectID = src.ProjectID
+	}
+	if src.LiveCode != "" {
+		dst.LiveCode = src.LiveCode
+	}
+	if src.ProxyURL != "" {
+		dst.ProxyURL = src.ProxyURL
+	}
+	if src.DialTimeout != 0 {
+		dst.DialTimeout = src.DialTimeout
+	}
+	if src.HandshakeTimeout != 0 {
+		dst.HandshakeTimeout = src.HandshakeTimeout
+	}
+	if src.RequestTimeout != 0 {
+		dst.RequestTimeout = src.RequestTimeout
+	}
+	if src.WsHeartbeatInterval != 0 {
+		dst.WsHeartbeatInterval = src.WsHeartbeatInterval
+	}
+	if src.AppHeartbeatInterval != 0 {
+		dst.AppHeartbeatInterval = src.AppHeartbeatInterval
+	}
+	if src.Reconnect != (biliopen.ReconnectConfig{}) {
+		dst.Reconnect = src.Reconnect
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	biliopen "github.com/fython/bili-open-live-go"
+	"go.uber.org/zap"
+)
+
+// ANSI 颜色
+const (
+	colorReset   = "\x1b[0m"
+	colorGray    = "\x1b[90m"
+	colorRed     = "\x1b[31m"
+	colorGreen   = "\x1b[32m"
+	colorYellow  = "\x1b[33m"
+	colorBlue    = "\x1b[34m"
+	colorMagenta = "\x1b[35m"
+	colorCyan    = "\x1b[36m"
+)
+
+var cmdLabels = map[string]struct{ label, color string }{
+	biliopen.CmdLiveOpenPlatformDm:           {"弹幕", colorCyan},
+	biliopen.CmdLiveOpenPlatformSendGift:     {"礼物", colorYellow},
+	biliopen.CmdLiveOpenPlatformSuperChat:    {"醒目留言", colorRed},
+	biliopen.CmdLiveOpenPlatformSuperChatDel: {"留言下线", colorGray},
+	biliopen.CmdLiveOpenPlatformGuard:        {"大航海", colorMagenta},
+	biliopen.CmdLiveOpenPlatformLike:         {"点赞", colorGreen},
+}
+
+func runTail(args []string) error {
+	fs := flag.NewFlagSet("tail", flag.ContinueOnError)
+	cf := addConfigFlags(fs)
+	jsonOutput := fs.Bool("json", false, "以 NDJSON 格式输出，每行一条消息")
+	cmdFilter := fs.String("cmd", "", "只输出指定类型的消息，逗号分隔，支持 dm、gift、sc、sc_del、guard、like 或完整的 cmd")
+	userFilter := fs.String("user", "", "只输出指定用户的消息，逗号分隔，匹配 open_id、uid 或用户名")
+	noColor := fs.Bool("no-color", false, "不使用颜色输出，输出不是终端或者设置了 NO_COLOR 环境变量时自动关闭")
+	verbose := fs.Bool("v", false, "输出客户端调试日志到 stderr")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	cfg, err := cf.load()
+	if err != nil {
+		return err
+	}
+	if cfg.LiveCode == "" {
+		return fmt.Errorf("live code is required, set -code or LIVE_CODE")
+	}
+	cmds, err := parseCmdFilter(*cmdFilter)
+	if err != nil {
+		return err
+	}
+	client, err := biliopen.NewLiveClient(cfg)
+	if err != nil {
+		return err
+	}
+	if *verbose {
+		logger, _ := zap.NewDevelopment()
+		defer zap.ReplaceGlobals(logger)()
+	}
+
+	p := &tailPrinter{
+		w:     os.Stdout,
+		json:  *jsonOutput,
+		color: !*noColor && os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout),
+		cmds:  cmds,
+		users: splitList(*userFilter),
+		now:   time.Now,
+	}
+	p.attach(client)
+	client.Use(biliopen.RecoverMiddleware())
+	closed := make(chan error, 1)
+	client.OnClose = func(err error) {
+		if err != nil {
+			select {
+			case closed <- err:
+			default:
+			}
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err = client.Connect(ctx, cfg.LiveCode); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "connected, press Ctrl-C to exit")
+	select {
+	case <-ctx.Done():
+		// 通过 Disconnect 调用 /v2/app/end 正常结束，避免下次连接时提示玩法未结束
+		dctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		defer cancel()
+		return client.Disconnect(dctx)
+	case err = <-closed:
+		return fmt.Errorf("connection closed: %w", err)
+	}
+}
+
+// parseCmdFilter 解析 -cmd 参数，返回空 map 表示不过滤
+func parseCmdFilter(s string) (map[string]bool, error) {
+	cmds := map[string]bool{}
+	for item := range splitList(s) {
+		cmd, ok := biliopen.ResolveCmd(item)
+		if !ok {
+			return nil, fmt.Errorf("unknown cmd %q", item)
+		}
+		cmds[cmd] = true
+	}
+	return cmds, nil
+}
+
+func splitList(s string) map[string]bool {
+	m := map[string]bool{}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			m[item] = true
+		}
+	}
+	return m
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// tailPrinter 过滤并输出消息，回调可能在重连前后的不同 goroutine 中触发，输出时加锁
+type tailPrinter struct {
+	mu    sync.Mutex
+	w     io.Writer
+	json  bool
+	color bool
+	cmds  map[string]bool
+	users map[string]bool
+	now   func() time.Time
+}
+
+func (p *tailPrinter) attach(c *biliopen.LiveClient) {
+	c.OnDanmaku = func(dm biliopen.Danmaku) {
+		p.print(biliopen.CmdLiveOpenPlatformDm, &dm.UserInfo, dm, dm.Message)
+	}
+	c.OnGift = func(g biliopen.Gift) {
+		p.print(biliopen.CmdLiveOpenPlatformSendGift, &g.UserInfo, g,
+			fmt.Sprintf("%s x%d (%.1f 元)", g.GiftName, g.GiftNum, float64(g.TotalPrice())/1000))
+	}
+	c.OnSuperChat = func(sc biliopen.SuperChat) {
+		p.print(biliopen.CmdLiveOpenPlatformSuperChat, &sc.UserInfo, sc, fmt.Sprintf("[%d 元] %s", sc.RMB, sc.Message))
+	}
+	c.OnSuperChatDel = func(del biliopen.SuperChatDel) {
+		ids := make([]string, len(del.SuperChatIDs))
+		for i, id := range del.SuperChatIDs {
+			ids[i] = strconv.FormatInt(id, 10)
+		}
+		p.print(biliopen.CmdLiveOpenPlatformSuperChatDel, nil, del, strings.Join(ids, ","))
+	}
+	c.OnGuard = func(g biliopen.Guard) {
+		p.print(biliopen.CmdLiveOpenPlatformGuard, &g.UserInfo, g, fmt.Sprintf("%s x%d%s", g.GuardLevel, g.GuardNum, g.GuardUnit))
+	}
+	c.OnLike = func(like biliopen.Like) {
+		p.print(biliopen.CmdLiveOpenPlatformLike, &like.UserInfo, like, fmt.Sprintf("%s x%d", like.LikeText, like.LikeCount))
+	}
+}
+
+// match 检查消息是否满足 -cmd 和 -user 过滤条件，设置了 -user 时没有用户信息的消息会被过滤
+func (p *tailPrinter) match(cmd string, user *biliopen.UserInfo) bool {
+	if len(p.cmds) > 0 && !p.cmds[cmd] {
+		return false
+	}
+	if len(p.users) == 0 {
+		return true
+	}
+	if user == nil {
+		return false
+	}
+	return p.users[user.Identity()] || p.users[user.OpenID] || p.users[user.Username] ||
+		(user.UID != 0 && p.users[strconv.Itoa(user.UID)])
+}
+
+func (p *tailPrinter) print(cmd string, user *biliopen.UserInfo, data any, text string) {
+	if !p.match(cmd, user) {
+		return
+	}
+	now := p.now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.json {
+		line, err := json.Marshal(struct {
+			Time time.Time `json:"time"`
+			Cmd  string    `json:"cmd"`
+			Data any       `json:"data"`
+		}{now, cmd, data})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "marshal %s fail: %v\n", cmd, err)
+			return
+		}
+		_, _ = p.w.Write(append(line, '\n'))
+		return
+	}
+	label := cmdLabels[cmd]
+	var sb strings.Builder
+	p.paint(&sb, colorGray, now.Format("15:04:05"))
+	sb.WriteByte(' ')
+	p.paint(&sb, label.color, "["+label.label+"]")
+	if user != nil {
+		sb.WriteByte(' ')
+		p.paint(&sb, colorBlue, user.Username)
+		sb.WriteByte(':')
+	}
+	sb.WriteByte(' ')
+	sb.WriteString(text)
+	sb.WriteByte('\n')
+	_, _ = io.WriteString(p.w, sb.String())
+}
+
+func (p *tailPrinter) paint(sb *strings.Builder, color, s string) {
+	if !p.color {
+		sb.WriteString(s)
+		return
+	}
+	sb.WriteString(color)
+	sb.WriteString(s)
+	sb.WriteString(colorReset)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	biliopen "github.com/fython/bili-open-live-go"
+)
+
+func TestParseCmdFilter(t *testing.T) {
+	cmds, err := parseCmdFilter("dm, GIFT,LIVE_OPEN_PLATFORM_LIKE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cmds) != 3 || !cmds[biliopen.CmdLiveOpenPlatformDm] || !cmds[biliopen.CmdLiveOpenPlatformSendGift] ||
+		!cmds[biliopen.CmdLiveOpenPlatformLike] {
+		t.Fatalf("unexpected cmds %v", cmds)
+	}
+	if _, err = parseCmdFilter("unknown"); err == nil {
+		t.Fatal("expect error for unknown cmd")
+	}
+}
+
+func TestTailPrinter(t *testing.T) {
+	var buf bytes.Buffer
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.Local)
+	p := &tailPrinter{
+		w:     &buf,
+		cmds:  map[string]bool{biliopen.CmdLiveOpenPlatformDm: true, biliopen.CmdLiveOpenPlatformSuperChatDel: true},
+		users: map[string]bool{"42": true},
+		now:   func() time.Time { return now },
+	}
+	client := &biliopen.LiveClient{}
+	p.attach(client)
+	client.OnDanmaku(biliopen.Danmaku{UserInfo: biliopen.UserInfo{UID: 42, Username: "alice"}, Message: "hi"})
+	client.OnDanmaku(biliopen.Danmaku{UserInfo: biliopen.UserInfo{UID: 7, Username: "bob"}, Message: "filtered"})
+	client.OnGift(biliopen.Gift{UserInfo: biliopen.UserInfo{UID: 42}, GiftName: "filtered"})
+	client.OnSuperChatDel(biliopen.SuperChatDel{SuperChatIDs: []int64{1}})
+	if got, want := buf.String(), "03:04:05 [弹幕] alice: hi\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	buf.Reset()
+	p.json = true
+	p.users = nil
+	client.OnSuperChatDel(biliopen.SuperChatDel{SuperChatIDs: []int64{1, 2}})
+	var line struct {
+		Cmd  string                `json:"cmd"`
+		Data biliopen.SuperChatDel `json:"data"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatal(err)
+	}
+	if line.Cmd != biliopen.CmdLiveOpenPlatformSuperChatDel || len(line.Data.SuperChatIDs) != 2 {
+		t.Fatalf("unexpected json line %s", buf.String())
+	}
+}
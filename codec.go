@@ -0,0 +1,48 @@
+package biliopen
+
+import (
+	"encoding/json"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Codec JSON 编解码器，API 请求、长连鉴权和消息事件的序列化都通过它完成
+//
+// 默认使用 StdCodec，可以通过 LiveClient.Codec 替换为 JsoniterCodec 或 soniccodec 子包中的实现
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// StdCodec 基于标准库 encoding/json 的编解码器
+type StdCodec struct{}
+
+func (StdCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (StdCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// JsoniterCodec 基于 github.com/json-iterator/go 的编解码器
+//
+// API 为空时使用 jsoniter.ConfigCompatibleWithStandardLibrary，不会读取 jsoniter 的全局配置
+type JsoniterCodec struct {
+	API jsoniter.API
+}
+
+func (c JsoniterCodec) api() jsoniter.API {
+	if c.API == nil {
+		return jsoniter.ConfigCompatibleWithStandardLibrary
+	}
+	return c.API
+}
+
+func (c JsoniterCodec) Marshal(v any) ([]byte, error) {
+	return c.api().Marshal(v)
+}
+
+func (c JsoniterCodec) Unmarshal(data []byte, v any) error {
+	return c.api().Unmarshal(data, v)
+}
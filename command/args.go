@@ -0,0 +1,155 @@
+package command
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ArgType 参数类型
+type ArgType int
+
+const (
+	// ArgString 单个词
+	ArgString ArgType = iota
+	// ArgInt 整数，可以通过 Min、Max 限制范围
+	ArgInt
+	// ArgEnum 枚举值，只接受 Choices 或 Aliases 中的值，忽略大小写
+	ArgEnum
+	// ArgRest 剩余的全部内容，只能作为最后一个参数
+	ArgRest
+)
+
+// Arg 命令参数定义
+type Arg struct {
+	// Name 参数名，通过 Context.Int、Context.String 获取参数值
+	Name string
+	// Type 参数类型
+	Type ArgType
+	// Optional 是否可选，可选参数之后的参数也必须是可选的
+	Optional bool
+	// Default 可选参数缺省时的值，按 Type 解析
+	Default string
+	// Min、Max ArgInt 的取值范围，都为 0 时不限制
+	Min, Max int
+	// Choices ArgEnum 的可选值，解析后的参数值为其中之一
+	Choices []string
+	// Aliases ArgEnum 的别名，例如 {"红队": "red"}，值需要在 Choices 中
+	Aliases map[string]string
+}
+
+// usage 参数在用法中的写法，例如 <team:red|blue>、[count]、<text...>
+func (a Arg) usage() string {
+	name := a.Name
+	switch a.Type {
+	case ArgEnum:
+		name += ":" + strings.Join(a.Choices, "|")
+	case ArgRest:
+		name += "..."
+	}
+	if a.Optional {
+		return "[" + name + "]"
+	}
+	return "<" + name + ">"
+}
+
+// parse 解析单个参数值
+func (a Arg) parse(s string) (any, error) {
+	switch a.Type {
+	case ArgInt:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s 需要是整数", a.Name)
+		}
+		if (a.Min != 0 || a.Max != 0) && (n < a.Min || n > a.Max) {
+			return nil, fmt.Errorf("%s 需要在 %d 到 %d 之间", a.Name, a.Min, a.Max)
+		}
+		return n, nil
+	case ArgEnum:
+		for _, choice := range a.Choices {
+			if strings.EqualFold(s, choice) {
+				return choice, nil
+			}
+		}
+		for alias, choice := range a.Aliases {
+			if strings.EqualFold(s, alias) {
+				return choice, nil
+			}
+		}
+		return nil, fmt.Errorf("%s 只能是 %s", a.Name, strings.Join(a.Choices, "、"))
+	default:
+		return s, nil
+	}
+}
+
+// validateArgs 检查参数定义是否合法
+func validateArgs(args []Arg) error {
+	optional := false
+	seen := make(map[string]bool, len(args))
+	for i, arg := range args {
+		if arg.Name == "" {
+			return fmt.Errorf("arg %d has no name", i)
+		}
+		if seen[arg.Name] {
+			return fmt.Errorf("duplicate arg %q", arg.Name)
+		}
+		seen[arg.Name] = true
+		if arg.Type == ArgRest && i != len(args)-1 {
+			return fmt.Errorf("rest arg %q must be the last one", arg.Name)
+		}
+		if arg.Type == ArgEnum && len(arg.Choices) == 0 {
+			return fmt.Errorf("enum arg %q has no choices", arg.Name)
+		}
+		if optional && !arg.Optional {
+			return fmt.Errorf("required arg %q after optional arg", arg.Name)
+		}
+		optional = arg.Optional
+		if arg.Optional && arg.Default != "" {
+			if _, err := arg.parse(arg.Default); err != nil {
+				return fmt.Errorf("invalid default of arg %q: %w", arg.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// parseArgs 按参数定义解析命令名之后的内容，返回参数名到参数值的映射
+func parseArgs(defs []Arg, input string) (map[string]any, error) {
+	values := make(map[string]any, len(defs))
+	for _, def := range defs {
+		var token string
+		if def.Type == ArgRest {
+			token, input = strings.TrimSpace(input), ""
+		} else {
+			token, input = nextToken(input)
+		}
+		if token == "" {
+			if !def.Optional {
+				return nil, fmt.Errorf("缺少参数 %s", def.Name)
+			}
+			if def.Default == "" {
+				continue
+			}
+			token = def.Default
+		}
+		v, err := def.parse(token)
+		if err != nil {
+			return nil, err
+		}
+		values[def.Name] = v
+	}
+	if extra := strings.TrimSpace(input); extra != "" {
+		return nil, fmt.Errorf("多余的参数 %s", extra)
+	}
+	return values, nil
+}
+
+// nextToken 取出第一个以空白字符分隔的词，包括全角空格
+func nextToken(s string) (token, rest string) {
+	s = strings.TrimLeftFunc(s, unicode.IsSpace)
+	if i := strings.IndexFunc(s, unicode.IsSpace); i >= 0 {
+		return s[:i], s[i:]
+	}
+	return s, ""
+}
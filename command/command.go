@@ -0,0 +1,376 @@
+// Package command 基于弹幕事件的命令框架，支持命令前缀、别名、参数解析、权限角色和冷却时间
+//
+//	d := &command.Dispatcher{Prefixes: []string{"!", "！", ""}}
+//	d.MustRegister(&command.Command{
+//		Name:     "join",
+//		Aliases:  []string{"加入"},
+//		Args:     []command.Arg{{Name: "team", Type: command.ArgEnum, Choices: []string{"red", "blue"}, Aliases: map[string]string{"红队": "red", "蓝队": "blue"}}},
+//		Cooldown: time.Second * 10,
+//		Handler: func(ctx *command.Context) error {
+//			return game.Join(ctx.Danmaku.Identity(), ctx.String("team"))
+//		},
+//	})
+//	d.OnError = func(ctx *command.Context, err error) { /* 提示用户 */ }
+//	d.Attach(client)
+package command
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"go.uber.org/zap"
+
+	biliopen "github.com/fython/bili-open-live-go"
+)
+
+var defaultPrefixes = []string{"!", "！"}
+
+// cooldownSweepSize 冷却记录超过该数量时清理已经过期的记录
+const cooldownSweepSize = 4096
+
+// Command 命令定义
+type Command struct {
+	// Name 命令名，匹配时忽略大小写
+	Name string
+	// Aliases 命令别名，例如 "加入"
+	Aliases []string
+	// Args 参数定义，多余的参数会返回 UsageError
+	Args []Arg
+	// Role 需要的最低角色
+	Role Role
+	// MedalLevel 需要佩戴当前主播的粉丝勋章并且等级不低于该值，为 0 时不限制，房管不受限制
+	MedalLevel int
+	// Cooldown 同一用户两次调用的最短间隔
+	Cooldown time.Duration
+	// GlobalCooldown 所有用户两次调用的最短间隔
+	GlobalCooldown time.Duration
+	// Usage 用法说明，为空时根据命令名和参数生成，例如 "!join <team:red|blue>"
+	Usage string
+	// Handler 命令处理函数，返回的错误由 Dispatcher.Handle 向上传递
+	Handler func(ctx *Context) error
+}
+
+// Context 命令调用上下文
+type Context struct {
+	// Danmaku 触发命令的弹幕
+	Danmaku biliopen.Danmaku
+	// Command 匹配到的命令
+	Command *Command
+	// Prefix、Name 弹幕中实际使用的前缀和命令名，Name 可能是别名
+	Prefix, Name string
+	// Role 发送者的角色
+	Role Role
+
+	args map[string]any
+}
+
+// Int 获取 ArgInt 类型的参数值，可选参数缺省且没有默认值时返回 0
+func (c *Context) Int(name string) int {
+	n, _ := c.args[name].(int)
+	return n
+}
+
+// String 获取 ArgString、ArgEnum、ArgRest 类型的参数值，可选参数缺省且没有默认值时返回空字符串
+func (c *Context) String(name string) string {
+	s, _ := c.args[name].(string)
+	return s
+}
+
+// Has 参数是否有值，包括默认值
+func (c *Context) Has(name string) bool {
+	_, ok := c.args[name]
+	return ok
+}
+
+// UsageError 参数错误，Usage 为命令的用法说明，可以直接展示给用户
+type UsageError struct {
+	Usage  string
+	Reason string
+}
+
+func (e *UsageError) Error() string {
+	return fmt.Sprintf("%s，用法：%s", e.Reason, e.Usage)
+}
+
+// PermissionError 发送者没有调用命令的权限
+type PermissionError struct {
+	// Role 需要的最低角色
+	Role Role
+	// MedalLevel 需要的粉丝勋章等级
+	MedalLevel int
+}
+
+func (e *PermissionError) Error() string {
+	if e.MedalLevel > 0 {
+		return fmt.Sprintf("需要%s权限并佩戴 %d 级以上粉丝勋章", e.Role, e.MedalLevel)
+	}
+	return fmt.Sprintf("需要%s权限", e.Role)
+}
+
+// CooldownError 命令冷却中
+type CooldownError struct {
+	// Remaining 剩余冷却时间
+	Remaining time.Duration
+	// Global 是否为全局冷却
+	Global bool
+}
+
+func (e *CooldownError) Error() string {
+	remaining := e.Remaining.Round(time.Second)
+	if remaining < time.Second {
+		remaining = time.Second
+	}
+	if e.Global {
+		return fmt.Sprintf("命令冷却中，%s 后可用", remaining)
+	}
+	return fmt.Sprintf("你的命令冷却中，%s 后可用", remaining)
+}
+
+// IsUserError 是否为 UsageError、PermissionError 或 CooldownError 等需要提示用户的错误
+func IsUserError(err error) bool {
+	var usage *UsageError
+	var perm *PermissionError
+	var cd *CooldownError
+	return errors.As(err, &usage) || errors.As(err, &perm) || errors.As(err, &cd)
+}
+
+// Dispatcher 命令分发器，注册命令后通过 Attach 或 Handle 接收弹幕事件，零值可以直接使用，并发安全
+type Dispatcher struct {
+	// Prefixes 命令前缀，默认为 "!" 和 "！"，包含空字符串时不带前缀的弹幕也会匹配命令
+	Prefixes []string
+	// RoleFunc 计算发送者的角色，默认为 RoleOf，可以用于把主播或者特定用户视为房管
+	RoleFunc func(dm biliopen.Danmaku) Role
+	// OnError 命令匹配后出现 UsageError、PermissionError 或 CooldownError 时回调，用于提示用户，
+	// 为空时只输出调试日志
+	OnError func(ctx *Context, err error)
+
+	mu        sync.Mutex
+	commands  map[string]*Command
+	cooldowns map[string]time.Time
+
+	// now 测试时替换当前时间
+	now func() time.Time
+}
+
+func (d *Dispatcher) getPrefixes() []string {
+	if len(d.Prefixes) == 0 {
+		return defaultPrefixes
+	}
+	return d.Prefixes
+}
+
+func (d *Dispatcher) getNow() time.Time {
+	if d.now != nil {
+		return d.now()
+	}
+	return time.Now()
+}
+
+func (d *Dispatcher) roleOf(dm biliopen.Danmaku) Role {
+	if d.RoleFunc != nil {
+		return d.RoleFunc(dm)
+	}
+	return RoleOf(dm)
+}
+
+// Register 注册命令，命令名或别名与已有命令冲突时返回错误
+func (d *Dispatcher) Register(cmd *Command) error {
+	if cmd.Name == "" || cmd.Handler == nil {
+		return fmt.Errorf("command name and handler are required")
+	}
+	if err := validateArgs(cmd.Args); err != nil {
+		return fmt.Errorf("command %q: %w", cmd.Name, err)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.commands == nil {
+		d.commands = make(map[string]*Command)
+	}
+	names := append([]string{cmd.Name}, cmd.Aliases...)
+	for _, name := range names {
+		if _, ok := d.commands[strings.ToLower(name)]; ok {
+			return fmt.Errorf("command %q already registered", name)
+		}
+	}
+	for _, name := range names {
+		d.commands[strings.ToLower(name)] = cmd
+	}
+	return nil
+}
+
+// MustRegister 同 Register，出错时 panic
+func (d *Dispatcher) MustRegister(cmds ...*Command) {
+	for _, cmd := range cmds {
+		if err := d.Register(cmd); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Usage 命令的用法说明
+func (d *Dispatcher) Usage(cmd *Command) string {
+	if cmd.Usage != "" {
+		return cmd.Usage
+	}
+	var sb strings.Builder
+	sb.WriteString(d.getPrefixes()[0])
+	sb.WriteString(cmd.Name)
+	for _, arg := range cmd.Args {
+		sb.WriteByte(' ')
+		sb.WriteString(arg.usage())
+	}
+	return sb.String()
+}
+
+// Attach 注册弹幕路由，返回的 RouteID 可以用于 RemoveRoute
+func (d *Dispatcher) Attach(c *biliopen.LiveClient) biliopen.RouteID {
+	return c.Route(biliopen.And(
+		biliopen.IsCmd(biliopen.CmdLiveOpenPlatformDm),
+		biliopen.DanmakuTypeIs(biliopen.DanmakuTypeText),
+	), d.Handle)
+}
+
+// Handle 处理事件，可以作为 biliopen.Handler 使用，非弹幕事件直接忽略
+//
+// 需要提示用户的错误交给 OnError，不会返回，返回的只有命令 Handler 的错误
+func (d *Dispatcher) Handle(e biliopen.Event) error {
+	dm, ok := e.Data.(biliopen.Danmaku)
+	if !ok {
+		return nil
+	}
+	ctx, err := d.dispatch(dm)
+	if err == nil || !IsUserError(err) {
+		return err
+	}
+	if d.OnError != nil {
+		d.OnError(ctx, err)
+	} else {
+		zap.L().Debug("command rejected", zap.String("name", ctx.Name),
+			zap.String("user", dm.Identity()), zap.Error(err))
+	}
+	return nil
+}
+
+// Dispatch 解析弹幕并调用匹配的命令，不是命令时返回 nil，
+// 错误可能是 UsageError、PermissionError、CooldownError 或者命令 Handler 返回的错误
+func (d *Dispatcher) Dispatch(dm biliopen.Danmaku) error {
+	_, err := d.dispatch(dm)
+	return err
+}
+
+func (d *Dispatcher) dispatch(dm biliopen.Danmaku) (*Context, error) {
+	ctx, input := d.match(dm)
+	if ctx == nil {
+		return nil, nil
+	}
+	cmd := ctx.Command
+	if !d.permitted(cmd, ctx) {
+		return ctx, &PermissionError{Role: cmd.Role, MedalLevel: cmd.MedalLevel}
+	}
+	args, err := parseArgs(cmd.Args, input)
+	if err != nil {
+		return ctx, &UsageError{Usage: d.Usage(cmd), Reason: err.Error()}
+	}
+	ctx.args = args
+	if err = d.acquireCooldown(cmd, dm.Identity()); err != nil {
+		return ctx, err
+	}
+	return ctx, cmd.Handler(ctx)
+}
+
+// match 按前缀从长到短匹配命令名，返回命令名之后的内容
+func (d *Dispatcher) match(dm biliopen.Danmaku) (*Context, string) {
+	msg := strings.TrimSpace(dm.Message)
+	prefixes := append([]string(nil), d.getPrefixes()...)
+	sort.SliceStable(prefixes, func(i, j int) bool {
+		return len(prefixes[i]) > len(prefixes[j])
+	})
+	for _, prefix := range prefixes {
+		if !strings.HasPrefix(msg, prefix) {
+			continue
+		}
+		rest := msg[len(prefix):]
+		if prefix != "" && strings.TrimLeftFunc(rest, unicode.IsSpace) != rest {
+			// 前缀和命令名之间不能有空白字符
+			continue
+		}
+		name, input := nextToken(rest)
+		if cmd := d.lookup(name); cmd != nil {
+			return &Context{
+				Danmaku: dm,
+				Command: cmd,
+				Prefix:  prefix,
+				Name:    name,
+				Role:    d.roleOf(dm),
+			}, input
+		}
+	}
+	return nil, ""
+}
+
+func (d *Dispatcher) lookup(name string) *Command {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.commands[strings.ToLower(name)]
+}
+
+func (d *Dispatcher) permitted(cmd *Command, ctx *Context) bool {
+	if ctx.Role < cmd.Role {
+		return false
+	}
+	if cmd.MedalLevel > 0 && ctx.Role < RoleAdmin {
+		medal := ctx.Danmaku.FansMedal
+		return medal.FansMedalWearingStatus && medal.FansMedalLevel >= cmd.MedalLevel
+	}
+	return true
+}
+
+// acquireCooldown 检查冷却时间，没有冷却时记录本次调用
+func (d *Dispatcher) acquireCooldown(cmd *Command, user string) error {
+	if cmd.Cooldown <= 0 && cmd.GlobalCooldown <= 0 {
+		return nil
+	}
+	now := d.getNow()
+	userKey := cmd.Name + "\x00" + user
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.cooldowns == nil {
+		d.cooldowns = make(map[string]time.Time)
+	}
+	if cmd.GlobalCooldown > 0 {
+		if until := d.cooldowns[cmd.Name]; now.Before(until) {
+			return &CooldownError{Remaining: until.Sub(now), Global: true}
+		}
+	}
+	if cmd.Cooldown > 0 && user != "" {
+		if until := d.cooldowns[userKey]; now.Before(until) {
+			return &CooldownError{Remaining: until.Sub(now)}
+		}
+	}
+	if len(d.cooldowns) >= cooldownSweepSize {
+		for key, until := range d.cooldowns {
+			if !now.Before(until) {
+				delete(d.cooldowns, key)
+			}
+		}
+	}
+	if cmd.GlobalCooldown > 0 {
+		d.cooldowns[cmd.Name] = now.Add(cmd.GlobalCooldown)
+	}
+	if cmd.Cooldown > 0 && user != "" {
+		d.cooldowns[userKey] = now.Add(cmd.Cooldown)
+	}
+	return nil
+}
+
+// ResetCooldowns 清除所有冷却记录
+func (d *Dispatcher) ResetCooldowns() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.cooldowns = nil
+}
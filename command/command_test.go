@@ -0,0 +1,130 @@
+package command
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	biliopen "github.com/fython/bili-open-live-go"
+)
+
+func danmaku(uid int, msg string) biliopen.Danmaku {
+	return biliopen.Danmaku{UserInfo: biliopen.UserInfo{UID: uid}, Message: msg}
+}
+
+func TestDispatcher(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	d := &Dispatcher{Prefixes: []string{"!", "！", ""}, now: func() time.Time { return now }}
+	var joined []string
+	d.MustRegister(&Command{
+		Name:    "join",
+		Aliases: []string{"加入"},
+		Args: []Arg{
+			{Name: "team", Type: ArgEnum, Choices: []string{"red", "blue"}, Aliases: map[string]string{"红队": "red"}},
+			{Name: "count", Type: ArgInt, Optional: true, Default: "1", Min: 1, Max: 3},
+		},
+		Cooldown: time.Second * 10,
+		Handler: func(ctx *Context) error {
+			joined = append(joined, ctx.String("team"))
+			if ctx.Int("count") != 1 {
+				joined = append(joined, "x")
+			}
+			return nil
+		},
+	})
+	var said string
+	d.MustRegister(&Command{
+		Name:           "say",
+		Args:           []Arg{{Name: "text", Type: ArgRest}},
+		Role:           RoleCaptain,
+		GlobalCooldown: time.Minute,
+		Handler: func(ctx *Context) error {
+			said = ctx.String("text")
+			return nil
+		},
+	})
+
+	for _, msg := range []string{"!join red", "加入　红队", "hello world", "! join red"} {
+		if err := d.Dispatch(danmaku(len(joined)+1, msg)); err != nil {
+			t.Fatalf("%q: %v", msg, err)
+		}
+	}
+	if len(joined) != 2 || joined[0] != "red" || joined[1] != "red" {
+		t.Fatalf("unexpected joined %v", joined)
+	}
+
+	var usage *UsageError
+	for _, msg := range []string{"!join", "!join green", "!join blue 5", "!join blue 2 extra"} {
+		if err := d.Dispatch(danmaku(10, msg)); !errors.As(err, &usage) {
+			t.Fatalf("%q: expect usage error, got %v", msg, err)
+		}
+	}
+	if usage.Usage != "!join <team:red|blue> [count]" {
+		t.Fatalf("unexpected usage %q", usage.Usage)
+	}
+
+	// 用户冷却
+	var cd *CooldownError
+	if err := d.Dispatch(danmaku(1, "!JOIN blue")); !errors.As(err, &cd) || cd.Global || cd.Remaining != time.Second*10 {
+		t.Fatalf("expect user cooldown, got %v", err)
+	}
+	now = now.Add(time.Second * 10)
+	if err := d.Dispatch(danmaku(1, "!join blue 2")); err != nil || joined[len(joined)-1] != "x" {
+		t.Fatalf("cooldown should expire, got %v %v", err, joined)
+	}
+
+	// 权限与全局冷却
+	var perm *PermissionError
+	if err := d.Dispatch(danmaku(1, "!say hi")); !errors.As(err, &perm) || perm.Role != RoleCaptain {
+		t.Fatalf("expect permission error, got %v", err)
+	}
+	captain := danmaku(2, "!say hello  world")
+	captain.GuardLevel = biliopen.GuardLevelCaptain
+	if err := d.Dispatch(captain); err != nil || said != "hello  world" {
+		t.Fatalf("unexpected say result %v %q", err, said)
+	}
+	admin := danmaku(3, "!say again")
+	admin.Admin = true
+	if err := d.Dispatch(admin); !errors.As(err, &cd) || !cd.Global {
+		t.Fatalf("expect global cooldown, got %v", err)
+	}
+
+	if err := d.Register(&Command{Name: "JOIN", Handler: func(*Context) error { return nil }}); err == nil {
+		t.Fatal("expect duplicate command error")
+	}
+}
+
+func TestDispatcherHandle(t *testing.T) {
+	d := &Dispatcher{}
+	var rejected []error
+	d.OnError = func(ctx *Context, err error) {
+		if ctx.Command.Name != "roll" {
+			t.Errorf("unexpected command %q", ctx.Command.Name)
+		}
+		rejected = append(rejected, err)
+	}
+	handlerErr := errors.New("handler error")
+	d.MustRegister(&Command{
+		Name:       "roll",
+		MedalLevel: 10,
+		Handler:    func(*Context) error { return handlerErr },
+	})
+
+	c := &biliopen.LiveClient{}
+	d.Attach(c)
+	event := func(dm biliopen.Danmaku) biliopen.Event {
+		return biliopen.Event{Cmd: biliopen.CmdLiveOpenPlatformDm, Data: dm}
+	}
+	fan := danmaku(1, "!roll")
+	fan.FansMedal = biliopen.FansMedal{FansMedalLevel: 12, FansMedalWearingStatus: true}
+	if err := d.Handle(event(fan)); !errors.Is(err, handlerErr) {
+		t.Fatalf("expect handler error, got %v", err)
+	}
+	fan.FansMedalWearingStatus = false
+	if err := d.Handle(event(fan)); err != nil || len(rejected) != 1 {
+		t.Fatalf("expect rejected by OnError, got %v %v", err, rejected)
+	}
+	if RoleOf(fan) != RoleEveryone {
+		t.Fatal("not wearing medal should be everyone")
+	}
+}
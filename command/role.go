@@ -0,0 +1,60 @@
+package command
+
+import (
+	biliopen "github.com/fython/bili-open-live-go"
+)
+
+// Role 发送者的权限角色，数值越大权限越高
+type Role int
+
+const (
+	// RoleEveryone 所有人
+	RoleEveryone Role = iota
+	// RoleFan 佩戴当前主播的粉丝勋章
+	RoleFan
+	// RoleCaptain 舰长及以上
+	RoleCaptain
+	// RoleAdmiral 提督及以上
+	RoleAdmiral
+	// RoleGovernor 总督
+	RoleGovernor
+	// RoleAdmin 房管
+	RoleAdmin
+)
+
+func (r Role) String() string {
+	switch r {
+	case RoleEveryone:
+		return "所有人"
+	case RoleFan:
+		return "粉丝团"
+	case RoleCaptain:
+		return "舰长"
+	case RoleAdmiral:
+		return "提督"
+	case RoleGovernor:
+		return "总督"
+	case RoleAdmin:
+		return "房管"
+	default:
+		return "未知"
+	}
+}
+
+// RoleOf 根据弹幕中的房管、大航海和粉丝勋章信息计算发送者的角色，取其中最高的一个
+func RoleOf(dm biliopen.Danmaku) Role {
+	switch {
+	case bool(dm.Admin):
+		return RoleAdmin
+	case dm.GuardLevel == biliopen.GuardLevelGovernor:
+		return RoleGovernor
+	case dm.GuardLevel == biliopen.GuardLevelAdmiral:
+		return RoleAdmiral
+	case dm.GuardLevel == biliopen.GuardLevelCaptain:
+		return RoleCaptain
+	case dm.FansMedalWearingStatus:
+		return RoleFan
+	default:
+		return RoleEveryone
+	}
+}
@@ -0,0 +1,273 @@
+package biliopen
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultEnvPrefix LoadConfigFromEnv 默认使用的环境变量前缀
+const DefaultEnvPrefix = "LIVE_"
+
+// Config 声明式的客户端配置，可以从环境变量、YAML 或 JSON 中加载，通过 NewLiveClient 创建客户端
+//
+// 环境变量名为前缀加上 env 标签，例如默认前缀下 AppKey 对应 LIVE_APP_KEY，
+// Reconnect.MaxAttempts 对应 LIVE_RECONNECT_MAX_ATTEMPTS
+type Config struct {
+	// ApiHost 开放平台 API 地址，默认 ApiHostRelease
+	ApiHost string `json:"api_host" yaml:"api_host" env:"API_HOST"`
+	// AppKey 申请得到的 App Key
+	AppKey string `json:"app_key" yaml:"app_key" env:"APP_KEY"`
+	// AppSecret 申请得到的 App Secret
+	AppSecret string `json:"app_secret" yaml:"app_secret" env:"APP_SECRET"`
+	// ProjectID 应用项目 ID
+	ProjectID int64 `json:"project_id" yaml:"project_id" env:"PROJECT_ID"`
+	// LiveCode 主播身份码，可选，仅用于和凭据一起保存，连接时仍需传给 Connect
+	LiveCode string `json:"live_code" yaml:"live_code" env:"CODE"`
+
+	// ProxyURL 代理地址，支持 http、https 和 socks5 协议
+	ProxyURL string `json:"proxy_url" yaml:"proxy_url" env:"PROXY_URL"`
+	// DialTimeout 建立 TCP 连接的超时时间
+	DialTimeout Duration `json:"dial_timeout" yaml:"dial_timeout" env:"DIAL_TIMEOUT"`
+	// HandshakeTimeout TLS 及 WebSocket 握手超时时间
+	HandshakeTimeout Duration `json:"handshake_timeout" yaml:"handshake_timeout" env:"HANDSHAKE_TIMEOUT"`
+	// RequestTimeout API 请求超时时间
+	RequestTimeout Duration `json:"request_timeout" yaml:"request_timeout" env:"REQUEST_TIMEOUT"`
+
+	// WsHeartbeatInterval WebSocket 长连心跳间隔
+	WsHeartbeatInterval Duration `json:"ws_heartbeat_interval" yaml:"ws_heartbeat_interval" env:"WS_HEARTBEAT_INTERVAL"`
+	// AppHeartbeatInterval 项目心跳间隔，为 0 时不发送，需要保持项目开启时建议设置为 20s
+	AppHeartbeatInterval Duration `json:"app_heartbeat_interval" yaml:"app_heartbeat_interval" env:"APP_HEARTBEAT_INTERVAL"`
+
+	// Reconnect 断线重连策略
+	Reconnect ReconnectConfig `json:"reconnect" yaml:"reconnect" env:"RECONNECT_"`
+}
+
+// ReconnectConfig 断线重连策略配置，对应 ReconnectPolicy
+type ReconnectConfig struct {
+	MaxAttempts    int      `json:"max_attempts" yaml:"max_attempts" env:"MAX_ATTEMPTS"`
+	InitialBackoff Duration `json:"initial_backoff" yaml:"initial_backoff" env:"INITIAL_BACKOFF"`
+	MaxBackoff     Duration `json:"max_backoff" yaml:"max_backoff" env:"MAX_BACKOFF"`
+}
+
+// Duration 支持以 "5s"、"1m30s" 这类字符串形式出现在配置文件中的 time.Duration
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// FieldError 单个配置字段的校验错误
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ValidationError 配置校验错误，包含所有不合法的字段，可以通过 errors.As 取出其中的 FieldError
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		msgs[i] = fe.Error()
+	}
+	return "invalid config: " + strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, fe := range e.Errors {
+		errs[i] = fe
+	}
+	return errs
+}
+
+// Validate 校验配置，返回 *ValidationError 列出所有不合法的字段
+func (c Config) Validate() error {
+	var errs []FieldError
+	add := func(field, format string, args ...any) {
+		errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+	if c.ApiHost != "" {
+		if u, err := url.Parse(c.ApiHost); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("ApiHost", "should be an http(s) url, got %q", c.ApiHost)
+		}
+	}
+	if c.AppKey == "" {
+		add("AppKey", "should not be empty")
+	}
+	if c.AppSecret == "" {
+		add("AppSecret", "should not be empty")
+	}
+	if c.ProjectID <= 0 {
+		add("ProjectID", "should be positive, got %d", c.ProjectID)
+	}
+	if c.ProxyURL != "" {
+		if u, err := url.Parse(c.ProxyURL); err != nil || u.Host == "" {
+			add("ProxyURL", "should be a valid url, got %q", c.ProxyURL)
+		} else if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5" {
+			add("ProxyURL", "unsupported scheme %q", u.Scheme)
+		}
+	}
+	for _, d := range []struct {
+		field string
+		value Duration
+	}{
+		{"DialTimeout", c.DialTimeout},
+		{"HandshakeTimeout", c.HandshakeTimeout},
+		{"RequestTimeout", c.RequestTimeout},
+		{"WsHeartbeatInterval", c.WsHeartbeatInterval},
+		{"Reconnect.InitialBackoff", c.Reconnect.InitialBackoff},
+		{"Reconnect.MaxBackoff", c.Reconnect.MaxBackoff},
+	} {
+		if d.value < 0 {
+			add(d.field, "should not be negative, got %s", time.Duration(d.value))
+		}
+	}
+	if c.Reconnect.InitialBackoff > 0 && c.Reconnect.MaxBackoff > 0 && c.Reconnect.InitialBackoff > c.Reconnect.MaxBackoff {
+		add("Reconnect.InitialBackoff", "should not exceed MaxBackoff %s", time.Duration(c.Reconnect.MaxBackoff))
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return &ValidationError{Errors: errs}
+}
+
+// LoadConfigFromEnv 从环境变量中加载配置，prefix 为空时使用 DefaultEnvPrefix
+//
+// 未设置的环境变量保持零值，加载后需要调用 Validate 校验
+func LoadConfigFromEnv(prefix string) (Config, error) {
+	if prefix == "" {
+		prefix = DefaultEnvPrefix
+	}
+	var cfg Config
+	var errs []FieldError
+	loadEnv(reflect.ValueOf(&cfg).Elem(), prefix, "", &errs)
+	if len(errs) > 0 {
+		return cfg, &ValidationError{Errors: errs}
+	}
+	return cfg, nil
+}
+
+var durationType = reflect.TypeOf(Duration(0))
+
+func loadEnv(v reflect.Value, prefix, fieldPrefix string, errs *[]FieldError) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name := prefix + sf.Tag.Get("env")
+		field := fieldPrefix + sf.Name
+		fv := v.Field(i)
+		if sf.Type.Kind() == reflect.Struct {
+			loadEnv(fv, name, field+".", errs)
+			continue
+		}
+		raw, ok := os.LookupEnv(name)
+		if !ok || raw == "" {
+			continue
+		}
+		var err error
+		switch {
+		case sf.Type == durationType:
+			var d Duration
+			if err = d.UnmarshalText([]byte(raw)); err == nil {
+				fv.Set(reflect.ValueOf(d))
+			}
+		case sf.Type.Kind() == reflect.String:
+			fv.SetString(raw)
+		case sf.Type.Kind() == reflect.Int || sf.Type.Kind() == reflect.Int64:
+			var n int64
+			if n, err = strconv.ParseInt(raw, 10, 64); err == nil {
+				fv.SetInt(n)
+			}
+		}
+		if err != nil {
+			*errs = append(*errs, FieldError{Field: field, Message: fmt.Sprintf("parse env %s fail: %v", name, err)})
+		}
+	}
+}
+
+// LoadConfigFromYAML 从 YAML 内容中加载配置
+func LoadConfigFromYAML(data []byte) (Config, error) {
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("unmarshal yaml config fail: %w", err)
+	}
+	return cfg, nil
+}
+
+// LoadConfigFromJSON 从 JSON 内容中加载配置
+func LoadConfigFromJSON(data []byte) (Config, error) {
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("unmarshal json config fail: %w", err)
+	}
+	return cfg, nil
+}
+
+// LoadConfigFile 根据扩展名从 .yaml、.yml 或 .json 文件中加载配置
+func LoadConfigFile(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		return LoadConfigFromYAML(data)
+	case ".json":
+		return LoadConfigFromJSON(data)
+	default:
+		return Config{}, fmt.Errorf("unsupported config file type: %s", ext)
+	}
+}
+
+// NewLiveClient 校验配置并创建客户端，回调函数等运行时参数仍需在 Connect 之前自行设置
+func NewLiveClient(cfg Config) (*LiveClient, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	c := &LiveClient{
+		ApiHost:              cfg.ApiHost,
+		AppKey:               cfg.AppKey,
+		AppSecret:            cfg.AppSecret,
+		ProjectID:            cfg.ProjectID,
+		DialTimeout:          time.Duration(cfg.DialTimeout),
+		HandshakeTimeout:     time.Duration(cfg.HandshakeTimeout),
+		RequestTimeout:       time.Duration(cfg.RequestTimeout),
+		WsHeartbeatInterval:  time.Duration(cfg.WsHeartbeatInterval),
+		AppHeartbeatInterval: time.Duration(cfg.AppHeartbeatInterval),
+		Reconnect: ReconnectPolicy{
+			MaxAttempts:    cfg.Reconnect.MaxAttempts,
+			InitialBackoff: time.Duration(cfg.Reconnect.InitialBackoff),
+			MaxBackoff:     time.Duration(cfg.Reconnect.MaxBackoff),
+		},
+	}
+	if cfg.ProxyURL != "" {
+		// Validate 已经确保可以解析
+		c.ProxyURL, _ = url.Parse(cfg.ProxyURL)
+	}
+	return c, nil
+}
@@ -0,0 +1,85 @@
+package biliopen_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	biliopen "github.com/fython/bili-open-live-go"
+)
+
+func TestConfigValidate(t *testing.T) {
+	err := biliopen.Config{
+		ApiHost:   "live-open.biliapi.com",
+		AppKey:    "key",
+		ProjectID: 0,
+		ProxyURL:  "ftp://127.0.0.1:21",
+	}.Validate()
+	var ve *biliopen.ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("expect ValidationError, got %v", err)
+	}
+	var fields []string
+	for _, fe := range ve.Errors {
+		fields = append(fields, fe.Field)
+	}
+	want := []string{"ApiHost", "AppSecret", "ProjectID", "ProxyURL"}
+	if len(fields) != len(want) {
+		t.Fatalf("unexpected invalid fields %v, want %v", fields, want)
+	}
+	for i := range want {
+		if fields[i] != want[i] {
+			t.Fatalf("unexpected invalid fields %v, want %v", fields, want)
+		}
+	}
+	var fe biliopen.FieldError
+	if !errors.As(err, &fe) || fe.Field != "ApiHost" {
+		t.Fatalf("expect first FieldError to be ApiHost, got %v", fe)
+	}
+}
+
+func TestLoadConfigFromYAML(t *testing.T) {
+	cfg, err := biliopen.LoadConfigFromYAML([]byte(`
+app_key: key
+app_secret: secret
+project_id: 123
+proxy_url: socks5://127.0.0.1:1080
+request_timeout: 10s
+ws_heartbeat_interval: 20s
+reconnect:
+  max_attempts: -1
+  initial_backoff: 500ms
+  max_backoff: 1m
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := biliopen.NewLiveClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.ProjectID != 123 || client.RequestTimeout != 10*time.Second || client.WsHeartbeatInterval != 20*time.Second {
+		t.Fatalf("unexpected client %+v", client)
+	}
+	if client.ProxyURL == nil || client.ProxyURL.Scheme != "socks5" {
+		t.Fatalf("unexpected proxy %v", client.ProxyURL)
+	}
+	if p := client.Reconnect; p.MaxAttempts != -1 || p.InitialBackoff != 500*time.Millisecond || p.MaxBackoff != time.Minute {
+		t.Fatalf("unexpected reconnect policy %+v", p)
+	}
+}
+
+func TestLoadConfigFromEnv(t *testing.T) {
+	t.Setenv("TEST_LIVE_APP_KEY", "key")
+	t.Setenv("TEST_LIVE_PROJECT_ID", "42")
+	t.Setenv("TEST_LIVE_RECONNECT_MAX_BACKOFF", "1m")
+	t.Setenv("TEST_LIVE_DIAL_TIMEOUT", "soon")
+	cfg, err := biliopen.LoadConfigFromEnv("TEST_LIVE_")
+	var fe biliopen.FieldError
+	if !errors.As(err, &fe) || fe.Field != "DialTimeout" {
+		t.Fatalf("expect DialTimeout parse error, got %v", err)
+	}
+	if cfg.AppKey != "key" || cfg.ProjectID != 42 || cfg.Reconnect.MaxBackoff != biliopen.Duration(time.Minute) {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+}
@@ -0,0 +1,214 @@
+package biliopen
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDedupCapacity = 10000
+	defaultDedupTTL      = time.Minute * 10
+)
+
+// DedupStore 去重记录的持久化接口，例如基于 Redis 实现，使进程重启或多实例部署时仍然能识别重复消息
+type DedupStore interface {
+	// CheckAndAdd 记录消息 ID 并在 ttl 后过期，返回该 ID 在此之前是否已经记录过，实现需要保证并发安全
+	CheckAndAdd(msgID string, ttl time.Duration) (seen bool, err error)
+}
+
+// DedupStoreForgetter 可选接口，DedupStore 实现后 Deduplicator.Forget 会同时删除 Store 中的记录
+type DedupStoreForgetter interface {
+	// Forget 删除消息 ID 的记录，记录不存在时不返回错误
+	Forget(msgID string) error
+}
+
+// Deduplicator 根据 msg_id 过滤重复消息，断线重连后服务端可能会重新推送已经收到过的消息
+//
+// 内存中保留最近 Capacity 条、TTL 时间内的消息 ID，零值可以直接使用，可以在多个 LiveClient 间共享
+type Deduplicator struct {
+	// Capacity 内存中最多保留的消息 ID 数量，默认 10000
+	Capacity int
+	// TTL 消息 ID 的保留时间，默认 10 分钟
+	TTL time.Duration
+	// Store 可选的持久化存储，内存中没有记录时再查询 Store，Store 出错时按非重复消息处理
+	Store DedupStore
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// order 按写入时间排列，最早写入的在末尾
+	order *list.List
+	stats DedupStats
+
+	// now 测试时替换当前时间
+	now func() time.Time
+}
+
+type dedupEntry struct {
+	msgID    string
+	expireAt time.Time
+}
+
+// DedupStats 去重统计
+type DedupStats struct {
+	// Passed 通过的消息数量，包括没有 msg_id 的消息
+	Passed uint64
+	// Suppressed 被过滤的重复消息数量
+	Suppressed uint64
+	// SuppressedByCmd 按 cmd 统计的重复消息数量
+	SuppressedByCmd map[string]uint64
+	// StoreErrors Store 返回错误的次数
+	StoreErrors uint64
+	// Size 内存中当前保留的消息 ID 数量
+	Size int
+}
+
+func (d *Deduplicator) getCapacity() int {
+	if d.Capacity <= 0 {
+		return defaultDedupCapacity
+	}
+	return d.Capacity
+}
+
+func (d *Deduplicator) getTTL() time.Duration {
+	if d.TTL <= 0 {
+		return defaultDedupTTL
+	}
+	return d.TTL
+}
+
+func (d *Deduplicator) getNow() time.Time {
+	if d.now != nil {
+		return d.now()
+	}
+	return time.Now()
+}
+
+// Duplicate 检查 cmd 消息的 msgID 是否已经出现过，没有出现过时记录下来并返回 false，msgID 为空时总是返回 false
+func (d *Deduplicator) Duplicate(cmd, msgID string) bool {
+	if msgID == "" {
+		d.mu.Lock()
+		d.stats.Passed++
+		d.mu.Unlock()
+		return false
+	}
+	ttl := d.getTTL()
+	d.mu.Lock()
+	if d.entries == nil {
+		d.entries = map[string]*list.Element{}
+		d.order = list.New()
+	}
+	now := d.getNow()
+	d.evictExpired(now)
+	if _, ok := d.entries[msgID]; ok {
+		d.suppress(cmd)
+		d.mu.Unlock()
+		return true
+	}
+	// 先写入内存再查询 Store，并发收到的同一条消息只会有一条通过
+	d.entries[msgID] = d.order.PushFront(&dedupEntry{msgID: msgID, expireAt: now.Add(ttl)})
+	for d.order.Len() > d.getCapacity() {
+		d.remove(d.order.Back())
+	}
+	d.mu.Unlock()
+
+	if d.Store != nil {
+		seen, err := d.Store.CheckAndAdd(msgID, ttl)
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if err != nil {
+			d.stats.StoreErrors++
+		} else if seen {
+			d.suppress(cmd)
+			return true
+		}
+		d.stats.Passed++
+		return false
+	}
+	d.mu.Lock()
+	d.stats.Passed++
+	d.mu.Unlock()
+	return false
+}
+
+// Seen 检查 msgID 是否已经记录过，不记录也不更新统计，只检查内存中的记录，不查询 Store，
+// 适用于在同一把锁内先检查、处理成功后再通过 Duplicate 记录的场景
+func (d *Deduplicator) Seen(msgID string) bool {
+	if msgID == "" {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.entries == nil {
+		return false
+	}
+	d.evictExpired(d.getNow())
+	_, ok := d.entries[msgID]
+	return ok
+}
+
+// Forget 删除 msgID 的记录，用于消息处理失败后撤销 Duplicate 的记录，使服务端重新推送的消息可以再次通过
+//
+// Store 实现了 DedupStoreForgetter 时同时删除 Store 中的记录，Store 出错时计入 StoreErrors
+func (d *Deduplicator) Forget(msgID string) {
+	if msgID == "" {
+		return
+	}
+	d.mu.Lock()
+	if e, ok := d.entries[msgID]; ok {
+		d.remove(e)
+	}
+	d.mu.Unlock()
+	if f, ok := d.Store.(DedupStoreForgetter); ok {
+		if err := f.Forget(msgID); err != nil {
+			d.mu.Lock()
+			d.stats.StoreErrors++
+			d.mu.Unlock()
+		}
+	}
+}
+
+// Stats 返回当前的统计数据
+func (d *Deduplicator) Stats() DedupStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	stats := d.stats
+	stats.SuppressedByCmd = make(map[string]uint64, len(d.stats.SuppressedByCmd))
+	for cmd, n := range d.stats.SuppressedByCmd {
+		stats.SuppressedByCmd[cmd] = n
+	}
+	stats.Size = len(d.entries)
+	return stats
+}
+
+// Reset 清空内存中的记录和统计数据，不影响 Store
+func (d *Deduplicator) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.entries = nil
+	d.order = nil
+	d.stats = DedupStats{}
+}
+
+func (d *Deduplicator) suppress(cmd string) {
+	d.stats.Suppressed++
+	if d.stats.SuppressedByCmd == nil {
+		d.stats.SuppressedByCmd = map[string]uint64{}
+	}
+	d.stats.SuppressedByCmd[cmd]++
+}
+
+// evictExpired 从末尾开始移除过期的记录，TTL 固定时末尾的记录总是最早过期
+func (d *Deduplicator) evictExpired(now time.Time) {
+	for e := d.order.Back(); e != nil; e = d.order.Back() {
+		if e.Value.(*dedupEntry).expireAt.After(now) {
+			return
+		}
+		d.remove(e)
+	}
+}
+
+func (d *Deduplicator) remove(e *list.Element) {
+	d.order.Remove(e)
+	delete(d.entries, e.Value.(*dedupEntry).msgID)
+}
@@ -0,0 +1,129 @@
+package biliopen
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDeduplicatorTTLAndCapacity(t *testing.T) {
+	now := time.Unix(0, 0)
+	d := &Deduplicator{Capacity: 2, TTL: time.Minute, now: func() time.Time { return now }}
+	if d.Duplicate("cmd", "a") || !d.Duplicate("cmd", "a") {
+		t.Fatal("second a should be duplicate")
+	}
+	if d.Duplicate("cmd", "") || d.Duplicate("cmd", "") {
+		t.Fatal("empty msg_id should never be duplicate")
+	}
+	// 超出容量后最早的 a 被淘汰
+	d.Duplicate("cmd", "b")
+	d.Duplicate("cmd", "c")
+	if d.Duplicate("cmd", "a") {
+		t.Fatal("a should be evicted by capacity")
+	}
+	now = now.Add(time.Minute)
+	if d.Duplicate("cmd", "c") {
+		t.Fatal("c should be expired")
+	}
+	stats := d.Stats()
+	if stats.Suppressed != 1 || stats.SuppressedByCmd["cmd"] != 1 || stats.Passed != 7 || stats.Size != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+type testDedupStore struct {
+	mu   sync.Mutex
+	seen map[string]bool
+	err  error
+}
+
+func (s *testDedupStore) CheckAndAdd(msgID string, _ time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return false, s.err
+	}
+	seen := s.seen[msgID]
+	s.seen[msgID] = true
+	return seen, nil
+}
+
+func TestDeduplicatorStore(t *testing.T) {
+	store := &testDedupStore{seen: map[string]bool{"old": true}}
+	d := &Deduplicator{Store: store}
+	if !d.Duplicate("cmd", "old") {
+		t.Fatal("msg_id recorded in store should be duplicate")
+	}
+	if d.Duplicate("cmd", "new") || !store.seen["new"] {
+		t.Fatal("new msg_id should pass and be recorded in store")
+	}
+	store.err = errors.New("store down")
+	if d.Duplicate("cmd", "other") {
+		t.Fatal("store error should fail open")
+	}
+	if stats := d.Stats(); stats.StoreErrors != 1 || stats.Suppressed != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestDeduplicatorConcurrent(t *testing.T) {
+	var delivered atomic.Int32
+	d := &Deduplicator{}
+	clients := make([]*LiveClient, 4)
+	for i := range clients {
+		clients[i] = &LiveClient{Dedup: d, OnDanmaku: func(Danmaku) { delivered.Add(1) }}
+	}
+	var wg sync.WaitGroup
+	for _, c := range clients {
+		wg.Add(1)
+		go func(c *LiveClient) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				data := []byte(`{"msg":"hi","msg_id":"` + strconv.Itoa(i) + `"}`)
+				if err := c.handleCmd(CmdLiveOpenPlatformDm, data); err != nil {
+					t.Error(err)
+				}
+			}
+		}(c)
+	}
+	wg.Wait()
+	if n := delivered.Load(); n != 100 {
+		t.Fatalf("expect 100 danmaku delivered, got %d", n)
+	}
+	if stats := d.Stats(); stats.SuppressedByCmd[CmdLiveOpenPlatformDm] != 300 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestDeduplicatorForgetOnFailure(t *testing.T) {
+	d := &Deduplicator{}
+	fail := true
+	var delivered int
+	c := &LiveClient{Dedup: d}
+	c.Use(func(next Handler) Handler {
+		return func(e Event) error {
+			if fail {
+				return errors.New("handler fail")
+			}
+			delivered++
+			return next(e)
+		}
+	})
+	data := []byte(`{"msg":"hi","msg_id":"a"}`)
+	if err := c.handleCmd(CmdLiveOpenPlatformDm, data); err == nil {
+		t.Fatal("expect handler error")
+	}
+	// 处理失败的消息重新推送后可以再次处理，成功后才会被过滤
+	fail = false
+	for i := 0; i < 2; i++ {
+		if err := c.handleCmd(CmdLiveOpenPlatformDm, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if delivered != 1 {
+		t.Fatalf("expect redelivered message to be handled once, got %d", delivered)
+	}
+}
@@ -1,16 +1,66 @@
 package biliopen
 
-import "fmt"
+import (
+	"fmt"
+	"unicode/utf8"
+)
 
 // CommonErrorCode 公共错误码
+//
+// CommonErrorCode 同时实现了 error 接口，下方的 Err 开头的常量可以作为哨兵错误配合 errors.Is 使用：
+//
+//	if errors.Is(err, biliopen.ErrInvalidLiveCode) {
+//		// 提示主播检查身份码
+//	}
 type CommonErrorCode int
 
+// 官方文档中列出的公共错误码，描述见 errorCodeDescription
+const (
+	ErrInvalidParams           CommonErrorCode = 4000 // 参数错误
+	ErrInvalidApp              CommonErrorCode = 4001 // 应用无效
+	ErrInvalidSignature        CommonErrorCode = 4002 // 签名异常
+	ErrRequestExpired          CommonErrorCode = 4003 // 请求过期
+	ErrDuplicateRequest        CommonErrorCode = 4004 // 重复请求
+	ErrInvalidSignatureMethod  CommonErrorCode = 4005 // 签名method异常
+	ErrInvalidVersion          CommonErrorCode = 4006 // 版本异常
+	ErrIPWhitelist             CommonErrorCode = 4007 // IP白名单限制
+	ErrPermissionDenied        CommonErrorCode = 4008 // 权限异常
+	ErrRateLimited             CommonErrorCode = 4009 // 接口访问限制
+	ErrApiNotFound             CommonErrorCode = 4010 // 接口不存在
+	ErrInvalidContentType      CommonErrorCode = 4011 // Content-Type不为application/json
+	ErrContentMD5Mismatch      CommonErrorCode = 4012 // MD5校验失败
+	ErrInvalidAccept           CommonErrorCode = 4013 // Accept不为application/json
+	ErrServiceUnavailable      CommonErrorCode = 5000 // 服务异常
+	ErrServerTimeout           CommonErrorCode = 5001 // 请求超时
+	ErrInternal                CommonErrorCode = 5002 // 内部错误
+	ErrServerConfig            CommonErrorCode = 5003 // 配置错误
+	ErrRoomWhitelist           CommonErrorCode = 5004 // 房间白名单限制
+	ErrRoomBlacklist           CommonErrorCode = 5005 // 房间黑名单限制
+	ErrInvalidCaptcha          CommonErrorCode = 6000 // 验证码错误
+	ErrInvalidPhone            CommonErrorCode = 6001 // 手机号码错误
+	ErrCaptchaExpired          CommonErrorCode = 6002 // 验证码已过期
+	ErrCaptchaRateLimited      CommonErrorCode = 6003 // 验证码频率限制
+	ErrNotInGame               CommonErrorCode = 7000 // 不在游戏内
+	ErrGameCoolingDown         CommonErrorCode = 7001 // 请求冷却期
+	ErrGameAlreadyStarted      CommonErrorCode = 7002 // 房间重复游戏
+	ErrHeartbeatExpired        CommonErrorCode = 7003 // 心跳过期
+	ErrBatchHeartbeatTooLarge  CommonErrorCode = 7004 // 批量心跳超过最大值
+	ErrBatchHeartbeatDuplicate CommonErrorCode = 7005 // 批量心跳ID重复
+	ErrInvalidLiveCode         CommonErrorCode = 7007 // 身份码错误
+	ErrProjectForbidden        CommonErrorCode = 8002 // 项目无权限访问
+)
+
+// Desc 错误码的中文描述，未知错误码返回“未知错误”，其他语言见 DescIn
 func (c CommonErrorCode) Desc() string {
-	return errorCodeDescription[c]
+	return c.DescIn(LocaleZhCN)
 }
 
 func (c CommonErrorCode) String() string {
-	return fmt.Sprintf("[%d] %s", c, errorCodeDescription[c])
+	return fmt.Sprintf("[%d] %s", c, c.Desc())
+}
+
+func (c CommonErrorCode) Error() string {
+	return c.String()
 }
 
 // CommonError 公共错误
@@ -23,3 +73,49 @@ type CommonError struct {
 func (e CommonError) Error() string {
 	return fmt.Sprintf("%s: %s, request_id=%s", e.Code, e.Message, e.RequestID)
 }
+
+// Is 使 errors.Is 可以通过错误码匹配，target 可以是 CommonErrorCode 哨兵或者另一个 CommonError
+func (e CommonError) Is(target error) bool {
+	switch t := target.(type) {
+	case CommonErrorCode:
+		return e.Code == t
+	case CommonError:
+		return e.Code == t.Code
+	case *CommonError:
+		return t != nil && e.Code == t.Code
+	}
+	return false
+}
+
+// httpErrorBodyLimit HTTPError 中保留的响应体最大字节数
+const httpErrorBodyLimit = 512
+
+// HTTPError API 请求返回了非 200 的 HTTP 状态码
+type HTTPError struct {
+	// StatusCode HTTP 状态码
+	StatusCode int
+	// Path 请求的 API 路径，例如 /v2/app/start
+	Path string
+	// Body 响应体的开头部分，最多 512 字节
+	Body string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("http response is not ok: status code %d, path=%s, body=%q", e.StatusCode, e.Path, e.Body)
+}
+
+// newHTTPError 创建 HTTPError，body 超过 httpErrorBodyLimit 时截断，并去掉末尾被截断的多字节字符
+func newHTTPError(statusCode int, path string, body []byte) *HTTPError {
+	if len(body) > httpErrorBodyLimit {
+		body = body[:httpErrorBodyLimit]
+	}
+	if len(body) == httpErrorBodyLimit {
+		for i := 0; i < utf8.UTFMax-1 && len(body) > 0; i++ {
+			if r, size := utf8.DecodeLastRune(body); r != utf8.RuneError || size != 1 {
+				break
+			}
+			body = body[:len(body)-1]
+		}
+	}
+	return &HTTPError{StatusCode: statusCode, Path: path, Body: string(body)}
+}
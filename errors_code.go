@@ -67,3 +67,38 @@ var errorCodeDescription = map[CommonErrorCode]string{
 	// 确认项目ID是否正确
 	8002: "项目无权限访问",
 }
+
+var errorCodeHint = map[CommonErrorCode]string{
+	4000: "请检查必填参数，参数大小限制",
+	4001: "请检查header的x-bili-accesskeyid是否为空，或者有效",
+	4002: "请检查header的Authorization",
+	4003: "请检查header的x-bili-timestamp",
+	4004: "请检查header的x-bili-nonce",
+	4005: "请检查header的x-bili-signature-method",
+	4006: "请检查header的x-bili-version",
+	4007: "请确认请求服务器是否在报备的白名单内",
+	4008: "请确认接口权限",
+	4009: "请确认接口权限及请求频率",
+	4010: "请确认请求接口url",
+	4011: "请检查header的Content-Type",
+	4012: "请检查header的x-bili-content-md5",
+	4013: "请检查header的Accept",
+	5000: "请联系B站对接同学",
+	5001: "请求超时",
+	5002: "请联系B站对接同学",
+	5003: "请联系B站对接同学",
+	5004: "请联系B站对接同学",
+	5005: "请联系B站对接同学",
+	6000: "验证码校验失败",
+	6001: "检查手机号码",
+	6002: "验证码超过规定有效期",
+	6003: "检查获取验证码的频率",
+	7000: "当前房间未进行互动游戏",
+	7001: "上个游戏正在结算中，建议10秒后进行重试",
+	7002: "当前房间正在进行游戏,无法开启下一局互动游戏",
+	7003: "当前game_id错误或互动游戏已关闭",
+	7004: "批量心跳单次最大值为200",
+	7005: "批量心跳game_id存在重复,请检查参数",
+	7007: "请检查身份码是否正确",
+	8002: "确认项目ID是否正确",
+}
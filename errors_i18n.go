@@ -0,0 +1,207 @@
+package biliopen
+
+// Locale 错误描述和处理建议使用的语言
+type Locale string
+
+const (
+	// LocaleZhCN 简体中文，即官方文档原文
+	LocaleZhCN Locale = "zh-CN"
+	// LocaleEnUS 英文
+	LocaleEnUS Locale = "en-US"
+)
+
+// ErrorCategory 公共错误码的分类，便于告警和界面按类别处理
+type ErrorCategory int
+
+const (
+	// ErrorCategoryUnknown 未知错误码
+	ErrorCategoryUnknown ErrorCategory = iota
+	// ErrorCategoryRequest 请求参数或接口地址错误
+	ErrorCategoryRequest
+	// ErrorCategoryAuth 应用鉴权、签名和请求头校验失败
+	ErrorCategoryAuth
+	// ErrorCategoryRateLimit 请求频率受限
+	ErrorCategoryRateLimit
+	// ErrorCategoryServer 服务端异常或配置问题，通常需要联系 B 站处理
+	ErrorCategoryServer
+	// ErrorCategoryGameState 互动玩法的状态不符合预期
+	ErrorCategoryGameState
+	// ErrorCategoryIdentity 身份码、验证码等身份校验失败
+	ErrorCategoryIdentity
+)
+
+func (c ErrorCategory) String() string {
+	switch c {
+	case ErrorCategoryRequest:
+		return "request"
+	case ErrorCategoryAuth:
+		return "auth"
+	case ErrorCategoryRateLimit:
+		return "rate_limit"
+	case ErrorCategoryServer:
+		return "server"
+	case ErrorCategoryGameState:
+		return "game_state"
+	case ErrorCategoryIdentity:
+		return "identity"
+	default:
+		return "unknown"
+	}
+}
+
+// 未知错误码的兜底文案
+const (
+	unknownErrorDesc   = "未知错误"
+	unknownErrorHint   = "请查阅开放平台文档或联系B站对接同学"
+	unknownErrorDescEn = "unknown error"
+	unknownErrorHintEn = "check the open platform documentation or contact Bilibili support"
+)
+
+var errorCodeCategory = map[CommonErrorCode]ErrorCategory{
+	4000: ErrorCategoryRequest,
+	4001: ErrorCategoryAuth,
+	4002: ErrorCategoryAuth,
+	4003: ErrorCategoryAuth,
+	4004: ErrorCategoryAuth,
+	4005: ErrorCategoryAuth,
+	4006: ErrorCategoryAuth,
+	4007: ErrorCategoryAuth,
+	4008: ErrorCategoryAuth,
+	4009: ErrorCategoryRateLimit,
+	4010: ErrorCategoryRequest,
+	4011: ErrorCategoryAuth,
+	4012: ErrorCategoryAuth,
+	4013: ErrorCategoryAuth,
+	5000: ErrorCategoryServer,
+	5001: ErrorCategoryServer,
+	5002: ErrorCategoryServer,
+	5003: ErrorCategoryServer,
+	5004: ErrorCategoryServer,
+	5005: ErrorCategoryServer,
+	6000: ErrorCategoryIdentity,
+	6001: ErrorCategoryIdentity,
+	6002: ErrorCategoryIdentity,
+	6003: ErrorCategoryRateLimit,
+	7000: ErrorCategoryGameState,
+	7001: ErrorCategoryGameState,
+	7002: ErrorCategoryGameState,
+	7003: ErrorCategoryGameState,
+	7004: ErrorCategoryGameState,
+	7005: ErrorCategoryGameState,
+	7007: ErrorCategoryIdentity,
+	8002: ErrorCategoryAuth,
+}
+
+var errorCodeDescriptionEn = map[CommonErrorCode]string{
+	4000: "invalid parameters",
+	4001: "invalid app",
+	4002: "invalid signature",
+	4003: "request expired",
+	4004: "duplicate request",
+	4005: "invalid signature method",
+	4006: "invalid signature version",
+	4007: "IP not in whitelist",
+	4008: "permission denied",
+	4009: "API access limited",
+	4010: "API not found",
+	4011: "Content-Type is not application/json",
+	4012: "Content-MD5 mismatch",
+	4013: "Accept is not application/json",
+	5000: "service unavailable",
+	5001: "request timeout",
+	5002: "internal error",
+	5003: "configuration error",
+	5004: "room not in whitelist",
+	5005: "room in blacklist",
+	6000: "invalid verification code",
+	6001: "invalid phone number",
+	6002: "verification code expired",
+	6003: "verification code requested too frequently",
+	7000: "not in game",
+	7001: "game cooling down",
+	7002: "game already running in room",
+	7003: "heartbeat expired",
+	7004: "too many game ids in batch heartbeat",
+	7005: "duplicate game ids in batch heartbeat",
+	7007: "invalid live code",
+	8002: "no permission for project",
+}
+
+var errorCodeHintEn = map[CommonErrorCode]string{
+	4000: "check required parameters and their size limits",
+	4001: "check that the x-bili-accesskeyid header is present and valid",
+	4002: "check the Authorization header",
+	4003: "check the x-bili-timestamp header",
+	4004: "check the x-bili-nonce header",
+	4005: "check the x-bili-signature-method header",
+	4006: "check the x-bili-version header",
+	4007: "make sure the server IP is in the registered whitelist",
+	4008: "check the API permissions of the app",
+	4009: "check the API permissions and request frequency",
+	4010: "check the API url",
+	4011: "check the Content-Type header",
+	4012: "check the x-bili-content-md5 header",
+	4013: "check the Accept header",
+	5000: "contact Bilibili support",
+	5001: "request timed out",
+	5002: "contact Bilibili support",
+	5003: "contact Bilibili support",
+	5004: "contact Bilibili support",
+	5005: "contact Bilibili support",
+	6000: "verification code check failed",
+	6001: "check the phone number",
+	6002: "the verification code has expired",
+	6003: "check how often verification codes are requested",
+	7000: "the room is not running an interactive game",
+	7001: "the previous game is still settling, retry in about 10 seconds",
+	7002: "the room is already running a game, the next one cannot be started",
+	7003: "the game_id is wrong or the game has been closed",
+	7004: "a batch heartbeat accepts at most 200 game ids",
+	7005: "the batch heartbeat contains duplicate game ids, check the parameters",
+	7007: "check that the live code is correct",
+	8002: "check that the project ID is correct",
+}
+
+// Known 检查错误码是否为官方文档中列出的公共错误码
+func (c CommonErrorCode) Known() bool {
+	_, ok := errorCodeDescription[c]
+	return ok
+}
+
+// Category 错误码分类，未知错误码返回 ErrorCategoryUnknown
+func (c CommonErrorCode) Category() ErrorCategory {
+	return errorCodeCategory[c]
+}
+
+// Hint 官方文档中给出的处理建议
+func (c CommonErrorCode) Hint() string {
+	return c.HintIn(LocaleZhCN)
+}
+
+// DescIn 指定语言的错误描述，不支持的语言使用中文
+func (c CommonErrorCode) DescIn(locale Locale) string {
+	if locale == LocaleEnUS {
+		if desc, ok := errorCodeDescriptionEn[c]; ok {
+			return desc
+		}
+		return unknownErrorDescEn
+	}
+	if desc, ok := errorCodeDescription[c]; ok {
+		return desc
+	}
+	return unknownErrorDesc
+}
+
+// HintIn 指定语言的处理建议，不支持的语言使用中文
+func (c CommonErrorCode) HintIn(locale Locale) string {
+	if locale == LocaleEnUS {
+		if hint, ok := errorCodeHintEn[c]; ok {
+			return hint
+		}
+		return unknownErrorHintEn
+	}
+	if hint, ok := errorCodeHint[c]; ok {
+		return hint
+	}
+	return unknownErrorHint
+}
@@ -0,0 +1,72 @@
+package biliopen
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestCommonErrorIs(t *testing.T) {
+	rsp := CommonResponse[any]{Code: 7007, Message: "invalid code", RequestID: "req"}
+	err := fmt.Errorf("start app fail: %w", rsp.Err())
+	if !errors.Is(err, ErrInvalidLiveCode) {
+		t.Fatalf("expect %v to match ErrInvalidLiveCode", err)
+	}
+	if errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expect %v not to match ErrInvalidSignature", err)
+	}
+	if !errors.Is(err, CommonError{Code: ErrInvalidLiveCode}) {
+		t.Fatalf("expect %v to match CommonError with the same code", err)
+	}
+	var ce CommonError
+	if !errors.As(err, &ce) || ce.RequestID != "req" {
+		t.Fatalf("expect CommonError with request id, got %v", ce)
+	}
+}
+
+func TestNewHTTPError(t *testing.T) {
+	body := strings.Repeat("a", httpErrorBodyLimit-1) + "错误"
+	err := newHTTPError(502, "/v2/app/start", []byte(body)[:httpErrorBodyLimit])
+	if err.Body != strings.Repeat("a", httpErrorBodyLimit-1) {
+		t.Fatalf("expect truncated rune to be dropped, got %q", err.Body[len(err.Body)-4:])
+	}
+	var he *HTTPError
+	if !errors.As(fmt.Errorf("wrap: %w", err), &he) || he.StatusCode != 502 || he.Path != "/v2/app/start" {
+		t.Fatalf("unexpected http error %v", he)
+	}
+}
+
+func TestCommonErrorCodeLocale(t *testing.T) {
+	if got := ErrRequestExpired.Hint(); got != "请检查header的x-bili-timestamp" {
+		t.Fatalf("unexpected hint %q", got)
+	}
+	if got := ErrRequestExpired.DescIn(LocaleEnUS); got != "request expired" {
+		t.Fatalf("unexpected english desc %q", got)
+	}
+	if ErrRateLimited.Category() != ErrorCategoryRateLimit || ErrInvalidLiveCode.Category() != ErrorCategoryIdentity {
+		t.Fatal("unexpected category")
+	}
+	for code := range errorCodeDescription {
+		if _, ok := errorCodeDescriptionEn[code]; !ok {
+			t.Errorf("missing english desc for %d", code)
+		}
+		if _, ok := errorCodeHintEn[code]; !ok {
+			t.Errorf("missing english hint for %d", code)
+		}
+		if code.Category() == ErrorCategoryUnknown {
+			t.Errorf("missing category for %d", code)
+		}
+	}
+
+	unknown := CommonErrorCode(1234)
+	if unknown.Known() || unknown.Category() != ErrorCategoryUnknown {
+		t.Fatal("expect unknown code")
+	}
+	if got := unknown.String(); got != "[1234] 未知错误" {
+		t.Fatalf("unexpected string %q", got)
+	}
+	if unknown.HintIn(LocaleEnUS) == "" {
+		t.Fatal("expect fallback hint for unknown code")
+	}
+}
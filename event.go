@@ -0,0 +1,111 @@
+package biliopen
+
+import (
+	"fmt"
+	"reflect"
+
+	"go.uber.org/zap"
+)
+
+// handleCmd 根据 cmd 将长连消息反序列化为对应的模型并触发回调，data 只在调用期间有效
+func (c *LiveClient) handleCmd(cmd string, data []byte) (err error) {
+	if !c.DisableRecover {
+		defer func() {
+			if r := recover(); r != nil {
+				c.logger().Error("handle cmd panic", zap.String("cmd", cmd),
+					zap.Any("panic", r), zap.Stack("stack"))
+				err = fmt.Errorf("handle %s panic: %v", cmd, r)
+			}
+		}()
+	}
+	if c.Dedup != nil {
+		if msgID, ok := lookupJSONString(data, "msg_id"); ok {
+			id := string(msgID)
+			if c.Dedup.Duplicate(cmd, id) {
+				c.logger().Debug("duplicate message suppressed", zap.String("cmd", cmd), zap.String("msg_id", id))
+				return nil
+			}
+			// 分发失败或 panic 时撤销记录，服务端重新推送时可以再次处理
+			completed := false
+			defer func() {
+				if !completed || err != nil {
+					c.Dedup.Forget(id)
+				}
+			}()
+			err = c.dispatchCmd(cmd, data)
+			completed = true
+			return err
+		}
+	}
+	return c.dispatchCmd(cmd, data)
+}
+
+// dispatchCmd 按 cmd 分发消息
+func (c *LiveClient) dispatchCmd(cmd string, data []byte) error {
+	switch cmd {
+	case CmdLiveOpenPlatformDm:
+		return decodeEvent(c, cmd, data, c.OnDanmaku)
+	case CmdLiveOpenPlatformSendGift:
+		return decodeEvent(c, cmd, data, c.OnGift)
+	case CmdLiveOpenPlatformSuperChat:
+		return decodeEvent(c, cmd, data, c.OnSuperChat)
+	case CmdLiveOpenPlatformSuperChatDel:
+		return decodeEvent(c, cmd, data, c.OnSuperChatDel)
+	case CmdLiveOpenPlatformGuard:
+		return decodeEvent(c, cmd, data, c.OnGuard)
+	case CmdLiveOpenPlatformLike:
+		return decodeEvent(c, cmd, data, c.OnLike)
+	default:
+		c.logger().Warn("unsupported cmd", zap.String("cmd", cmd), zap.ByteString("data", data))
+		return nil
+	}
+}
+
+// decodeEvent 反序列化消息并经过中间件链触发回调和路由，没有设置回调、中间件和路由时跳过反序列化
+func decodeEvent[T any](c *LiveClient, cmd string, data []byte, callback func(T)) error {
+	if c.StrictSchema {
+		c.checkSchema(cmd, data, reflect.TypeOf((*T)(nil)).Elem())
+	}
+	chain := c.eventChain.Load()
+	hasRoutes := c.routes.Load() != nil
+	if callback == nil && chain == nil && !hasRoutes {
+		return nil
+	}
+	var event T
+	if err := c.getCodec().Unmarshal(data, &event); err != nil {
+		return fmt.Errorf("unmarshal %T fail: %w", event, err)
+	}
+	if c.Identities != nil {
+		c.Identities.resolveEvent(&event)
+	}
+	if chain != nil {
+		return (*chain)(Event{Cmd: cmd, Data: event})
+	}
+	if hasRoutes {
+		return c.callEventCallback(Event{Cmd: cmd, Data: event})
+	}
+	callback(event)
+	return nil
+}
+
+// checkSchema 严格模式下检查消息字段和模型是否一致，新发现的差异通过 OnSchemaDrift 上报
+func (c *LiveClient) checkSchema(cmd string, data []byte, model reflect.Type) {
+	var unknown, missing []string
+	if err := schemaOf(model).diff(c.getCodec(), data, "", &unknown, &missing); err != nil {
+		c.logger().Warn("check schema fail", zap.String("cmd", cmd), zap.Error(err))
+		return
+	}
+	if len(unknown) == 0 && len(missing) == 0 {
+		return
+	}
+	unknown, missing = c.schemaDrift.filter(cmd, unknown, missing)
+	if len(unknown) == 0 && len(missing) == 0 {
+		return
+	}
+	if c.OnSchemaDrift != nil {
+		c.OnSchemaDrift(cmd, unknown, missing)
+		return
+	}
+	c.logger().Warn("schema drift detected", zap.String("cmd", cmd),
+		zap.Strings("unknown", unknown), zap.Strings("missing", missing))
+}
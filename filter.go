@@ -0,0 +1,342 @@
+package biliopen
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// cmdAliases cmd 的简写
+var cmdAliases = map[string]string{
+	"dm":     CmdLiveOpenPlatformDm,
+	"gift":   CmdLiveOpenPlatformSendGift,
+	"sc":     CmdLiveOpenPlatformSuperChat,
+	"sc_del": CmdLiveOpenPlatformSuperChatDel,
+	"guard":  CmdLiveOpenPlatformGuard,
+	"like":   CmdLiveOpenPlatformLike,
+}
+
+// ResolveCmd 将 dm、gift、sc、sc_del、guard、like 等简写或者完整的 cmd 转换为 cmd 常量，不支持的 cmd 返回 false
+func ResolveCmd(name string) (string, bool) {
+	if cmd, ok := cmdAliases[strings.ToLower(name)]; ok {
+		return cmd, true
+	}
+	upper := strings.ToUpper(name)
+	for _, cmd := range cmdAliases {
+		if cmd == upper {
+			return cmd, true
+		}
+	}
+	return "", false
+}
+
+// FilterSpec 声明式的事件过滤条件，可以写在 YAML 或 JSON 配置中，通过 Predicate 编译为 Predicate
+//
+// 所有设置了的条件都需要满足。在 YAML 和 JSON 中也可以直接写成 ParseFilter 支持的文本形式，例如：
+//
+//	filter: "cmd=dm dm_type=text medal>=10 msg~^!"
+type FilterSpec struct {
+	// Cmd 事件类型，支持 ResolveCmd 的简写
+	Cmd []string `json:"cmd,omitempty" yaml:"cmd,omitempty"`
+	// DMType 弹幕类型，text、sticker、voice 或者数字
+	DMType []string `json:"dm_type,omitempty" yaml:"dm_type,omitempty"`
+	// MedalLevelMin 粉丝勋章等级下限
+	MedalLevelMin int `json:"medal_level_min,omitempty" yaml:"medal_level_min,omitempty"`
+	// WearingMedal 是否佩戴当前主播的粉丝勋章
+	WearingMedal *bool `json:"wearing_medal,omitempty" yaml:"wearing_medal,omitempty"`
+	// Admin 是否房管
+	Admin *bool `json:"admin,omitempty" yaml:"admin,omitempty"`
+	// GuardMin 大航海等级下限，captain、admiral、governor、舰长、提督、总督或者数字
+	GuardMin string `json:"guard_min,omitempty" yaml:"guard_min,omitempty"`
+	// ValueMin 付费价值下限，1000 = 1 元，见 EventValue
+	ValueMin int64 `json:"value_min,omitempty" yaml:"value_min,omitempty"`
+	// Message 弹幕或醒目留言内容的正则表达式
+	Message string `json:"message,omitempty" yaml:"message,omitempty"`
+	// Users 用户白名单，Identity、OpenID 或者 UID
+	Users []string `json:"users,omitempty" yaml:"users,omitempty"`
+	// ExcludeUsers 用户黑名单
+	ExcludeUsers []string `json:"exclude_users,omitempty" yaml:"exclude_users,omitempty"`
+	// Any 任一子条件满足
+	Any []FilterSpec `json:"any,omitempty" yaml:"any,omitempty"`
+	// Not 子条件不满足
+	Not *FilterSpec `json:"not,omitempty" yaml:"not,omitempty"`
+}
+
+// filterSpecFields 避免 UnmarshalJSON 和 UnmarshalYAML 递归调用
+type filterSpecFields FilterSpec
+
+func (s *FilterSpec) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var text string
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+		return s.parse(text)
+	}
+	return json.Unmarshal(data, (*filterSpecFields)(s))
+}
+
+func (s *FilterSpec) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return s.parse(node.Value)
+	}
+	return node.Decode((*filterSpecFields)(s))
+}
+
+func (s *FilterSpec) parse(text string) error {
+	spec, err := ParseFilter(text)
+	if err != nil {
+		return err
+	}
+	*s = spec
+	return nil
+}
+
+// ParseFilter 解析文本形式的过滤条件，条件之间以空格分隔，需要全部满足，支持：
+//
+//	cmd=dm,gift         事件类型
+//	dm_type=text        弹幕类型
+//	medal>=10           粉丝勋章等级下限
+//	wearing / !wearing  是否佩戴粉丝勋章
+//	admin / !admin      是否房管
+//	guard>=captain      大航海等级下限
+//	value>=1000         付费价值下限
+//	msg~^!              内容正则，包含空格时用双引号包裹，例如 msg~"^!roll \d+"，引号内的双引号写作 \"
+//	user=a,b            用户白名单
+//	user!=a,b           用户黑名单
+func ParseFilter(text string) (FilterSpec, error) {
+	var spec FilterSpec
+	terms, err := splitFilterTerms(text)
+	if err != nil {
+		return spec, err
+	}
+	for _, term := range terms {
+		if err = spec.parseTerm(term); err != nil {
+			return spec, fmt.Errorf("invalid filter term %q: %w", term, err)
+		}
+	}
+	return spec, nil
+}
+
+// CompileFilter 解析文本形式的过滤条件并编译为 Predicate
+func CompileFilter(text string) (Predicate, error) {
+	spec, err := ParseFilter(text)
+	if err != nil {
+		return nil, err
+	}
+	return spec.Predicate()
+}
+
+func (s *FilterSpec) parseTerm(term string) error {
+	t := true
+	f := false
+	switch term {
+	case "wearing":
+		s.WearingMedal = &t
+		return nil
+	case "!wearing":
+		s.WearingMedal = &f
+		return nil
+	case "admin":
+		s.Admin = &t
+		return nil
+	case "!admin":
+		s.Admin = &f
+		return nil
+	}
+	// 先匹配较长的运算符
+	for _, op := range []string{">=", "!=", "=", "~"} {
+		key, value, ok := strings.Cut(term, op)
+		if !ok || key == "" || strings.ContainsAny(key, "!=~><") {
+			continue
+		}
+		return s.setTerm(key, op, value)
+	}
+	return fmt.Errorf("unknown term")
+}
+
+func (s *FilterSpec) setTerm(key, op, value string) (err error) {
+	list := func() []string {
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return items
+	}
+	switch key + op {
+	case "cmd=":
+		s.Cmd = append(s.Cmd, list()...)
+	case "dm_type=":
+		s.DMType = append(s.DMType, list()...)
+	case "medal>=":
+		s.MedalLevelMin, err = strconv.Atoi(value)
+	case "guard>=":
+		s.GuardMin = value
+	case "value>=":
+		s.ValueMin, err = strconv.ParseInt(value, 10, 64)
+	case "msg~":
+		if strings.HasPrefix(value, `"`) {
+			// 引号中只转义 \"，其余反斜杠原样保留给正则表达式
+			if len(value) < 2 || !strings.HasSuffix(value, `"`) {
+				return fmt.Errorf("unterminated quote")
+			}
+			value = strings.ReplaceAll(value[1:len(value)-1], `\"`, `"`)
+		}
+		s.Message = value
+	case "user=":
+		s.Users = append(s.Users, list()...)
+	case "user!=":
+		s.ExcludeUsers = append(s.ExcludeUsers, list()...)
+	default:
+		return fmt.Errorf("unknown term")
+	}
+	return err
+}
+
+// splitFilterTerms 以空白字符分隔条件，双引号中的空白字符不分隔
+func splitFilterTerms(text string) ([]string, error) {
+	var terms []string
+	var cur strings.Builder
+	inQuote, escaped := false, false
+	for _, r := range text {
+		switch {
+		case escaped:
+			escaped = false
+		case inQuote && r == '\\':
+			escaped = true
+		case r == '"':
+			inQuote = !inQuote
+		case !inQuote && (r == ' ' || r == '\t' || r == '\n'):
+			if cur.Len() > 0 {
+				terms = append(terms, cur.String())
+				cur.Reset()
+			}
+			continue
+		}
+		cur.WriteRune(r)
+	}
+	if inQuote {
+		return nil, fmt.Errorf("unterminated quote in filter %q", text)
+	}
+	if cur.Len() > 0 {
+		terms = append(terms, cur.String())
+	}
+	return terms, nil
+}
+
+// Predicate 编译为 Predicate，没有设置任何条件时匹配所有事件
+func (s FilterSpec) Predicate() (Predicate, error) {
+	var ps []Predicate
+	if len(s.Cmd) > 0 {
+		cmds := make([]string, len(s.Cmd))
+		for i, name := range s.Cmd {
+			cmd, ok := ResolveCmd(name)
+			if !ok {
+				return nil, fmt.Errorf("unknown cmd %q", name)
+			}
+			cmds[i] = cmd
+		}
+		ps = append(ps, IsCmd(cmds...))
+	}
+	if len(s.DMType) > 0 {
+		types := make([]DanmakuType, len(s.DMType))
+		for i, name := range s.DMType {
+			t, err := parseDanmakuType(name)
+			if err != nil {
+				return nil, err
+			}
+			types[i] = t
+		}
+		ps = append(ps, DanmakuTypeIs(types...))
+	}
+	if s.MedalLevelMin > 0 {
+		ps = append(ps, MedalLevelAtLeast(s.MedalLevelMin))
+	}
+	if s.WearingMedal != nil {
+		ps = append(ps, boolPredicate(WearingMedal(), *s.WearingMedal))
+	}
+	if s.Admin != nil {
+		ps = append(ps, boolPredicate(IsAdmin(), *s.Admin))
+	}
+	if s.GuardMin != "" {
+		level, err := parseGuardLevel(s.GuardMin)
+		if err != nil {
+			return nil, err
+		}
+		ps = append(ps, GuardAtLeast(level))
+	}
+	if s.ValueMin > 0 {
+		ps = append(ps, ValueAtLeast(s.ValueMin))
+	}
+	if s.Message != "" {
+		re, err := regexp.Compile(s.Message)
+		if err != nil {
+			return nil, fmt.Errorf("invalid message regexp: %w", err)
+		}
+		ps = append(ps, MessageMatches(re))
+	}
+	if len(s.Users) > 0 {
+		ps = append(ps, UserIn(s.Users...))
+	}
+	if len(s.ExcludeUsers) > 0 {
+		ps = append(ps, UserNotIn(s.ExcludeUsers...))
+	}
+	if len(s.Any) > 0 {
+		anyOf := make([]Predicate, len(s.Any))
+		for i, sub := range s.Any {
+			p, err := sub.Predicate()
+			if err != nil {
+				return nil, fmt.Errorf("any[%d]: %w", i, err)
+			}
+			anyOf[i] = p
+		}
+		ps = append(ps, Or(anyOf...))
+	}
+	if s.Not != nil {
+		p, err := s.Not.Predicate()
+		if err != nil {
+			return nil, fmt.Errorf("not: %w", err)
+		}
+		ps = append(ps, Not(p))
+	}
+	return And(ps...), nil
+}
+
+func boolPredicate(p Predicate, want bool) Predicate {
+	if want {
+		return p
+	}
+	return Not(p)
+}
+
+func parseDanmakuType(name string) (DanmakuType, error) {
+	switch strings.ToLower(name) {
+	case "text", "0":
+		return DanmakuTypeText, nil
+	case "sticker", "emoji", "1":
+		return DanmakuTypeSticker, nil
+	case "voice", "2":
+		return DanmakuTypeVoice, nil
+	default:
+		return 0, fmt.Errorf("unknown danmaku type %q", name)
+	}
+}
+
+func parseGuardLevel(name string) (GuardLevel, error) {
+	switch strings.ToLower(name) {
+	case "governor", "总督", "1":
+		return GuardLevelGovernor, nil
+	case "admiral", "提督", "2":
+		return GuardLevelAdmiral, nil
+	case "captain", "舰长", "3":
+		return GuardLevelCaptain, nil
+	default:
+		return 0, fmt.Errorf("unknown guard level %q", name)
+	}
+}
@@ -5,6 +5,7 @@ go 1.20
 require (
 	github.com/json-iterator/go v1.1.12
 	go.uber.org/zap v1.24.0
+	gopkg.in/yaml.v3 v3.0.1
 	nhooyr.io/websocket v1.8.7
 )
 
@@ -14,4 +15,5 @@ require (
 	github.com/modern-go/reflect2 v1.0.2 // indirect
 	go.uber.org/atomic v1.7.0 // indirect
 	go.uber.org/multierr v1.6.0 // indirect
+	golang.org/x/sys v0.22.0 // indirect
 )
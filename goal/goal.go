@@ -0,0 +1,393 @@
+// Package goal 直播间礼物目标
+//
+// 礼物、醒目留言和大航海统一换算为付费价值（1000 = 1 元 = 10 电池，见 biliopen.EventValue），
+// 也可以按大航海数量或礼物数量统计，多个目标同时累计进度，设置 Path 后进度会持久化到文件：
+//
+//	t := &goal.Tracker{Path: "goals.json", OnProgress: func(p goal.Progress) { overlay.Push(p) }}
+//	if err := t.Load(); err != nil { ... }
+//	_ = t.Add(goal.Goal{ID: "cos", Title: "女装直播", Metric: goal.MetricValue, Target: goal.Batteries(1000)})
+//	_ = t.Add(goal.Goal{ID: "guards", Title: "本月 50 舰", Metric: goal.MetricGuards, Target: 50})
+//	t.Attach(client)
+package goal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	biliopen "github.com/fython/bili-open-live-go"
+	"github.com/fython/bili-open-live-go/internal/atomicfile"
+)
+
+const (
+	// ValuePerYuan 1 元对应的价值
+	ValuePerYuan = 1000
+	// ValuePerBattery 1 电池对应的价值
+	ValuePerBattery = 100
+)
+
+// Yuan 将元换算为价值
+func Yuan(n int64) int64 {
+	return n * ValuePerYuan
+}
+
+// Batteries 将电池换算为价值
+func Batteries(n int64) int64 {
+	return n * ValuePerBattery
+}
+
+// Metric 目标的统计方式
+type Metric string
+
+const (
+	// MetricValue 付费价值，包括付费礼物、醒目留言和大航海，计算方式见 biliopen.EventValue
+	MetricValue Metric = "value"
+	// MetricGuards 大航海数量，按 GuardNum 累计
+	MetricGuards Metric = "guards"
+	// MetricGifts 礼物数量，按 GiftNum 累计，包括免费礼物
+	MetricGifts Metric = "gifts"
+)
+
+// Goal 目标
+type Goal struct {
+	// ID 目标唯一标识
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	// Metric 统计方式，默认为 MetricValue
+	Metric Metric `json:"metric,omitempty"`
+	// Target 目标值，单位由 Metric 决定
+	Target int64 `json:"target"`
+	// GiftNames 只统计这些礼物，为空时统计所有礼物，对 MetricValue 设置时醒目留言和大航海不再计入
+	GiftNames []string `json:"gift_names,omitempty"`
+	// MinGuardLevel 只统计不低于该等级的大航海，为 GuardLevelNone 时不限制
+	MinGuardLevel biliopen.GuardLevel `json:"min_guard_level,omitempty"`
+	// Until 截止时间，之后的事件不再计入，为零值时不限制
+	Until time.Time `json:"until"`
+
+	// Current 当前进度，达成后继续累计
+	Current int64 `json:"current"`
+	// CompletedAt 达成时间，没有达成时为零值
+	CompletedAt time.Time `json:"completed_at"`
+}
+
+// Completed 是否已经达成
+func (g Goal) Completed() bool {
+	return !g.CompletedAt.IsZero()
+}
+
+// Percent 完成百分比，达成后可能超过 100
+func (g Goal) Percent() float64 {
+	if g.Target <= 0 {
+		return 0
+	}
+	return float64(g.Current) / float64(g.Target) * 100
+}
+
+// Progress 进度事件
+type Progress struct {
+	Goal Goal `json:"goal"`
+	// Delta 本次增加的进度
+	Delta int64 `json:"delta"`
+	// User 贡献者，手动调整时为空
+	User biliopen.UserInfo `json:"user"`
+	// Cmd 触发进度变化的事件类型，手动调整时为空
+	Cmd string `json:"cmd,omitempty"`
+}
+
+// amount 事件对目标的贡献值
+func (g Goal) amount(e biliopen.Event, now time.Time) int64 {
+	if !g.Until.IsZero() && now.After(g.Until) {
+		return 0
+	}
+	switch g.Metric {
+	case MetricGuards:
+		guard, ok := e.Data.(biliopen.Guard)
+		if !ok || (g.MinGuardLevel != biliopen.GuardLevelNone && !guard.GuardLevel.AtLeast(g.MinGuardLevel)) {
+			return 0
+		}
+		if guard.GuardNum <= 0 {
+			return 1
+		}
+		return int64(guard.GuardNum)
+	case MetricGifts:
+		gift, ok := e.Data.(biliopen.Gift)
+		if !ok || !g.matchGift(gift) {
+			return 0
+		}
+		return int64(gift.GiftNum)
+	default:
+		switch data := e.Data.(type) {
+		case biliopen.Gift:
+			if !g.matchGift(data) {
+				return 0
+			}
+		case biliopen.Guard:
+			if len(g.GiftNames) > 0 ||
+				(g.MinGuardLevel != biliopen.GuardLevelNone && !data.GuardLevel.AtLeast(g.MinGuardLevel)) {
+				return 0
+			}
+		case biliopen.SuperChat:
+			if len(g.GiftNames) > 0 {
+				return 0
+			}
+		}
+		return biliopen.EventValue(e)
+	}
+}
+
+func (g Goal) matchGift(gift biliopen.Gift) bool {
+	if len(g.GiftNames) == 0 {
+		return true
+	}
+	for _, name := range g.GiftNames {
+		if strings.EqualFold(name, gift.GiftName) {
+			return true
+		}
+	}
+	return false
+}
+
+// Tracker 目标进度追踪，零值可以直接使用，并发安全
+type Tracker struct {
+	// Path 持久化文件路径，为空时不持久化
+	Path string
+	// OnProgress 目标进度变化时回调，在锁外调用
+	OnProgress func(p Progress)
+	// OnSaveError 持久化失败时回调，在持有锁时调用，不能再调用 Tracker 的方法，为空时输出警告日志，
+	// 返回 error 的方法同时会返回该错误，内存中的进度不会回滚
+	OnSaveError func(err error)
+	// OnCompleted 目标达成时回调，每个目标只回调一次，直到 Reset
+	OnCompleted func(p Progress)
+
+	mu    sync.Mutex
+	goals []*Goal
+	// dedup 过滤重连后重复推送的消息
+	dedup biliopen.Deduplicator
+
+	// now 测试时替换当前时间
+	now func() time.Time
+}
+
+func (t *Tracker) getNow() time.Time {
+	if t.now != nil {
+		return t.now()
+	}
+	return time.Now()
+}
+
+// Load 从 Path 恢复目标，文件不存在时不做任何操作
+func (t *Tracker) Load() error {
+	if t.Path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(t.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("read goals fail: %w", err)
+	}
+	var goals []*Goal
+	if err = json.Unmarshal(data, &goals); err != nil {
+		return fmt.Errorf("unmarshal goals fail: %w", err)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.goals = goals
+	return nil
+}
+
+// save 写入临时文件后重命名，失败时通过 OnSaveError 上报并返回错误，调用方需要持有锁
+func (t *Tracker) save() error {
+	if t.Path == "" {
+		return nil
+	}
+	data, err := json.Marshal(t.goals)
+	if err == nil {
+		err = atomicfile.WriteFile(t.Path, data)
+	}
+	if err != nil {
+		err = fmt.Errorf("save goals fail: %w", err)
+		if t.OnSaveError != nil {
+			t.OnSaveError(err)
+		} else {
+			zap.L().Warn("save goals fail", zap.String("path", t.Path), zap.Error(err))
+		}
+	}
+	return err
+}
+
+func (t *Tracker) find(id string) *Goal {
+	for _, g := range t.goals {
+		if g.ID == id {
+			return g
+		}
+	}
+	return nil
+}
+
+// Add 添加目标，ID 已经存在时返回错误
+func (t *Tracker) Add(g Goal) error {
+	if g.ID == "" || g.Target <= 0 {
+		return fmt.Errorf("goal id and target are required")
+	}
+	if g.Metric == "" {
+		g.Metric = MetricValue
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.find(g.ID) != nil {
+		return fmt.Errorf("goal %q already exists", g.ID)
+	}
+	t.goals = append(t.goals, &g)
+	return t.save()
+}
+
+// Remove 移除目标，不存在时返回 false
+func (t *Tracker) Remove(id string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, g := range t.goals {
+		if g.ID == id {
+			t.goals = append(t.goals[:i], t.goals[i+1:]...)
+			t.save()
+			return true
+		}
+	}
+	return false
+}
+
+// Reset 清空目标的进度和达成状态，不存在时返回 false
+func (t *Tracker) Reset(id string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	g := t.find(id)
+	if g == nil {
+		return false
+	}
+	g.Current = 0
+	g.CompletedAt = time.Time{}
+	t.save()
+	return true
+}
+
+// Get 获取目标
+func (t *Tracker) Get(id string) (Goal, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if g := t.find(id); g != nil {
+		return *g, true
+	}
+	return Goal{}, false
+}
+
+// Goals 所有目标，按添加顺序排列
+func (t *Tracker) Goals() []Goal {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	goals := make([]Goal, len(t.goals))
+	for i, g := range t.goals {
+		goals[i] = *g
+	}
+	return goals
+}
+
+// Adjust 手动调整目标进度，delta 可以为负数，进度不会小于 0，不存在时返回 false
+func (t *Tracker) Adjust(id string, delta int64) bool {
+	t.mu.Lock()
+	g := t.find(id)
+	if g == nil {
+		t.mu.Unlock()
+		return false
+	}
+	p, completed := t.add(g, delta, biliopen.UserInfo{}, "")
+	t.save()
+	t.mu.Unlock()
+	t.emit(p, completed)
+	return true
+}
+
+// add 增加进度并生成事件，调用方需要持有锁
+func (t *Tracker) add(g *Goal, delta int64, user biliopen.UserInfo, cmd string) (Progress, bool) {
+	g.Current += delta
+	if g.Current < 0 {
+		g.Current = 0
+	}
+	completed := false
+	if !g.Completed() && g.Current >= g.Target {
+		g.CompletedAt = t.getNow()
+		completed = true
+	}
+	return Progress{Goal: *g, Delta: delta, User: user, Cmd: cmd}, completed
+}
+
+func (t *Tracker) emit(p Progress, completed bool) {
+	if t.OnProgress != nil {
+		t.OnProgress(p)
+	}
+	if completed && t.OnCompleted != nil {
+		t.OnCompleted(p)
+	}
+}
+
+// Attach 注册礼物、醒目留言和大航海路由，返回的 RouteID 可以用于 RemoveRoute
+func (t *Tracker) Attach(c *biliopen.LiveClient) biliopen.RouteID {
+	return c.Route(biliopen.IsCmd(
+		biliopen.CmdLiveOpenPlatformSendGift,
+		biliopen.CmdLiveOpenPlatformSuperChat,
+		biliopen.CmdLiveOpenPlatformGuard,
+	), t.Handle)
+}
+
+// Handle 处理礼物、醒目留言和大航海事件，可以作为 biliopen.Handler 使用，重复推送的消息按 msg_id 只计一次
+func (t *Tracker) Handle(e biliopen.Event) error {
+	var msgID string
+	switch data := e.Data.(type) {
+	case biliopen.Gift:
+		msgID = data.MessageID
+	case biliopen.SuperChat:
+		msgID = data.MessageID
+	case biliopen.Guard:
+		msgID = data.MessageID
+	default:
+		return nil
+	}
+	user, _ := biliopen.EventUser(e)
+	now := t.getNow()
+	t.mu.Lock()
+	amounts := make([]int64, len(t.goals))
+	matched := false
+	for i, g := range t.goals {
+		amounts[i] = g.amount(e, now)
+		matched = matched || amounts[i] > 0
+	}
+	// 没有计入任何目标的消息不记录 msg_id，之后新增的目标仍然可以处理重新推送的消息
+	if !matched || t.dedup.Seen(msgID) {
+		t.mu.Unlock()
+		return nil
+	}
+	type change struct {
+		p         Progress
+		completed bool
+	}
+	var changes []change
+	for i, g := range t.goals {
+		if amounts[i] > 0 {
+			p, completed := t.add(g, amounts[i], user, e.Cmd)
+			changes = append(changes, change{p, completed})
+		}
+	}
+	// 进度已经计入内存，持久化失败时同样记录 msg_id，避免重新推送时重复计算
+	t.dedup.Duplicate(e.Cmd, msgID)
+	err := t.save()
+	t.mu.Unlock()
+	for _, c := range changes {
+		t.emit(c.p, c.completed)
+	}
+	return err
+}
@@ -0,0 +1,104 @@
+package goal
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	biliopen "github.com/fython/bili-open-live-go"
+)
+
+func TestTracker(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "goals.json")
+	now := time.Unix(1700000000, 0)
+	var progress, completed []Progress
+	tr := &Tracker{
+		Path:        path,
+		OnProgress:  func(p Progress) { progress = append(progress, p) },
+		OnCompleted: func(p Progress) { completed = append(completed, p) },
+		now:         func() time.Time { return now },
+	}
+	for _, g := range []Goal{
+		{ID: "value", Target: Batteries(1000)},
+		{ID: "guards", Metric: MetricGuards, Target: 3, MinGuardLevel: biliopen.GuardLevelAdmiral},
+		{ID: "flowers", Metric: MetricGifts, Target: 10, GiftNames: []string{"小花花"}, Until: now.Add(time.Minute)},
+	} {
+		if err := tr.Add(g); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if tr.Add(Goal{ID: "value", Target: 1}) == nil {
+		t.Fatal("expect duplicate goal error")
+	}
+
+	user := biliopen.UserInfo{UID: 1, Username: "a"}
+	events := []biliopen.Event{
+		{Cmd: biliopen.CmdLiveOpenPlatformSendGift, Data: biliopen.Gift{UserInfo: user, MessageID: "1", GiftName: "小花花", Price: 100, GiftNum: 5, Paid: true}},
+		{Cmd: biliopen.CmdLiveOpenPlatformSendGift, Data: biliopen.Gift{UserInfo: user, MessageID: "1", GiftName: "小花花", Price: 100, GiftNum: 5, Paid: true}},
+		{Cmd: biliopen.CmdLiveOpenPlatformSendGift, Data: biliopen.Gift{UserInfo: user, MessageID: "2", GiftName: "辣条", GiftNum: 100}},
+		{Cmd: biliopen.CmdLiveOpenPlatformSuperChat, Data: biliopen.SuperChat{UserInfo: user, MessageID: "3", RMB: 30}},
+		{Cmd: biliopen.CmdLiveOpenPlatformGuard, Data: biliopen.Guard{UserInfo: user, MessageID: "4", GuardLevel: biliopen.GuardLevelCaptain, GuardNum: 1, Price: 138000}},
+		{Cmd: biliopen.CmdLiveOpenPlatformGuard, Data: biliopen.Guard{UserInfo: user, MessageID: "5", GuardLevel: biliopen.GuardLevelAdmiral, GuardNum: 3, Price: 5994000}},
+	}
+	for _, e := range events {
+		_ = tr.Handle(e)
+	}
+	value, _ := tr.Get("value")
+	// 500 + 30000 + 138000 + 5994000
+	if value.Current != 6162500 || !value.Completed() {
+		t.Fatalf("unexpected value goal %+v", value)
+	}
+	guards, _ := tr.Get("guards")
+	if guards.Current != 3 || !guards.Completed() || guards.Percent() != 100 {
+		t.Fatalf("unexpected guards goal %+v", guards)
+	}
+	if len(completed) != 2 || completed[1].Goal.ID != "guards" || completed[1].User.Username != "a" {
+		t.Fatalf("unexpected completed events %+v", completed)
+	}
+
+	// 截止后不再计入
+	now = now.Add(time.Hour)
+	_ = tr.Handle(biliopen.Event{Cmd: biliopen.CmdLiveOpenPlatformSendGift, Data: biliopen.Gift{MessageID: "6", GiftName: "小花花", GiftNum: 5}})
+	if g, _ := tr.Get("flowers"); g.Current != 5 {
+		t.Fatalf("unexpected flowers goal %+v", g)
+	}
+
+	// 重启后恢复
+	tr2 := &Tracker{Path: path}
+	if err := tr2.Load(); err != nil {
+		t.Fatal(err)
+	}
+	goals := tr2.Goals()
+	if len(goals) != 3 || goals[0].Current != value.Current || !goals[1].Completed() {
+		t.Fatalf("unexpected restored goals %+v", goals)
+	}
+	tr2.Adjust("flowers", 5)
+	tr2.Reset("value")
+	tr2.Remove("guards")
+	if err := tr2.Load(); err != nil {
+		t.Fatal(err)
+	}
+	goals = tr2.Goals()
+	if len(goals) != 2 || goals[0].Current != 0 || goals[0].Completed() || !goals[1].Completed() {
+		t.Fatalf("unexpected goals %+v", goals)
+	}
+}
+
+func TestTrackerSaveError(t *testing.T) {
+	var saveErrs []error
+	tr := &Tracker{
+		Path:        filepath.Join(t.TempDir(), "missing", "goals.json"),
+		OnSaveError: func(err error) { saveErrs = append(saveErrs, err) },
+	}
+	if err := tr.Add(Goal{ID: "value", Target: 1000}); err == nil {
+		t.Fatal("expect save error from Add")
+	}
+	gift := biliopen.Gift{UserInfo: biliopen.UserInfo{UID: 1}, MessageID: "1", Price: 100, GiftNum: 1, Paid: true}
+	if err := tr.Handle(biliopen.Event{Cmd: biliopen.CmdLiveOpenPlatformSendGift, Data: gift}); err == nil {
+		t.Fatal("expect save error from Handle")
+	}
+	// 内存中的进度不回滚
+	if g, _ := tr.Get("value"); g.Current != 100 || len(saveErrs) != 2 {
+		t.Fatalf("unexpected goal %+v, save errors %v", g, saveErrs)
+	}
+}
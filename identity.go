@@ -0,0 +1,86 @@
+package biliopen
+
+import (
+	"sync"
+)
+
+// IdentityMap 记录同一用户的 UID 与 OpenID，用于开放平台从 UID 迁移到 OpenID 期间统一用户标识，零值可以直接使用，并发安全
+//
+// 迁移期间同一用户的消息可能只带 UID、同时带 UID 和 OpenID 或者只带 OpenID，直接使用 Identity 会得到两个不同的标识。
+// 设置为 LiveClient.Identities 后，客户端会在分发事件前通过 Resolve 补全缺失的标识，
+// 已知对应关系的用户 Identity 始终返回 OpenID，按 Identity 统计的子包不需要额外处理
+type IdentityMap struct {
+	// OnLink 第一次记录到 UID 与 OpenID 的对应关系时回调，可以用于迁移之前以 "uid:<UID>" 为键保存的数据，在锁外调用
+	OnLink func(uid int, openID string)
+
+	mu       sync.RWMutex
+	byUID    map[int]string
+	byOpenID map[string]int
+}
+
+// Link 记录 UID 与 OpenID 的对应关系，例如启动时从已有的用户表导入，对应关系已经存在时返回 false
+func (m *IdentityMap) Link(uid int, openID string) bool {
+	if uid == 0 || openID == "" {
+		return false
+	}
+	m.mu.RLock()
+	known := m.byUID[uid] == openID
+	m.mu.RUnlock()
+	if known {
+		return false
+	}
+	m.mu.Lock()
+	if m.byUID[uid] == openID {
+		m.mu.Unlock()
+		return false
+	}
+	if m.byUID == nil {
+		m.byUID = make(map[int]string)
+		m.byOpenID = make(map[string]int)
+	}
+	m.byUID[uid] = openID
+	m.byOpenID[openID] = uid
+	m.mu.Unlock()
+	if m.OnLink != nil {
+		m.OnLink(uid, openID)
+	}
+	return true
+}
+
+// Resolve 补全 u 中缺失的 OpenID 或 UID，u 同时带有两者时会记录对应关系
+func (m *IdentityMap) Resolve(u UserInfo) UserInfo {
+	switch {
+	case u.UID != 0 && u.OpenID != "":
+		m.Link(u.UID, u.OpenID)
+	case u.UID != 0:
+		m.mu.RLock()
+		u.OpenID = m.byUID[u.UID]
+		m.mu.RUnlock()
+	case u.OpenID != "":
+		m.mu.RLock()
+		u.UID = m.byOpenID[u.OpenID]
+		m.mu.RUnlock()
+	}
+	return u
+}
+
+// Identity 补全标识后的 Identity，等价于 m.Resolve(u).Identity()
+func (m *IdentityMap) Identity(u UserInfo) string {
+	return m.Resolve(u).Identity()
+}
+
+// resolveEvent 补全事件模型中用户的标识，event 为反序列化得到的模型指针
+func (m *IdentityMap) resolveEvent(event any) {
+	switch data := event.(type) {
+	case *Danmaku:
+		data.UserInfo = m.Resolve(data.UserInfo)
+	case *Gift:
+		data.UserInfo = m.Resolve(data.UserInfo)
+	case *SuperChat:
+		data.UserInfo = m.Resolve(data.UserInfo)
+	case *Guard:
+		data.UserInfo = m.Resolve(data.UserInfo)
+	case *Like:
+		data.UserInfo = m.Resolve(data.UserInfo)
+	}
+}
@@ -0,0 +1,38 @@
+package biliopen
+
+import (
+	"testing"
+)
+
+func TestIdentityMap(t *testing.T) {
+	var links []string
+	m := &IdentityMap{OnLink: func(uid int, openID string) { links = append(links, openID) }}
+	if id := m.Identity(UserInfo{UID: 1}); id != "uid:1" {
+		t.Fatalf("unexpected identity %q", id)
+	}
+	// 同时带有两种标识的消息之后，只带 UID 或只带 OpenID 的消息都会得到同一个标识
+	if id := m.Identity(UserInfo{UID: 1, OpenID: "o1"}); id != "o1" {
+		t.Fatalf("unexpected identity %q", id)
+	}
+	if u := m.Resolve(UserInfo{UID: 1}); u.Identity() != "o1" || u.UID != 1 {
+		t.Fatalf("unexpected resolved user %+v", u)
+	}
+	if u := m.Resolve(UserInfo{OpenID: "o1"}); u.UID != 1 {
+		t.Fatalf("unexpected resolved user %+v", u)
+	}
+	if m.Link(1, "o1") || !m.Link(2, "o2") || len(links) != 2 {
+		t.Fatalf("unexpected links %v", links)
+	}
+	if aliases := (UserInfo{UID: 2, OpenID: "o2"}).Aliases(); len(aliases) != 2 || aliases[1] != "uid:2" {
+		t.Fatalf("unexpected aliases %v", aliases)
+	}
+
+	var got []Danmaku
+	c := &LiveClient{Identities: m, OnDanmaku: func(dm Danmaku) { got = append(got, dm) }}
+	if err := c.handleCmd(CmdLiveOpenPlatformDm, []byte(`{"uid":2,"msg":"hi"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Identity() != "o2" {
+		t.Fatalf("unexpected danmaku %+v", got)
+	}
+}
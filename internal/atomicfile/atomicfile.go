@@ -0,0 +1,44 @@
+// Package atomicfile 原子地写入持久化文件，供各子包保存状态使用
+package atomicfile
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// WriteFile 将 data 写入同一目录下的临时文件并 Sync 后重命名为 name，
+// 写入中途进程退出或者断电时 name 要么是旧内容，要么是完整的新内容
+func WriteFile(name string, data []byte) error {
+	dir := filepath.Dir(name)
+	tmp, err := os.CreateTemp(dir, filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), name); err != nil {
+		return err
+	}
+	syncDir(dir)
+	return nil
+}
+
+// syncDir 尽量将重命名写入磁盘，部分平台不支持对目录 Sync，失败时忽略
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	_ = d.Close()
+}
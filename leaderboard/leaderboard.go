@@ -0,0 +1,401 @@
+// Package leaderboard 直播间贡献榜
+//
+// 按用户累计付费礼物、醒目留言和大航海的付费价值（1000 = 1 元，见 biliopen.EventValue），
+// 支持本场、最近一段时间和今日三个统计窗口，价值相同时先达到的用户排在前面：
+//
+//	b := &leaderboard.Board{OnRankChange: func(c leaderboard.RankChange) { overlay.Push(c) }}
+//	b.Attach(client)
+//	top := b.Top(leaderboard.WindowRecent, 10)
+package leaderboard
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	biliopen "github.com/fython/bili-open-live-go"
+)
+
+const (
+	defaultRecentWindow = time.Minute * 10
+	defaultTrackTop     = 3
+)
+
+// Window 统计窗口
+type Window string
+
+const (
+	// WindowSession 本场，从创建或 Reset 开始
+	WindowSession Window = "session"
+	// WindowRecent 最近 RecentWindow 内，默认 10 分钟
+	WindowRecent Window = "recent"
+	// WindowToday 今日，按 Location 计算日期
+	WindowToday Window = "today"
+)
+
+// Entry 用户的贡献
+type Entry struct {
+	// Identity 用户唯一标识，见 biliopen.UserInfo.Identity
+	Identity string `json:"identity"`
+	UID      int    `json:"uid,omitempty"`
+	OpenID   string `json:"open_id,omitempty"`
+	Username string `json:"uname,omitempty"`
+	// Value 付费价值合计
+	Value int64 `json:"value"`
+	// Gift 付费礼物价值
+	Gift int64 `json:"gift"`
+	// SuperChat 醒目留言价值
+	SuperChat int64 `json:"superchat"`
+	// Guard 大航海价值
+	Guard int64 `json:"guard"`
+	// UpdatedAt 窗口内最后一次贡献的时间，价值相同时早的排在前面
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (e *Entry) add(c Contribution) {
+	e.Value += c.Value
+	switch c.Cmd {
+	case biliopen.CmdLiveOpenPlatformSendGift:
+		e.Gift += c.Value
+	case biliopen.CmdLiveOpenPlatformSuperChat:
+		e.SuperChat += c.Value
+	case biliopen.CmdLiveOpenPlatformGuard:
+		e.Guard += c.Value
+	}
+	if c.Time.After(e.UpdatedAt) {
+		e.UpdatedAt = c.Time
+	}
+}
+
+// Ranked 带排名的贡献
+type Ranked struct {
+	// Rank 排名，从 1 开始
+	Rank int `json:"rank"`
+	Entry
+}
+
+// Contribution 单次贡献，用于计算最近和今日窗口
+type Contribution struct {
+	Identity string    `json:"identity"`
+	Cmd      string    `json:"cmd"`
+	Value    int64     `json:"value"`
+	Time     time.Time `json:"time"`
+}
+
+// RankChange 本场排名变化事件，只有贡献者进入或者在前 TrackTop 名内上升时触发
+type RankChange struct {
+	Entry Entry `json:"entry"`
+	// Rank 变化后的排名
+	Rank int `json:"rank"`
+	// Previous 变化前的排名，之前不在榜上时为 0
+	Previous int `json:"previous"`
+	// Overtaken 被超过的用户，即之前排在 Rank 的用户，Rank 之前空缺时为 nil
+	Overtaken *Entry `json:"overtaken,omitempty"`
+}
+
+// Snapshot 贡献榜快照，可以序列化为 JSON 保存，之后通过 Restore 恢复
+type Snapshot struct {
+	// Start 本场开始时间
+	Start   time.Time `json:"start"`
+	Entries []Entry   `json:"entries"`
+	// Contributions 最近和今日窗口内的贡献
+	Contributions []Contribution `json:"contributions"`
+}
+
+// Board 贡献榜，零值可以直接使用，并发安全
+type Board struct {
+	// RecentWindow WindowRecent 的时长，默认 10 分钟
+	RecentWindow time.Duration
+	// Location 计算今日的时区，默认为 time.Local
+	Location *time.Location
+	// TrackTop 本场前几名的排名变化会触发 OnRankChange，默认 3
+	TrackTop int
+	// OnRankChange 本场排名变化时回调，在锁外调用
+	OnRankChange func(c RankChange)
+
+	mu       sync.Mutex
+	start    time.Time
+	sessions map[string]*Entry
+	contribs []Contribution
+	// dedup 过滤重连后重复推送的消息
+	dedup biliopen.Deduplicator
+
+	// now 测试时替换当前时间
+	now func() time.Time
+}
+
+func (b *Board) getNow() time.Time {
+	if b.now != nil {
+		return b.now()
+	}
+	return time.Now()
+}
+
+func (b *Board) getRecentWindow() time.Duration {
+	if b.RecentWindow <= 0 {
+		return defaultRecentWindow
+	}
+	return b.RecentWindow
+}
+
+func (b *Board) getTrackTop() int {
+	if b.TrackTop <= 0 {
+		return defaultTrackTop
+	}
+	return b.TrackTop
+}
+
+// today 今日开始时间
+func (b *Board) today(now time.Time) time.Time {
+	loc := b.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	y, m, d := now.In(loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, loc)
+}
+
+// since 窗口的开始时间，WindowSession 返回零值
+func (b *Board) since(w Window, now time.Time) time.Time {
+	switch w {
+	case WindowRecent:
+		return now.Add(-b.getRecentWindow())
+	case WindowToday:
+		return b.today(now)
+	default:
+		return time.Time{}
+	}
+}
+
+// prune 丢弃不在最近和今日窗口内的贡献，调用方需要持有锁
+func (b *Board) prune(now time.Time) {
+	cutoff := b.since(WindowToday, now)
+	if recent := b.since(WindowRecent, now); recent.Before(cutoff) {
+		cutoff = recent
+	}
+	i := 0
+	for i < len(b.contribs) && b.contribs[i].Time.Before(cutoff) {
+		i++
+	}
+	if i > 0 {
+		b.contribs = append(b.contribs[:0], b.contribs[i:]...)
+	}
+}
+
+// ranked 窗口内的排名，调用方需要持有锁
+func (b *Board) ranked(w Window, now time.Time) []Ranked {
+	var entries []Entry
+	if w == WindowSession {
+		entries = make([]Entry, 0, len(b.sessions))
+		for _, e := range b.sessions {
+			entries = append(entries, *e)
+		}
+	} else {
+		since := b.since(w, now)
+		index := make(map[string]int)
+		for _, c := range b.contribs {
+			if c.Time.Before(since) {
+				continue
+			}
+			i, ok := index[c.Identity]
+			if !ok {
+				i = len(entries)
+				index[c.Identity] = i
+				e := Entry{Identity: c.Identity}
+				if s := b.sessions[c.Identity]; s != nil {
+					e.UID, e.OpenID, e.Username = s.UID, s.OpenID, s.Username
+				}
+				entries = append(entries, e)
+			}
+			entries[i].add(c)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Value != entries[j].Value {
+			return entries[i].Value > entries[j].Value
+		}
+		if !entries[i].UpdatedAt.Equal(entries[j].UpdatedAt) {
+			return entries[i].UpdatedAt.Before(entries[j].UpdatedAt)
+		}
+		return entries[i].Identity < entries[j].Identity
+	})
+	ranked := make([]Ranked, len(entries))
+	for i, e := range entries {
+		ranked[i] = Ranked{Rank: i + 1, Entry: e}
+	}
+	return ranked
+}
+
+// Top 窗口内的前 n 名，n <= 0 时返回所有用户
+func (b *Board) Top(w Window, n int) []Ranked {
+	now := b.getNow()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ranked := b.ranked(w, now)
+	if n > 0 && len(ranked) > n {
+		ranked = ranked[:n]
+	}
+	return ranked
+}
+
+// Rank 用户在窗口内的排名，没有贡献时返回 false
+func (b *Board) Rank(w Window, u biliopen.UserInfo) (Ranked, bool) {
+	now := b.getNow()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, r := range b.ranked(w, now) {
+		if r.Identity == u.Identity() {
+			return r, true
+		}
+	}
+	return Ranked{}, false
+}
+
+// Start 本场开始时间
+func (b *Board) Start() time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.start
+}
+
+// Reset 开始新的一场，清空本场的贡献，最近和今日窗口不受影响
+func (b *Board) Reset() {
+	now := b.getNow()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.start = now
+	b.sessions = nil
+}
+
+// Snapshot 贡献榜快照
+func (b *Board) Snapshot() Snapshot {
+	now := b.getNow()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.prune(now)
+	s := Snapshot{Start: b.start, Contributions: append([]Contribution(nil), b.contribs...)}
+	for _, r := range b.ranked(WindowSession, now) {
+		s.Entries = append(s.Entries, r.Entry)
+	}
+	return s
+}
+
+// Restore 从快照恢复，会覆盖当前的贡献
+func (b *Board) Restore(s Snapshot) {
+	now := b.getNow()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.start = s.Start
+	b.sessions = make(map[string]*Entry, len(s.Entries))
+	for _, e := range s.Entries {
+		e := e
+		b.sessions[e.Identity] = &e
+	}
+	b.contribs = append([]Contribution(nil), s.Contributions...)
+	sort.SliceStable(b.contribs, func(i, j int) bool {
+		return b.contribs[i].Time.Before(b.contribs[j].Time)
+	})
+	b.prune(now)
+}
+
+// Add 记录一次贡献，cmd 为 biliopen.CmdLiveOpenPlatformSendGift 等事件类型，用于区分贡献来源
+func (b *Board) Add(u biliopen.UserInfo, cmd string, value int64) {
+	b.add(u, cmd, value, "")
+}
+
+// add 记录一次贡献，msgID 不为空时先检查是否重复，记录贡献后再保存 msgID
+func (b *Board) add(u biliopen.UserInfo, cmd string, value int64, msgID string) {
+	identity := u.Identity()
+	if identity == "" || value <= 0 {
+		return
+	}
+	now := b.getNow()
+	c := Contribution{Identity: identity, Cmd: cmd, Value: value, Time: now}
+	top := b.getTrackTop()
+
+	b.mu.Lock()
+	if b.dedup.Seen(msgID) {
+		b.mu.Unlock()
+		return
+	}
+	if b.start.IsZero() {
+		b.start = now
+	}
+	before := b.ranked(WindowSession, now)
+	if b.sessions == nil {
+		b.sessions = make(map[string]*Entry)
+	}
+	e := b.sessions[identity]
+	if e == nil {
+		e = &Entry{Identity: identity}
+		b.sessions[identity] = e
+	}
+	if u.UID != 0 {
+		e.UID = u.UID
+	}
+	if u.OpenID != "" {
+		e.OpenID = u.OpenID
+	}
+	if u.Username != "" {
+		e.Username = u.Username
+	}
+	e.add(c)
+	b.prune(now)
+	b.contribs = append(b.contribs, c)
+
+	var change *RankChange
+	for _, r := range b.ranked(WindowSession, now) {
+		if r.Identity != identity {
+			continue
+		}
+		prev := 0
+		for _, p := range before {
+			if p.Identity == identity {
+				prev = p.Rank
+				break
+			}
+		}
+		if r.Rank <= top && (prev == 0 || r.Rank < prev) {
+			change = &RankChange{Entry: r.Entry, Rank: r.Rank, Previous: prev}
+			if r.Rank <= len(before) {
+				overtaken := before[r.Rank-1].Entry
+				change.Overtaken = &overtaken
+			}
+		}
+		break
+	}
+	b.dedup.Duplicate(cmd, msgID)
+	b.mu.Unlock()
+
+	if change != nil && b.OnRankChange != nil {
+		b.OnRankChange(*change)
+	}
+}
+
+// Attach 注册礼物、醒目留言和大航海路由，返回的 RouteID 可以用于 RemoveRoute
+func (b *Board) Attach(c *biliopen.LiveClient) biliopen.RouteID {
+	return c.Route(biliopen.IsCmd(
+		biliopen.CmdLiveOpenPlatformSendGift,
+		biliopen.CmdLiveOpenPlatformSuperChat,
+		biliopen.CmdLiveOpenPlatformGuard,
+	), b.Handle)
+}
+
+// Handle 处理礼物、醒目留言和大航海事件，可以作为 biliopen.Handler 使用，重复推送的消息按 msg_id 只计一次
+func (b *Board) Handle(e biliopen.Event) error {
+	var msgID string
+	switch data := e.Data.(type) {
+	case biliopen.Gift:
+		msgID = data.MessageID
+	case biliopen.SuperChat:
+		msgID = data.MessageID
+	case biliopen.Guard:
+		msgID = data.MessageID
+	default:
+		return nil
+	}
+	value := biliopen.EventValue(e)
+	user, _ := biliopen.EventUser(e)
+	b.add(user, e.Cmd, value, msgID)
+	return nil
+}
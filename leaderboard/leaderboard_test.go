@@ -0,0 +1,93 @@
+package leaderboard
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	biliopen "github.com/fython/bili-open-live-go"
+)
+
+func giftEvent(uid int, msgID string, price int) biliopen.Event {
+	return biliopen.Event{Cmd: biliopen.CmdLiveOpenPlatformSendGift, Data: biliopen.Gift{
+		UserInfo: biliopen.UserInfo{UID: uid}, MessageID: msgID, Price: price, GiftNum: 1, Paid: true,
+	}}
+}
+
+func identities(ranked []Ranked) []string {
+	var ids []string
+	for _, r := range ranked {
+		ids = append(ids, r.Identity)
+	}
+	return ids
+}
+
+func TestBoard(t *testing.T) {
+	now := time.Date(2024, 5, 1, 23, 50, 0, 0, time.UTC)
+	var changes []RankChange
+	b := &Board{
+		Location:     time.UTC,
+		TrackTop:     2,
+		OnRankChange: func(c RankChange) { changes = append(changes, c) },
+		now:          func() time.Time { return now },
+	}
+	step := func(d time.Duration, ev biliopen.Event) {
+		t.Helper()
+		now = now.Add(d)
+		if err := b.Handle(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	step(0, giftEvent(1, "g1", 5000))
+	step(0, giftEvent(1, "g1", 5000))
+	step(time.Minute, giftEvent(2, "g2", 5000))
+	step(time.Minute, giftEvent(3, "g3", 1000))
+	// 价值相同时先达到的排在前面
+	if top := identities(b.Top(WindowSession, 0)); len(top) != 3 || top[0] != "uid:1" || top[1] != "uid:2" {
+		t.Fatalf("unexpected top %v", top)
+	}
+	if len(changes) != 2 || changes[0].Rank != 1 || changes[1].Rank != 2 || changes[1].Overtaken != nil {
+		t.Fatalf("unexpected changes %+v", changes)
+	}
+	step(time.Minute, biliopen.Event{Cmd: biliopen.CmdLiveOpenPlatformSuperChat, Data: biliopen.SuperChat{
+		UserInfo: biliopen.UserInfo{UID: 2}, MessageID: "s1", RMB: 30,
+	}})
+	if len(changes) != 3 || changes[2].Rank != 1 || changes[2].Previous != 2 ||
+		changes[2].Overtaken == nil || changes[2].Overtaken.Identity != "uid:1" || changes[2].Entry.SuperChat != 30000 {
+		t.Fatalf("unexpected changes %+v", changes)
+	}
+
+	// 跨天后今日窗口重新计算，最近 10 分钟窗口仍然包含前一天的贡献
+	step(time.Minute*8, giftEvent(3, "g4", 2000))
+	if top := identities(b.Top(WindowToday, 0)); len(top) != 1 || top[0] != "uid:3" {
+		t.Fatalf("unexpected today %v", top)
+	}
+	if top := identities(b.Top(WindowRecent, 2)); len(top) != 2 || top[0] != "uid:2" || top[1] != "uid:3" {
+		t.Fatalf("unexpected recent %v", top)
+	}
+	if r, ok := b.Rank(WindowSession, biliopen.UserInfo{UID: 3}); !ok || r.Rank != 3 || r.Value != 3000 {
+		t.Fatalf("unexpected rank %+v", r)
+	}
+
+	data, err := json.Marshal(b.Snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s Snapshot
+	if err = json.Unmarshal(data, &s); err != nil {
+		t.Fatal(err)
+	}
+	restored := &Board{Location: time.UTC, now: func() time.Time { return now }}
+	restored.Restore(s)
+	if top := identities(restored.Top(WindowSession, 0)); len(top) != 3 || top[0] != "uid:2" || !restored.Start().Equal(b.Start()) {
+		t.Fatalf("unexpected restored top %v", top)
+	}
+	now = now.Add(time.Minute * 11)
+	if top := identities(restored.Top(WindowRecent, 0)); len(top) != 0 {
+		t.Fatalf("unexpected restored recent %v", top)
+	}
+	restored.Reset()
+	if top := restored.Top(WindowSession, 0); len(top) != 0 || len(restored.Top(WindowToday, 0)) != 1 {
+		t.Fatalf("unexpected top after reset %v", top)
+	}
+}
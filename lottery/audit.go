@@ -0,0 +1,183 @@
+package lottery
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// AuditLog 抽奖审计日志，包含公开的种子、信标、参与名单和中奖结果，可以导出为 JSON 并通过 Verify 验证
+type AuditLog struct {
+	Title               string           `json:"title,omitempty"`
+	Keyword             string           `json:"keyword,omitempty"`
+	MinMedalLevel       int              `json:"min_medal_level,omitempty"`
+	RequireWearingMedal bool             `json:"require_wearing_medal,omitempty"`
+	Gifts               map[string]int64 `json:"gifts,omitempty"`
+	OpenedAt            time.Time        `json:"opened_at"`
+	ClosedAt            time.Time        `json:"closed_at"`
+
+	// Commitment 开奖前公布的种子承诺值，即 Seed 的 SHA-256
+	Commitment string `json:"commitment"`
+	// Seed 开奖时公开的种子，十六进制
+	Seed string `json:"seed"`
+	// Beacon 停止参与后才公布的公共随机信标，与种子共同决定中奖结果
+	Beacon Beacon `json:"beacon"`
+	// Entries 参与名单，按 Identity 排序
+	Entries []Entry `json:"entries"`
+	// EntriesDigest 参与名单的摘要，见 EntriesDigest
+	EntriesDigest string `json:"entries_digest"`
+	// Count 抽取的中奖人数
+	Count int `json:"count"`
+	// Winners 中奖者，按抽取顺序排列
+	Winners []Entry `json:"winners"`
+}
+
+// Beacon 公共随机信标，例如 drand 某一轮的随机数或者某个区块的哈希，需要在停止参与之后才公布，
+// Verify 只检查信标的公布时间晚于 ClosedAt，验证者还需要根据 Source 到公开渠道核对 Value
+type Beacon struct {
+	// Source 信标来源，例如 "drand quicknet round 1234567" 或 "bitcoin block 840000"
+	Source string `json:"source"`
+	// Value 信标值
+	Value string `json:"value"`
+	// PublishedAt 信标的公布时间
+	PublishedAt time.Time `json:"published_at"`
+}
+
+// WriteJSON 以缩进的 JSON 格式写入审计日志
+func (a *AuditLog) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(a)
+}
+
+// ReadAuditLog 读取 WriteJSON 写入的审计日志
+func ReadAuditLog(r io.Reader) (*AuditLog, error) {
+	var a AuditLog
+	if err := json.NewDecoder(r).Decode(&a); err != nil {
+		return nil, fmt.Errorf("decode audit log fail: %w", err)
+	}
+	return &a, nil
+}
+
+// Verify 验证审计日志：种子与承诺值一致、信标在停止参与之后公布、名单与摘要一致、
+// 按种子、信标和名单重新抽取的结果与中奖者一致
+func Verify(a *AuditLog) error {
+	seed, err := hex.DecodeString(a.Seed)
+	if err != nil {
+		return fmt.Errorf("decode seed fail: %w", err)
+	}
+	if Commitment(seed) != a.Commitment {
+		return fmt.Errorf("seed does not match commitment")
+	}
+	if a.Beacon.Value == "" {
+		return fmt.Errorf("beacon is missing")
+	}
+	if !a.Beacon.PublishedAt.After(a.ClosedAt) {
+		return fmt.Errorf("beacon is published before close time")
+	}
+	if EntriesDigest(a.Entries) != a.EntriesDigest {
+		return fmt.Errorf("entries do not match digest")
+	}
+	winners := drawWinners(drawKey(seed, a.Beacon.Value), a.EntriesDigest, a.Entries, a.Count)
+	if len(winners) != len(a.Winners) {
+		return fmt.Errorf("expect %d winners, got %d", len(winners), len(a.Winners))
+	}
+	for i, w := range winners {
+		if w.Identity != a.Winners[i].Identity {
+			return fmt.Errorf("winner %d mismatch: expect %s, got %s", i, w.Identity, a.Winners[i].Identity)
+		}
+	}
+	return nil
+}
+
+// Commitment 种子的承诺值，即 SHA-256 的十六进制
+func Commitment(seed []byte) string {
+	sum := sha256.Sum256(seed)
+	return hex.EncodeToString(sum[:])
+}
+
+// EntriesDigest 参与名单的摘要，每个参与者写作 "<Identity>\t<Weight>\n"，按名单顺序拼接后取 SHA-256 的十六进制
+func EntriesDigest(entries []Entry) string {
+	h := sha256.New()
+	var buf []byte
+	for _, e := range entries {
+		buf = append(buf[:0], e.Identity...)
+		buf = append(buf, '\t')
+		buf = strconv.AppendInt(buf, e.Weight, 10)
+		buf = append(buf, '\n')
+		h.Write(buf)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// drawKey 抽奖使用的密钥，即 HMAC-SHA256(key=seed, message=beacon)
+func drawKey(seed []byte, beacon string) []byte {
+	mac := hmac.New(sha256.New, seed)
+	mac.Write([]byte(beacon))
+	return mac.Sum(nil)
+}
+
+// drawWinners 按权重不放回地抽取 count 个中奖者
+//
+// 随机数为 HMAC-SHA256(key=drawKey, message=digest || 8 字节大端序计数器) 的前 8 字节，计数器从 0 开始，
+// 每个随机数通过拒绝采样映射到 [0, 剩余总权重)，然后按名单顺序累加权重确定中奖者
+func drawWinners(key []byte, digest string, entries []Entry, count int) []Entry {
+	remaining := make([]Entry, 0, len(entries))
+	for _, e := range entries {
+		if e.Weight > 0 {
+			remaining = append(remaining, e)
+		}
+	}
+	r := &drawRand{key: key, digest: digest}
+	var winners []Entry
+	for len(winners) < count && len(remaining) > 0 {
+		var total uint64
+		for _, e := range remaining {
+			total += uint64(e.Weight)
+		}
+		n := r.uint64n(total)
+		for i, e := range remaining {
+			if n < uint64(e.Weight) {
+				winners = append(winners, e)
+				remaining = append(remaining[:i], remaining[i+1:]...)
+				break
+			}
+			n -= uint64(e.Weight)
+		}
+	}
+	return winners
+}
+
+// drawRand 由 drawKey 和名单摘要决定的确定性随机数
+type drawRand struct {
+	key     []byte
+	digest  string
+	counter uint64
+}
+
+func (r *drawRand) uint64() uint64 {
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write([]byte(r.digest))
+	var c [8]byte
+	binary.BigEndian.PutUint64(c[:], r.counter)
+	mac.Write(c[:])
+	r.counter++
+	return binary.BigEndian.Uint64(mac.Sum(nil))
+}
+
+// uint64n 返回 [0, n) 的均匀随机数
+func (r *drawRand) uint64n(n uint64) uint64 {
+	limit := math.MaxUint64 - math.MaxUint64%n
+	for {
+		if v := r.uint64(); v < limit {
+			return v % n
+		}
+	}
+}
@@ -0,0 +1,323 @@
+// Package lottery 可公开验证的直播间抽奖
+//
+// 开奖前通过 Open 公布随机种子的 SHA-256 承诺值，开奖时公开种子，种子、停止参与后才公布的公共随机信标
+// 与参与名单的摘要共同决定中奖结果，任何人都可以用 Verify 根据导出的审计日志复现抽奖过程。
+// 只靠种子时知道种子的主办方可以在停止参与前预先计算结果并混入参与者，信标保证停止参与时没有人能预知结果：
+//
+//	l := &lottery.Lottery{Title: "周年抽奖", Keyword: "抽奖", MinMedalLevel: 5, Gifts: map[string]int64{"小花花": 1},
+//		FetchBeacon: fetchDrandAfter}
+//	l.Attach(client)
+//	commitment, err := l.Open() // 公布 commitment
+//	...
+//	audit, err := l.Draw(3)
+//	err = audit.WriteJSON(file)
+package lottery
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	biliopen "github.com/fython/bili-open-live-go"
+)
+
+const seedSize = 32
+
+var (
+	// ErrNotOpen 抽奖没有开始或者已经开奖
+	ErrNotOpen = errors.New("lottery is not open")
+	// ErrNoEntries 没有人参与
+	ErrNoEntries = errors.New("lottery has no entries")
+	// ErrNoBeacon 没有设置 FetchBeacon
+	ErrNoBeacon = errors.New("lottery beacon is not configured")
+)
+
+type state int
+
+const (
+	stateIdle state = iota
+	stateOpen
+	stateClosed
+	stateDrawn
+)
+
+// Lottery 抽奖，零值不可用，至少需要设置 Keyword 或 Gifts，并发安全
+//
+// 一个 Lottery 可以多次 Open，每次开始时清空上一轮的参与名单并生成新的种子
+type Lottery struct {
+	// Title 抽奖标题
+	Title string
+	// Keyword 参与关键词，弹幕内容去掉首尾空白后与之相同时参与，权重为 1，同一用户重复发送不会增加权重
+	Keyword string
+	// MinMedalLevel 参与需要的粉丝勋章等级，为 0 时不限制
+	MinMedalLevel int
+	// RequireWearingMedal 是否需要佩戴当前主播的粉丝勋章
+	RequireWearingMedal bool
+	// Gifts 礼物名称到每个礼物增加的权重，送出这些付费礼物也可以参与抽奖，同样需要满足粉丝勋章条件
+	Gifts map[string]int64
+
+	// Rand 生成种子的随机数来源，默认为 crypto/rand.Reader
+	Rand io.Reader
+	// FetchBeacon 获取 closedAt 之后才公布的公共随机信标，例如 drand 的下一轮随机数或者下一个区块的哈希，
+	// Draw 在停止参与后不持有锁调用，可以阻塞等待信标公布，为空时只能通过 DrawWithBeacon 手动传入信标
+	FetchBeacon func(closedAt time.Time) (Beacon, error)
+
+	mu       sync.Mutex
+	state    state
+	seed     []byte
+	openedAt time.Time
+	closedAt time.Time
+	entries  map[string]*Entry
+	// gifts 已经计入的礼物 msg_id，避免重连后重复计算
+	gifts map[string]bool
+	audit *AuditLog
+
+	// now 测试时替换当前时间
+	now func() time.Time
+}
+
+// Entry 参与记录
+type Entry struct {
+	// Identity 用户唯一标识，见 biliopen.UserInfo.Identity
+	Identity string `json:"identity"`
+	// Username 用户名，只用于展示，不参与摘要计算
+	Username string `json:"uname"`
+	// Weight 权重，关键词计 1，礼物按 Gifts 计算
+	Weight int64 `json:"weight"`
+	// Keyword 是否发送过关键词
+	Keyword bool `json:"keyword"`
+	// EnteredAt 首次参与时间
+	EnteredAt time.Time `json:"entered_at"`
+}
+
+func (l *Lottery) getNow() time.Time {
+	if l.now != nil {
+		return l.now()
+	}
+	return time.Now()
+}
+
+func (l *Lottery) getRand() io.Reader {
+	if l.Rand == nil {
+		return rand.Reader
+	}
+	return l.Rand
+}
+
+// Open 开始接受参与，生成新的随机种子并返回其承诺值，即种子 SHA-256 的十六进制，需要在开奖前公布
+func (l *Lottery) Open() (commitment string, err error) {
+	if l.Keyword == "" && len(l.Gifts) == 0 {
+		return "", fmt.Errorf("keyword or gifts is required")
+	}
+	seed := make([]byte, seedSize)
+	if _, err = io.ReadFull(l.getRand(), seed); err != nil {
+		return "", fmt.Errorf("generate seed fail: %w", err)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.state == stateOpen {
+		return "", fmt.Errorf("lottery is already open")
+	}
+	l.state = stateOpen
+	l.seed = seed
+	l.openedAt = l.getNow()
+	l.closedAt = time.Time{}
+	l.entries = make(map[string]*Entry)
+	l.gifts = make(map[string]bool)
+	l.audit = nil
+	return Commitment(seed), nil
+}
+
+// Close 停止接受参与，名单不再变化，Draw 时会自动调用
+func (l *Lottery) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.close()
+}
+
+func (l *Lottery) close() error {
+	switch l.state {
+	case stateOpen:
+		l.state = stateClosed
+		l.closedAt = l.getNow()
+		return nil
+	case stateClosed:
+		return nil
+	default:
+		return ErrNotOpen
+	}
+}
+
+// Draw 停止接受参与，通过 FetchBeacon 获取信标后抽取 count 个中奖者，每个用户最多中奖一次，参与人数不足时全部中奖，
+// 返回的审计日志中包含公开的种子和信标，可以通过 Verify 验证
+func (l *Lottery) Draw(count int) (*AuditLog, error) {
+	if l.FetchBeacon == nil {
+		return nil, ErrNoBeacon
+	}
+	if count <= 0 {
+		return nil, fmt.Errorf("invalid winner count %d", count)
+	}
+	l.mu.Lock()
+	err := l.close()
+	closedAt := l.closedAt
+	l.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	beacon, err := l.FetchBeacon(closedAt)
+	if err != nil {
+		return nil, fmt.Errorf("fetch beacon fail: %w", err)
+	}
+	return l.DrawWithBeacon(count, beacon)
+}
+
+// DrawWithBeacon 与 Draw 相同，使用手动获取的信标，信标的公布时间需要晚于停止参与的时间
+func (l *Lottery) DrawWithBeacon(count int, beacon Beacon) (*AuditLog, error) {
+	if count <= 0 {
+		return nil, fmt.Errorf("invalid winner count %d", count)
+	}
+	if beacon.Value == "" {
+		return nil, fmt.Errorf("beacon value is required")
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.close(); err != nil {
+		return nil, err
+	}
+	if !beacon.PublishedAt.After(l.closedAt) {
+		return nil, fmt.Errorf("beacon published at %v is not after close time %v", beacon.PublishedAt, l.closedAt)
+	}
+	if len(l.entries) == 0 {
+		return nil, ErrNoEntries
+	}
+	entries := l.sortedEntries()
+	audit := &AuditLog{
+		Title:               l.Title,
+		Keyword:             l.Keyword,
+		MinMedalLevel:       l.MinMedalLevel,
+		RequireWearingMedal: l.RequireWearingMedal,
+		Gifts:               l.Gifts,
+		OpenedAt:            l.openedAt,
+		ClosedAt:            l.closedAt,
+		Commitment:          Commitment(l.seed),
+		Seed:                hex.EncodeToString(l.seed),
+		Beacon:              beacon,
+		Entries:             entries,
+		EntriesDigest:       EntriesDigest(entries),
+		Count:               count,
+	}
+	audit.Winners = drawWinners(drawKey(l.seed, beacon.Value), audit.EntriesDigest, entries, count)
+	l.state = stateDrawn
+	l.audit = audit
+	return audit, nil
+}
+
+// Audit 最近一次开奖的审计日志，没有开奖时返回 nil
+func (l *Lottery) Audit() *AuditLog {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.audit
+}
+
+// Entries 当前参与名单，按 Identity 排序
+func (l *Lottery) Entries() []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.sortedEntries()
+}
+
+func (l *Lottery) sortedEntries() []Entry {
+	entries := make([]Entry, 0, len(l.entries))
+	for _, e := range l.entries {
+		entries = append(entries, *e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Identity < entries[j].Identity
+	})
+	return entries
+}
+
+// Attach 注册弹幕和礼物路由，返回的 RouteID 可以用于 RemoveRoute
+func (l *Lottery) Attach(c *biliopen.LiveClient) biliopen.RouteID {
+	return c.Route(biliopen.IsCmd(biliopen.CmdLiveOpenPlatformDm, biliopen.CmdLiveOpenPlatformSendGift), l.Handle)
+}
+
+// Handle 处理弹幕和礼物事件，可以作为 biliopen.Handler 使用，抽奖没有开始时忽略
+func (l *Lottery) Handle(e biliopen.Event) error {
+	switch data := e.Data.(type) {
+	case biliopen.Danmaku:
+		l.Enter(data)
+	case biliopen.Gift:
+		l.Gift(data)
+	}
+	return nil
+}
+
+// Enter 处理一条弹幕，首次通过关键词参与时返回 true
+func (l *Lottery) Enter(dm biliopen.Danmaku) bool {
+	if l.Keyword == "" || dm.DMType != biliopen.DanmakuTypeText || strings.TrimSpace(dm.Message) != l.Keyword {
+		return false
+	}
+	if !l.eligible(dm.FansMedal) {
+		return false
+	}
+	return l.add(dm.UserInfo, 1, "", true)
+}
+
+// Gift 处理一个付费礼物，计入权重时返回 true，免费礼物和重复的礼物不计入
+func (l *Lottery) Gift(g biliopen.Gift) bool {
+	if !g.Paid {
+		return false
+	}
+	weight := l.Gifts[g.GiftName] * int64(g.GiftNum)
+	if weight <= 0 || !l.eligible(g.FansMedal) {
+		return false
+	}
+	return l.add(g.UserInfo, weight, g.MessageID, false)
+}
+
+// add 增加权重，keyword 为 true 时同一用户只计一次
+func (l *Lottery) add(user biliopen.UserInfo, weight int64, msgID string, keyword bool) bool {
+	id := user.Identity()
+	if id == "" {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.state != stateOpen {
+		return false
+	}
+	if msgID != "" {
+		if l.gifts[msgID] {
+			return false
+		}
+		l.gifts[msgID] = true
+	}
+	e := l.entries[id]
+	if e == nil {
+		e = &Entry{Identity: id, Username: user.Username, EnteredAt: l.getNow()}
+		l.entries[id] = e
+	}
+	if keyword {
+		if e.Keyword {
+			// 重复发送关键词不增加权重
+			return false
+		}
+		e.Keyword = true
+	}
+	e.Weight += weight
+	return true
+}
+
+func (l *Lottery) eligible(medal biliopen.FansMedal) bool {
+	if l.RequireWearingMedal && !medal.FansMedalWearingStatus {
+		return false
+	}
+	return medal.FansMedalLevel >= l.MinMedalLevel
+}
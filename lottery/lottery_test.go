@@ -0,0 +1,157 @@
+package lottery
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	biliopen "github.com/fython/bili-open-live-go"
+)
+
+func fan(uid int, level int) biliopen.FansMedal {
+	return biliopen.FansMedal{FansMedalLevel: level, FansMedalWearingStatus: uid%2 == 1}
+}
+
+func TestLottery(t *testing.T) {
+	l := &Lottery{
+		Keyword:             "抽奖",
+		MinMedalLevel:       3,
+		RequireWearingMedal: true,
+		Gifts:               map[string]int64{"小花花": 2},
+		Rand:                bytes.NewReader(bytes.Repeat([]byte{7}, seedSize*2)),
+		FetchBeacon: func(closedAt time.Time) (Beacon, error) {
+			return Beacon{Source: "test round 1", Value: "beacon", PublishedAt: closedAt.Add(time.Second)}, nil
+		},
+	}
+	if l.Enter(biliopen.Danmaku{UserInfo: biliopen.UserInfo{UID: 1}, FansMedal: fan(1, 5), Message: "抽奖"}) {
+		t.Fatal("should not enter before open")
+	}
+	commitment, err := l.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for uid := 1; uid <= 9; uid++ {
+		l.Enter(biliopen.Danmaku{UserInfo: biliopen.UserInfo{UID: uid}, FansMedal: fan(uid, uid), Message: " 抽奖 "})
+	}
+	// uid 3、5、7、9 满足条件，重复发送关键词不增加权重
+	if l.Enter(biliopen.Danmaku{UserInfo: biliopen.UserInfo{UID: 3}, FansMedal: fan(3, 3), Message: "抽奖"}) {
+		t.Fatal("duplicate entry should be rejected")
+	}
+	gift := biliopen.Gift{UserInfo: biliopen.UserInfo{UID: 11}, FansMedal: fan(11, 10), MessageID: "g0", GiftName: "小花花", GiftNum: 3}
+	if l.Gift(gift) {
+		t.Fatal("free gift should be ignored")
+	}
+	gift.MessageID, gift.Paid = "g1", true
+	if !l.Gift(gift) || l.Gift(gift) {
+		t.Fatal("gift should be counted once")
+	}
+	gift.MessageID, gift.GiftName = "g2", "辣条"
+	if l.Gift(gift) {
+		t.Fatal("other gifts should be ignored")
+	}
+	entries := l.Entries()
+	if len(entries) != 5 || entries[1].Identity != "uid:3" || entries[0].Weight != 6 || entries[0].Keyword {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+
+	audit, err := l.Draw(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if audit.Commitment != commitment || len(audit.Winners) != 3 || audit.Beacon.Value != "beacon" {
+		t.Fatalf("unexpected audit %+v", audit)
+	}
+	seen := map[string]bool{}
+	for _, w := range audit.Winners {
+		if seen[w.Identity] {
+			t.Fatalf("duplicate winner %s", w.Identity)
+		}
+		seen[w.Identity] = true
+	}
+	if l.Enter(biliopen.Danmaku{UserInfo: biliopen.UserInfo{UID: 13}, FansMedal: fan(13, 13), Message: "抽奖"}) {
+		t.Fatal("should not enter after draw")
+	}
+	if _, err = l.Draw(1); err != ErrNotOpen {
+		t.Fatalf("expect ErrNotOpen, got %v", err)
+	}
+
+	// 导出后验证，篡改名单或结果都会失败
+	var buf bytes.Buffer
+	if err = audit.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.String()
+	loaded, err := ReadAuditLog(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = Verify(loaded); err != nil {
+		t.Fatal(err)
+	}
+	loaded.Entries[0].Weight = 100
+	if Verify(loaded) == nil {
+		t.Fatal("tampered entries should fail")
+	}
+	loaded, _ = ReadAuditLog(strings.NewReader(data))
+	loaded.Winners[0], loaded.Winners[1] = loaded.Winners[1], loaded.Winners[0]
+	if Verify(loaded) == nil {
+		t.Fatal("tampered winners should fail")
+	}
+	loaded, _ = ReadAuditLog(strings.NewReader(data))
+	loaded.Seed = strings.Repeat("00", seedSize)
+	if Verify(loaded) == nil {
+		t.Fatal("tampered seed should fail")
+	}
+	// 信标决定结果，替换信标或者使用停止参与前公布的信标都会失败
+	loaded, _ = ReadAuditLog(strings.NewReader(data))
+	loaded.Beacon.Value = "other"
+	if Verify(loaded) == nil {
+		t.Fatal("tampered beacon should fail")
+	}
+	loaded, _ = ReadAuditLog(strings.NewReader(data))
+	loaded.Beacon.PublishedAt = loaded.ClosedAt
+	if Verify(loaded) == nil {
+		t.Fatal("beacon published before close should fail")
+	}
+}
+
+func TestDrawWithBeacon(t *testing.T) {
+	l := &Lottery{Keyword: "抽奖"}
+	if _, err := l.Open(); err != nil {
+		t.Fatal(err)
+	}
+	l.Enter(biliopen.Danmaku{UserInfo: biliopen.UserInfo{UID: 1}, Message: "抽奖"})
+	if _, err := l.Draw(1); err != ErrNoBeacon {
+		t.Fatalf("expect ErrNoBeacon, got %v", err)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// 信标需要在停止参与之后公布
+	if _, err := l.DrawWithBeacon(1, Beacon{Value: "early", PublishedAt: time.Now().Add(-time.Hour)}); err == nil {
+		t.Fatal("expect early beacon to be rejected")
+	}
+	audit, err := l.DrawWithBeacon(1, Beacon{Value: "late", PublishedAt: time.Now().Add(time.Minute)})
+	if err != nil || len(audit.Winners) != 1 || Verify(audit) != nil {
+		t.Fatalf("unexpected audit %+v %v", audit, err)
+	}
+}
+
+func TestDrawWinners(t *testing.T) {
+	entries := []Entry{{Identity: "a", Weight: 1}, {Identity: "b", Weight: 3}, {Identity: "c"}}
+	// 零权重不会中奖，人数不足时全部中奖
+	winners := drawWinners([]byte("seed"), "digest", entries, 5)
+	if len(winners) != 2 {
+		t.Fatalf("unexpected winners %+v", winners)
+	}
+	// 大致符合权重
+	counts := map[string]int{}
+	for i := 0; i < 4000; i++ {
+		w := drawWinners([]byte{byte(i), byte(i >> 8)}, "digest", entries, 1)
+		counts[w[0].Identity]++
+	}
+	if counts["b"] < 2700 || counts["b"] > 3300 {
+		t.Fatalf("unexpected distribution %v", counts)
+	}
+}
@@ -0,0 +1,116 @@
+package biliopen
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Event 长连消息事件，Data 为反序列化后的模型值，例如 Danmaku、Gift
+type Event struct {
+	Cmd  string
+	Data any
+}
+
+// Handler 事件处理函数，返回的错误会记录到日志中
+type Handler func(e Event) error
+
+// Middleware 事件中间件，包装下一个 Handler，可以在调用前后插入逻辑或者直接拦截事件
+type Middleware func(next Handler) Handler
+
+// Use 追加事件中间件，对所有类型的事件生效，先添加的中间件在外层，可以在连接后随时添加
+func (c *LiveClient) Use(mw ...Middleware) {
+	c.middlewareMu.Lock()
+	defer c.middlewareMu.Unlock()
+	c.middlewares = append(c.middlewares, mw...)
+	h := Handler(c.callEventCallback)
+	for i := len(c.middlewares) - 1; i >= 0; i-- {
+		h = c.middlewares[i](h)
+	}
+	c.eventChain.Store(&h)
+}
+
+// callEventCallback 中间件链的末端，根据事件类型触发对应的回调，然后交给匹配的路由处理
+func (c *LiveClient) callEventCallback(e Event) error {
+	switch data := e.Data.(type) {
+	case Danmaku:
+		callIfSet(c.OnDanmaku, data)
+	case Gift:
+		callIfSet(c.OnGift, data)
+	case SuperChat:
+		callIfSet(c.OnSuperChat, data)
+	case SuperChatDel:
+		callIfSet(c.OnSuperChatDel, data)
+	case Guard:
+		callIfSet(c.OnGuard, data)
+	case Like:
+		callIfSet(c.OnLike, data)
+	default:
+		return fmt.Errorf("unsupported event data %T", e.Data)
+	}
+	return c.dispatchRoutes(e)
+}
+
+func callIfSet[T any](callback func(T), event T) {
+	if callback != nil {
+		callback(event)
+	}
+}
+
+// RecoverMiddleware 捕获后续 Handler 中的 panic，记录日志和调用栈后转为错误返回，避免整个进程崩溃
+//
+// LiveClient 默认已经在整个分发流程外层捕获 panic，该中间件用于在中间件链内部提前拦截，
+// 使外层的中间件仍然可以观察到转换后的错误
+func RecoverMiddleware() Middleware {
+	return func(next Handler) Handler {
+		return func(e Event) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					zap.L().Error("event handler panic", zap.String("cmd", e.Cmd),
+						zap.Any("panic", r), zap.Stack("stack"))
+					err = fmt.Errorf("event handler panic: %v", r)
+				}
+			}()
+			return next(e)
+		}
+	}
+}
+
+// TimingMiddleware 统计后续 Handler 的耗时，超过 slow 时输出警告日志，slow 小于等于 0 时不输出，
+// observe 不为空时每个事件都会回调耗时，可以用于上报监控
+func TimingMiddleware(slow time.Duration, observe func(cmd string, elapsed time.Duration)) Middleware {
+	return func(next Handler) Handler {
+		return func(e Event) error {
+			start := time.Now()
+			err := next(e)
+			elapsed := time.Since(start)
+			if slow > 0 && elapsed >= slow {
+				zap.L().Warn("slow event handler", zap.String("cmd", e.Cmd),
+					zap.Duration("elapsed", elapsed), zap.Duration("threshold", slow))
+			}
+			if observe != nil {
+				observe(e.Cmd, elapsed)
+			}
+			return err
+		}
+	}
+}
+
+// SamplingMiddleware 按 rate 的比例随机放行事件，rate 取值 [0, 1]，
+// cmds 为空时对所有事件采样，否则只对指定的 cmd 采样，其余事件直接放行
+func SamplingMiddleware(rate float64, cmds ...string) Middleware {
+	sampled := make(map[string]bool, len(cmds))
+	for _, cmd := range cmds {
+		sampled[cmd] = true
+	}
+	return func(next Handler) Handler {
+		return func(e Event) error {
+			if (len(sampled) == 0 || sampled[e.Cmd]) && rand.Float64() >= rate {
+				return nil
+			}
+			return next(e)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package biliopen
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareChain(t *testing.T) {
+	var trace []string
+	tag := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(e Event) error {
+				trace = append(trace, name+":"+e.Cmd)
+				return next(e)
+			}
+		}
+	}
+	var gifts []Gift
+	c := &LiveClient{OnGift: func(g Gift) { gifts = append(gifts, g) }}
+	c.Use(tag("a"), tag("b"))
+	if err := c.handleCmd(CmdLiveOpenPlatformSendGift, []byte(`{"gift_name":"x"}`)); err != nil {
+		t.Fatal(err)
+	}
+	// 没有设置回调的事件也会经过中间件
+	if err := c.handleCmd(CmdLiveOpenPlatformLike, []byte(`{"like_count":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	want := "a:" + CmdLiveOpenPlatformSendGift + ",b:" + CmdLiveOpenPlatformSendGift +
+		",a:" + CmdLiveOpenPlatformLike + ",b:" + CmdLiveOpenPlatformLike
+	if got := strings.Join(trace, ","); got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+	if len(gifts) != 1 || gifts[0].GiftName != "x" {
+		t.Fatalf("unexpected gifts %+v", gifts)
+	}
+}
+
+func TestRecoverMiddleware(t *testing.T) {
+	var elapsed []string
+	c := &LiveClient{OnDanmaku: func(Danmaku) { panic("boom") }}
+	c.Use(RecoverMiddleware(), TimingMiddleware(time.Nanosecond, func(cmd string, _ time.Duration) {
+		elapsed = append(elapsed, cmd)
+	}))
+	err := c.handleCmd(CmdLiveOpenPlatformDm, []byte(`{"msg":"hi"}`))
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("expect panic converted to error, got %v", err)
+	}
+	// panic 发生在 TimingMiddleware 内层，耗时不会被记录
+	if len(elapsed) != 0 {
+		t.Fatalf("unexpected timing %v", elapsed)
+	}
+}
+
+func TestDefaultRecover(t *testing.T) {
+	c := &LiveClient{
+		StrictSchema:  true,
+		OnSchemaDrift: func(string, []string, []string) { panic("drift") },
+	}
+	err := c.handleCmd(CmdLiveOpenPlatformDm, []byte(`{"msg":"hi"}`))
+	if err == nil || !strings.Contains(err.Error(), "drift") {
+		t.Fatalf("expect OnSchemaDrift panic converted to error, got %v", err)
+	}
+	// 去重存储中的 panic 同样被捕获
+	c = &LiveClient{Dedup: &Deduplicator{Store: panicDedupStore{}}, OnDanmaku: func(Danmaku) {}}
+	if err = c.handleCmd(CmdLiveOpenPlatformDm, []byte(`{"msg_id":"a"}`)); err == nil || !strings.Contains(err.Error(), "store") {
+		t.Fatalf("expect store panic converted to error, got %v", err)
+	}
+	c.DisableRecover = true
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatal("expect panic with DisableRecover")
+		}
+	}()
+	_ = c.handleCmd(CmdLiveOpenPlatformDm, []byte(`{"msg_id":"b"}`))
+}
+
+type panicDedupStore struct{}
+
+func (panicDedupStore) CheckAndAdd(string, time.Duration) (bool, error) {
+	panic("store")
+}
+
+func TestSamplingMiddleware(t *testing.T) {
+	var dms, likes int
+	c := &LiveClient{
+		OnDanmaku: func(Danmaku) { dms++ },
+		OnLike:    func(Like) { likes++ },
+	}
+	c.Use(SamplingMiddleware(0, CmdLiveOpenPlatformLike))
+	for i := 0; i < 10; i++ {
+		_ = c.handleCmd(CmdLiveOpenPlatformDm, []byte(`{}`))
+		_ = c.handleCmd(CmdLiveOpenPlatformLike, []byte(`{}`))
+	}
+	if dms != 10 || likes != 0 {
+		t.Fatalf("expect all danmaku and no like, got %d danmaku and %d like", dms, likes)
+	}
+}
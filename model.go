@@ -1,45 +1,162 @@
 package biliopen
 
-// TODO 需要对齐 https://open-live.bilibili.com/document/f9ce25be-312e-1f4a-85fd-fef21f1637f8 模型定义
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 模型定义对齐 https://open-live.bilibili.com/document/f9ce25be-312e-1f4a-85fd-fef21f1637f8
+//
+// 带有 schema:"optional" 标签的字段表示消息中不一定下发，严格模式下缺失时不会视为结构漂移
+
+// Bool 兼容以 0/1 数字或 true/false 表示的布尔值，官方消息中两种形式都有出现
+type Bool bool
+
+func (b *Bool) UnmarshalJSON(data []byte) error {
+	switch string(bytes.TrimSpace(data)) {
+	case "true", "1", `"1"`, `"true"`:
+		*b = true
+	case "false", "0", `"0"`, `"false"`, `""`, "null":
+		*b = false
+	default:
+		return fmt.Errorf("invalid bool value: %s", data)
+	}
+	return nil
+}
+
+// UserInfo 用户信息，在多个消息模型中共用
+//
+// 开放平台正在从 UID 迁移到 OpenID，迁移期间两者可能同时存在，也可能只有其中一个，
+// 建议使用 Identity 作为用户的唯一标识
+type UserInfo struct {
+	// UID 用户 UID，迁移到 OpenID 后可能为 0
+	UID int `json:"uid"`
+	// OpenID 用户在当前应用下的唯一标识
+	OpenID string `json:"open_id"`
+	// UnionID 用户在同一开发者账号下的唯一标识
+	UnionID string `json:"union_id"`
+	// Username 用户名
+	Username string `json:"uname"`
+	// UserFace 用户头像
+	UserFace string `json:"uface"`
+}
+
+// Identity 用户唯一标识，优先使用 OpenID，没有时退化为 "uid:<UID>"，两者都没有时返回空字符串
+//
+// 迁移期间同一用户可能先后以两种标识出现，需要稳定的标识时配合 IdentityMap 使用
+func (u UserInfo) Identity() string {
+	if u.OpenID != "" {
+		return u.OpenID
+	}
+	if u.UID != 0 {
+		return "uid:" + strconv.Itoa(u.UID)
+	}
+	return ""
+}
+
+// Aliases 用户所有可能的标识，依次为 OpenID 和 "uid:<UID>"，用于按任意一种标识查找迁移前保存的数据
+func (u UserInfo) Aliases() []string {
+	var aliases []string
+	if u.OpenID != "" {
+		aliases = append(aliases, u.OpenID)
+	}
+	if u.UID != 0 {
+		aliases = append(aliases, "uid:"+strconv.Itoa(u.UID))
+	}
+	return aliases
+}
+
+// FansMedal 粉丝勋章信息，在多个消息模型中共用
+type FansMedal struct {
+	// FansMedalLevel 粉丝牌等级
+	FansMedalLevel int `json:"fans_medal_level"`
+	// FansMedalName 粉丝牌名称
+	FansMedalName string `json:"fans_medal_name"`
+	// FansMedalWearingStatus 粉丝牌是否穿戴，穿戴的是当前主播的粉丝牌时为 true
+	FansMedalWearingStatus bool `json:"fans_medal_wearing_status"`
+}
+
+// GuardLevel 大航海等级，数值越小等级越高
+type GuardLevel int
+
+const (
+	// GuardLevelNone 非大航海
+	GuardLevelNone GuardLevel = 0
+	// GuardLevelGovernor 总督
+	GuardLevelGovernor GuardLevel = 1
+	// GuardLevelAdmiral 提督
+	GuardLevelAdmiral GuardLevel = 2
+	// GuardLevelCaptain 舰长
+	GuardLevelCaptain GuardLevel = 3
+)
+
+// IsGuard 是否为大航海成员
+func (l GuardLevel) IsGuard() bool {
+	return l >= GuardLevelGovernor && l <= GuardLevelCaptain
+}
+
+// AtLeast 是否为大航海成员并且等级不低于 min，例如 GuardLevelAdmiral.AtLeast(GuardLevelCaptain) 为 true
+func (l GuardLevel) AtLeast(min GuardLevel) bool {
+	return l.IsGuard() && l <= min
+}
+
+func (l GuardLevel) String() string {
+	switch l {
+	case GuardLevelNone:
+		return "无"
+	case GuardLevelGovernor:
+		return "总督"
+	case GuardLevelAdmiral:
+		return "提督"
+	case GuardLevelCaptain:
+		return "舰长"
+	default:
+		return "未知(" + strconv.Itoa(int(l)) + ")"
+	}
+}
 
 // Danmaku 弹幕信息
 type Danmaku struct {
+	UserInfo
+	FansMedal
+
 	// Timestamp 时间戳
 	Timestamp int `json:"timestamp"`
 	// RoomID 直播间 ID
 	RoomID int `json:"room_id"`
 
-	// UID 用户 UID
-	UID int `json:"uid"`
-	// Username 用户名
-	Username string `json:"uname"`
-	// UserFace 用户头像
-	UserFace string `json:"uface"`
-	// Admin 是否房管
-	Admin int `json:"admin"`
-	// Vip 是否月费会员
-	Vip int `json:"vip"`
-	// SVip 是否年费会员
-	SVip int `json:"svip"`
+	// Admin 是否房管，对应官方的 is_admin 字段，旧版本中为 int 类型的 admin 字段
+	Admin Bool `json:"is_admin"`
+	// Vip 是否月费会员，新版消息中已不再下发
+	Vip Bool `json:"vip" schema:"optional"`
+	// SVip 是否年费会员，新版消息中已不再下发
+	SVip Bool `json:"svip" schema:"optional"`
+	// GuardLevel 大航海等级
+	GuardLevel GuardLevel `json:"guard_level"`
+	// GloryLevel 荣耀等级
+	GloryLevel int `json:"glory_level"`
+	// IsMystery 是否为神秘人
+	IsMystery Bool `json:"is_mystery" schema:"optional"`
 
 	// MsgType 是否礼物弹幕（节奏风暴）
-	MsgType int `json:"msg_type"`
+	MsgType int `json:"msg_type" schema:"optional"`
 	// DMType 弹幕类型，枚举值参考 DanmakuType 类型常量
 	DMType DanmakuType `json:"dm_type"`
 
 	// Message 弹幕内容
 	Message string `json:"msg"`
-	// MessageID 弹幕 ID，猜测用于去重
+	// MessageID 消息唯一 ID，可用于去重
 	MessageID string `json:"msg_id"`
 	// EmojiImgUrl 表情地址
 	EmojiImgUrl string `json:"emoji_img_url"`
 
-	// FansMedalLevel 粉丝牌等级
-	FansMedalLevel int `json:"fans_medal_level"`
-	// FansMedalName 粉丝牌名称
-	FansMedalName string `json:"fans_medal_name"`
-	// FansMedalWearingStatus 粉丝牌是否穿戴
-	FansMedalWearingStatus bool `json:"fans_medal_wearing_status"`
+	// ReplyOpenID 被回复用户的 OpenID
+	ReplyOpenID string `json:"reply_open_id"`
+	// ReplyUsername 被回复用户的用户名
+	ReplyUsername string `json:"reply_uname"`
 }
 
 // DanmakuType 弹幕类型
@@ -53,3 +170,202 @@ const (
 	// DanmakuTypeVoice 语音
 	DanmakuTypeVoice DanmakuType = 2
 )
+
+// Gift 礼物信息
+type Gift struct {
+	UserInfo
+	FansMedal
+
+	// Timestamp 时间戳
+	Timestamp int `json:"timestamp"`
+	// RoomID 直播间 ID
+	RoomID int `json:"room_id"`
+	// MessageID 消息唯一 ID，可用于去重
+	MessageID string `json:"msg_id"`
+
+	// GiftID 礼物 ID
+	GiftID int `json:"gift_id"`
+	// GiftName 礼物名称
+	GiftName string `json:"gift_name"`
+	// GiftNum 礼物数量
+	GiftNum int `json:"gift_num"`
+	// GiftIcon 礼物图标
+	GiftIcon string `json:"gift_icon"`
+	// Price 礼物单价，1000 = 1 元 = 10 电池，盲盒为爆出礼物的价值
+	Price int `json:"price"`
+	// RPrice 礼物实际单价，盲盒为购买盲盒的价格，单位同 Price
+	RPrice int `json:"r_price"`
+	// Paid 是否为付费礼物
+	Paid Bool `json:"paid"`
+	// GuardLevel 送礼用户的大航海等级
+	GuardLevel GuardLevel `json:"guard_level"`
+
+	// ComboGift 是否为连击礼物
+	ComboGift Bool `json:"combo_gift"`
+	// ComboInfo 连击信息
+	ComboInfo GiftComboInfo `json:"combo_info"`
+	// BlindGift 盲盒信息
+	BlindGift BlindGiftInfo `json:"blind_gift"`
+
+	// AnchorInfo 收礼主播信息
+	AnchorInfo UserInfo `json:"anchor_info"`
+}
+
+// TotalPrice 礼物总价值，单位同 Price，盲盒为爆出礼物的总价值
+func (g Gift) TotalPrice() int64 {
+	return int64(g.Price) * int64(g.GiftNum)
+}
+
+// PaidPrice 用户实际支付的总金额，单位同 Price，盲盒按 RPrice 计算，其余礼物同 TotalPrice
+func (g Gift) PaidPrice() int64 {
+	if g.BlindGift.Status && g.RPrice > 0 {
+		return int64(g.RPrice) * int64(g.GiftNum)
+	}
+	return g.TotalPrice()
+}
+
+// GiftComboInfo 礼物连击信息
+type GiftComboInfo struct {
+	// ComboBaseNum 每次连击赠送的数量
+	ComboBaseNum int `json:"combo_base_num"`
+	// ComboCount 连击次数
+	ComboCount int `json:"combo_count"`
+	// ComboID 连击 ID
+	ComboID string `json:"combo_id"`
+	// ComboTimeout 连击有效期，单位秒
+	ComboTimeout int `json:"combo_timeout"`
+}
+
+// BlindGiftInfo 盲盒信息
+type BlindGiftInfo struct {
+	// BlindGiftID 盲盒 ID
+	BlindGiftID int `json:"blind_gift_id"`
+	// Status 是否为盲盒
+	Status Bool `json:"status"`
+}
+
+// SuperChat 醒目留言
+type SuperChat struct {
+	UserInfo
+	FansMedal
+
+	// Timestamp 时间戳
+	Timestamp int `json:"timestamp"`
+	// RoomID 直播间 ID
+	RoomID int `json:"room_id"`
+	// MessageID 消息唯一 ID，可用于去重
+	MessageID string `json:"msg_id"`
+
+	// SuperChatID 醒目留言 ID，对应 SuperChatDel.SuperChatIDs
+	SuperChatID int64 `json:"message_id"`
+	// Message 留言内容
+	Message string `json:"message"`
+	// RMB 支付金额，单位元
+	RMB int `json:"rmb"`
+	// StartTime 生效开始时间
+	StartTime int `json:"start_time"`
+	// EndTime 生效结束时间
+	EndTime int `json:"end_time"`
+	// GuardLevel 用户的大航海等级
+	GuardLevel GuardLevel `json:"guard_level"`
+}
+
+// SuperChatDel 醒目留言下线
+type SuperChatDel struct {
+	// RoomID 直播间 ID
+	RoomID int `json:"room_id"`
+	// MessageID 消息唯一 ID，可用于去重
+	MessageID string `json:"msg_id"`
+	// SuperChatIDs 下线的醒目留言 ID 列表
+	SuperChatIDs []int64 `json:"message_ids"`
+}
+
+// Guard 大航海购买信息
+type Guard struct {
+	UserInfo `json:"user_info"`
+	FansMedal
+
+	// Timestamp 时间戳
+	Timestamp int `json:"timestamp"`
+	// RoomID 直播间 ID
+	RoomID int `json:"room_id"`
+	// MessageID 消息唯一 ID，可用于去重
+	MessageID string `json:"msg_id"`
+
+	// GuardLevel 购买的大航海等级
+	GuardLevel GuardLevel `json:"guard_level"`
+	// GuardNum 购买数量
+	GuardNum int `json:"guard_num"`
+	// GuardUnit 购买单位，例如“月”
+	GuardUnit string `json:"guard_unit"`
+	// Price 本次购买的支付金额，已经包含 GuardNum 个单位，1000 = 1 元 = 10 电池
+	Price int `json:"price"`
+}
+
+// Duration 本次购买的大航海总时长，见 GuardDuration
+func (g Guard) Duration() (time.Duration, error) {
+	return GuardDuration(g.GuardNum, g.GuardUnit)
+}
+
+const (
+	// GuardMonth 大航海 1 个月的时长
+	GuardMonth = time.Hour * 24 * 30
+	// GuardDay 大航海 1 天的时长
+	GuardDay = time.Hour * 24
+)
+
+// GuardUnitDuration 大航海购买单位对应的时长，支持“月”、“周”、“天”，无法识别时返回错误
+func GuardUnitDuration(unit string) (time.Duration, error) {
+	switch unit {
+	case "月", "个月", "month":
+		return GuardMonth, nil
+	case "天", "日", "day":
+		return GuardDay, nil
+	case "周", "week":
+		return GuardDay * 7, nil
+	default:
+		return 0, fmt.Errorf("unknown guard unit %q", unit)
+	}
+}
+
+// GuardDuration 一次购买的总时长，unit 为单位时为 num 个单位，num 小于等于 0 时按 1 计算；
+// unit 为 "*N<单位>" 形式时，例如 "*3天"，时长固定为 N 个单位，忽略 num
+func GuardDuration(num int, unit string) (time.Duration, error) {
+	if rest, ok := strings.CutPrefix(unit, "*"); ok {
+		i := 0
+		for i < len(rest) && rest[i] >= '0' && rest[i] <= '9' {
+			i++
+		}
+		n, err := strconv.Atoi(rest[:i])
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid guard unit %q", unit)
+		}
+		num, unit = n, rest[i:]
+	}
+	d, err := GuardUnitDuration(unit)
+	if err != nil {
+		return 0, err
+	}
+	if num <= 0 {
+		num = 1
+	}
+	return d * time.Duration(num), nil
+}
+
+// Like 点赞信息
+type Like struct {
+	UserInfo
+	FansMedal
+
+	// Timestamp 时间戳
+	Timestamp int `json:"timestamp"`
+	// RoomID 直播间 ID
+	RoomID int `json:"room_id"`
+	// MessageID 消息唯一 ID，可用于去重
+	MessageID string `json:"msg_id"`
+
+	// LikeText 点赞文案
+	LikeText string `json:"like_text"`
+	// LikeCount 点赞次数
+	LikeCount int `json:"like_count"`
+}
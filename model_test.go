@@ -0,0 +1,121 @@
+package biliopen
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecodeEventModels(t *testing.T) {
+	var dm Danmaku
+	err := StdCodec{}.Unmarshal([]byte(`{"uid":0,"open_id":"oid","union_id":"uid","uname":"user","is_admin":1,"guard_level":3,"glory_level":5,"fans_medal_level":21,"fans_medal_wearing_status":true,"reply_open_id":"r","reply_uname":"ru","msg":"hi","is_mystery":false}`), &dm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dm.Admin || dm.GuardLevel != GuardLevelCaptain || dm.GloryLevel != 5 || dm.ReplyOpenID != "r" || dm.IsMystery {
+		t.Fatalf("unexpected danmaku %+v", dm)
+	}
+	if dm.Identity() != "oid" || dm.FansMedalLevel != 21 || !dm.FansMedalWearingStatus {
+		t.Fatalf("unexpected user info %+v", dm)
+	}
+
+	var guard Guard
+	err = StdCodec{}.Unmarshal([]byte(`{"user_info":{"uid":42,"uname":"captain"},"guard_level":2,"guard_num":1,"guard_unit":"月","price":198000,"fans_medal_level":3}`), &guard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if guard.Identity() != "uid:42" || guard.Username != "captain" || guard.GuardLevel != GuardLevelAdmiral || guard.FansMedalLevel != 3 {
+		t.Fatalf("unexpected guard %+v", guard)
+	}
+
+	var gift Gift
+	err = StdCodec{}.Unmarshal([]byte(`{"open_id":"oid","gift_num":3,"price":100,"paid":true,"combo_gift":false,"blind_gift":{"blind_gift_id":1,"status":true},"anchor_info":{"uid":1}}`), &gift)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gift.TotalPrice() != 300 || !gift.Paid || !gift.BlindGift.Status || gift.AnchorInfo.UID != 1 {
+		t.Fatalf("unexpected gift %+v", gift)
+	}
+}
+
+func TestGuardLevel(t *testing.T) {
+	if !GuardLevelGovernor.AtLeast(GuardLevelCaptain) || GuardLevelCaptain.AtLeast(GuardLevelAdmiral) || GuardLevelNone.AtLeast(GuardLevelCaptain) {
+		t.Fatal("unexpected AtLeast result")
+	}
+	if GuardLevel(4).IsGuard() {
+		t.Fatal("unexpected guard level")
+	}
+}
+
+func TestSchemaDrift(t *testing.T) {
+	type report struct {
+		cmd              string
+		unknown, missing []string
+	}
+	var reports []report
+	c := &LiveClient{
+		StrictSchema: true,
+		OnSchemaDrift: func(cmd string, unknown, missing []string) {
+			reports = append(reports, report{cmd, unknown, missing})
+		},
+	}
+	complete := `"uid":1,"open_id":"","union_id":"","uname":"","uface":"","fans_medal_level":0,"fans_medal_name":"","fans_medal_wearing_status":false,"timestamp":0,"room_id":0,"is_admin":0,"guard_level":0,"dm_type":0,"msg":"","msg_id":"","emoji_img_url":"","reply_open_id":"","reply_uname":""`
+	if err := c.handleCmd(CmdLiveOpenPlatformDm, []byte(`{`+complete+`,"glory_level":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 0 {
+		t.Fatalf("expect no drift for complete message, got %+v", reports)
+	}
+	for i := 0; i < 2; i++ {
+		if err := c.handleCmd(CmdLiveOpenPlatformDm, []byte(`{`+complete+`,"new_b":1,"new_a":{"x":1}}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(reports) != 1 {
+		t.Fatalf("expect drift to be reported once, got %+v", reports)
+	}
+	r := reports[0]
+	if r.cmd != CmdLiveOpenPlatformDm || len(r.unknown) != 2 || r.unknown[0] != "new_a" || r.unknown[1] != "new_b" ||
+		len(r.missing) != 1 || r.missing[0] != "glory_level" {
+		t.Fatalf("unexpected drift report %+v", r)
+	}
+
+	reports = nil
+	if err := c.handleCmd(CmdLiveOpenPlatformGuard, []byte(`{"user_info":{"uid":1,"extra":true}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 || len(reports[0].unknown) != 1 || reports[0].unknown[0] != "user_info.extra" {
+		t.Fatalf("expect nested unknown field, got %+v", reports)
+	}
+
+	// 可选字段只影响漂移检测，不改变模型的序列化结果
+	data, err := StdCodec{}.Marshal(Danmaku{})
+	if err != nil || !strings.Contains(string(data), `"vip":false`) || !strings.Contains(string(data), `"msg_type":0`) {
+		t.Fatalf("unexpected marshaled danmaku %s %v", data, err)
+	}
+}
+
+func TestGuardDuration(t *testing.T) {
+	for _, c := range []struct {
+		num  int
+		unit string
+		want time.Duration
+	}{
+		{1, "月", GuardMonth},
+		{3, "月", GuardMonth * 3},
+		{0, "周", GuardDay * 7},
+		{2, "天", GuardDay * 2},
+		// "*N<单位>" 形式忽略 guard_num
+		{1, "*3天", GuardDay * 3},
+		{5, "*2月", GuardMonth * 2},
+	} {
+		if d, err := GuardDuration(c.num, c.unit); err != nil || d != c.want {
+			t.Fatalf("GuardDuration(%d, %q) = %v %v, want %v", c.num, c.unit, d, err, c.want)
+		}
+	}
+	for _, unit := range []string{"", "年", "*天", "*0天", "*3年"} {
+		if _, err := GuardDuration(1, unit); err == nil {
+			t.Fatalf("expect error for unit %q", unit)
+		}
+	}
+}
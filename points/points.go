@@ -0,0 +1,380 @@
+// Package points 观众积分系统
+//
+// 观众通过发送弹幕、每日签到、送礼和开通大航海获得积分，通过命令查询余额和兑换奖励，
+// 所有积分变动都会记录为只追加的流水，存储可以替换为 MemoryStore、FileStore 或者自定义的 Store：
+//
+//	store, err := points.OpenFileStore("points.jsonl")
+//	e := &points.Economy{
+//		Store:             store,
+//		DanmakuPoints:     1,
+//		DanmakuInterval:   time.Minute,
+//		DanmakuDailyCap:   100,
+//		CheckInPoints:     10,
+//		GiftPointsPerYuan: 10,
+//		GuardPoints:       map[biliopen.GuardLevel]int64{biliopen.GuardLevelCaptain: 1000},
+//		Rewards:           []points.Reward{{Name: "点歌", Cost: 100}},
+//	}
+//	e.Attach(client)
+//	dispatcher.MustRegister(e.Commands()...)
+package points
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	biliopen "github.com/fython/bili-open-live-go"
+	"github.com/fython/bili-open-live-go/command"
+)
+
+var defaultCheckInKeywords = []string{"签到"}
+
+// ErrUnknownReward 没有对应的奖励
+var ErrUnknownReward = errors.New("unknown reward")
+
+// Reward 可兑换的奖励
+type Reward struct {
+	// Name 奖励名称，兑换时忽略大小写
+	Name string `json:"name"`
+	// Cost 消耗的积分
+	Cost int64 `json:"cost"`
+}
+
+// Economy 积分系统，零值可以直接使用但不会发放积分，并发安全
+type Economy struct {
+	// Store 积分存储，默认为 MemoryStore
+	Store Store
+
+	// DanmakuPoints 每条文字弹幕获得的积分，签到和以 ! 开头的命令弹幕不计
+	DanmakuPoints int64
+	// DanmakuInterval 同一用户两次通过弹幕获得积分的最短间隔，防止刷屏
+	DanmakuInterval time.Duration
+	// DanmakuDailyCap 同一用户每天通过弹幕获得的积分上限，为 0 时不限制，进程重启后重新计算
+	DanmakuDailyCap int64
+	// CheckInKeywords 签到弹幕，默认为 "签到"
+	CheckInKeywords []string
+	// CheckInPoints 每日签到获得的积分，为 0 时不支持签到
+	CheckInPoints int64
+	// GiftPointsPerYuan 付费礼物每 1 元获得的积分
+	GiftPointsPerYuan int64
+	// GuardPoints 开通大航海每月获得的积分，按周、天购买时按时长折算，无法识别的购买单位返回错误
+	GuardPoints map[biliopen.GuardLevel]int64
+	// Rewards 可兑换的奖励
+	Rewards []Reward
+	// Location 计算签到和每日上限的时区，默认为 time.Local
+	Location *time.Location
+
+	// OnTransaction 积分变动时回调
+	OnTransaction func(tx Transaction)
+	// OnCheckIn 签到时回调，first 为 false 表示当天已经签到过
+	OnCheckIn func(user biliopen.UserInfo, first bool, balance int64)
+	// OnBalance 观众通过命令查询余额时回调
+	OnBalance func(user biliopen.UserInfo, balance int64)
+	// OnRedeem 观众兑换奖励成功时回调
+	OnRedeem func(user biliopen.UserInfo, reward Reward, tx Transaction)
+
+	mu          sync.Mutex
+	store       Store
+	activity    map[string]*danmakuActivity
+	activityDay string
+
+	// now 测试时替换当前时间
+	now func() time.Time
+}
+
+// danmakuActivity 用户当天通过弹幕获得积分的情况
+type danmakuActivity struct {
+	last   time.Time
+	earned int64
+}
+
+func (e *Economy) getStore() Store {
+	if e.Store != nil {
+		return e.Store
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.store == nil {
+		e.store = &MemoryStore{}
+	}
+	return e.store
+}
+
+func (e *Economy) getNow() time.Time {
+	if e.now != nil {
+		return e.now()
+	}
+	return time.Now()
+}
+
+func (e *Economy) getCheckInKeywords() []string {
+	if len(e.CheckInKeywords) == 0 {
+		return defaultCheckInKeywords
+	}
+	return e.CheckInKeywords
+}
+
+// day 当前日期，例如 2006-01-02
+func (e *Economy) day(t time.Time) string {
+	loc := e.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	return t.In(loc).Format("2006-01-02")
+}
+
+// Attach 注册弹幕、礼物和大航海路由，返回的 RouteID 可以用于 RemoveRoute
+func (e *Economy) Attach(c *biliopen.LiveClient) biliopen.RouteID {
+	return c.Route(biliopen.IsCmd(
+		biliopen.CmdLiveOpenPlatformDm,
+		biliopen.CmdLiveOpenPlatformSendGift,
+		biliopen.CmdLiveOpenPlatformGuard,
+	), e.Handle)
+}
+
+// Handle 处理弹幕、礼物和大航海事件，可以作为 biliopen.Handler 使用，重复推送的消息按 msg_id 只计一次
+func (e *Economy) Handle(ev biliopen.Event) error {
+	var err error
+	switch data := ev.Data.(type) {
+	case biliopen.Danmaku:
+		err = e.handleDanmaku(data)
+	case biliopen.Gift:
+		if amount := biliopen.EventValue(ev) * e.GiftPointsPerYuan / 1000; amount > 0 {
+			_, err = e.Earn(data.UserInfo, amount, ReasonGift, data.MessageID, data.GiftName)
+		}
+	case biliopen.Guard:
+		if amount := e.GuardPoints[data.GuardLevel]; amount > 0 {
+			var d time.Duration
+			if d, err = data.Duration(); err != nil {
+				return fmt.Errorf("guard points fail: %w", err)
+			}
+			// 按购买时长折算月数，不足一个月的部分按天计算
+			months, days := d/biliopen.GuardMonth, d%biliopen.GuardMonth/biliopen.GuardDay
+			amount = amount*int64(months) + amount*int64(days)/int64(biliopen.GuardMonth/biliopen.GuardDay)
+			if amount > 0 {
+				_, err = e.Earn(data.UserInfo, amount, ReasonGuard, data.MessageID, data.GuardLevel.String())
+			}
+		}
+	}
+	if errors.Is(err, ErrDuplicate) {
+		return nil
+	}
+	return err
+}
+
+func (e *Economy) handleDanmaku(dm biliopen.Danmaku) error {
+	if dm.DMType != biliopen.DanmakuTypeText {
+		return nil
+	}
+	msg := strings.TrimSpace(dm.Message)
+	for _, kw := range e.getCheckInKeywords() {
+		if e.CheckInPoints > 0 && msg == kw {
+			_, err := e.CheckIn(dm.UserInfo)
+			return err
+		}
+	}
+	if e.DanmakuPoints <= 0 || strings.HasPrefix(msg, "!") || strings.HasPrefix(msg, "！") {
+		return nil
+	}
+	return e.earnDanmaku(dm)
+}
+
+// earnDanmaku 按间隔和每日上限发放弹幕积分
+func (e *Economy) earnDanmaku(dm biliopen.Danmaku) error {
+	id := dm.Identity()
+	if id == "" {
+		return nil
+	}
+	store := e.getStore()
+	now := e.getNow()
+	day := e.day(now)
+	tx, err := e.earnDanmakuLocked(store, id, dm, now, day)
+	if err != nil || tx.ID == 0 {
+		return err
+	}
+	if e.OnTransaction != nil {
+		e.OnTransaction(tx)
+	}
+	return nil
+}
+
+// earnDanmakuLocked 在锁内检查间隔和上限并写入流水，没有发放积分时返回零值
+func (e *Economy) earnDanmakuLocked(store Store, id string, dm biliopen.Danmaku, now time.Time, day string) (Transaction, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.activity == nil || e.activityDay != day {
+		// 跨天后清空前一天的记录
+		e.activity = make(map[string]*danmakuActivity)
+		e.activityDay = day
+	}
+	a := e.activity[id]
+	if a == nil {
+		a = &danmakuActivity{}
+		e.activity[id] = a
+	}
+	if !a.last.IsZero() && now.Sub(a.last) < e.DanmakuInterval {
+		return Transaction{}, nil
+	}
+	amount := e.DanmakuPoints
+	if e.DanmakuDailyCap > 0 {
+		if remaining := e.DanmakuDailyCap - a.earned; remaining < amount {
+			amount = remaining
+		}
+	}
+	if amount <= 0 {
+		return Transaction{}, nil
+	}
+	tx, err := store.Apply(Transaction{
+		Identity: id, Username: dm.Username, Amount: amount, Reason: ReasonDanmaku, Ref: dm.MessageID, Time: now,
+	})
+	if err != nil {
+		return tx, err
+	}
+	a.last = now
+	a.earned += amount
+	return tx, nil
+}
+
+// Earn 为用户增加积分，ref 不为空时同一用户相同 ref 只记录一次
+func (e *Economy) Earn(user biliopen.UserInfo, amount int64, reason Reason, ref, note string) (Transaction, error) {
+	if amount <= 0 {
+		return Transaction{}, fmt.Errorf("invalid amount %d", amount)
+	}
+	return e.apply(user, amount, reason, ref, note)
+}
+
+// Adjust 手动调整积分，amount 为负数时扣减，余额不足时返回 ErrInsufficient
+func (e *Economy) Adjust(user biliopen.UserInfo, amount int64, note string) (Transaction, error) {
+	return e.apply(user, amount, ReasonAdjust, "", note)
+}
+
+func (e *Economy) apply(user biliopen.UserInfo, amount int64, reason Reason, ref, note string) (Transaction, error) {
+	tx, err := e.getStore().Apply(Transaction{
+		Identity: user.Identity(),
+		Username: user.Username,
+		Amount:   amount,
+		Reason:   reason,
+		Ref:      ref,
+		Note:     note,
+		Time:     e.getNow(),
+	})
+	if err != nil {
+		return tx, err
+	}
+	if e.OnTransaction != nil {
+		e.OnTransaction(tx)
+	}
+	return tx, nil
+}
+
+// CheckIn 每日签到，当天已经签到时返回 ErrDuplicate
+func (e *Economy) CheckIn(user biliopen.UserInfo) (Transaction, error) {
+	now := e.getNow()
+	tx, err := e.apply(user, e.CheckInPoints, ReasonCheckIn, "checkin:"+e.day(now), "")
+	first := err == nil
+	if err != nil && !errors.Is(err, ErrDuplicate) {
+		return tx, err
+	}
+	if e.OnCheckIn != nil {
+		balance := tx.Balance
+		if !first {
+			balance, _ = e.Balance(user.Identity())
+		}
+		e.OnCheckIn(user, first, balance)
+	}
+	return tx, err
+}
+
+// Balance 用户的余额
+func (e *Economy) Balance(identity string) (int64, error) {
+	return e.getStore().Balance(identity)
+}
+
+// Ledger 用户的流水，identity 为空时返回所有流水
+func (e *Economy) Ledger(identity string) ([]Transaction, error) {
+	return e.getStore().Ledger(identity)
+}
+
+// Reward 根据名称查找奖励，忽略大小写
+func (e *Economy) Reward(name string) (Reward, bool) {
+	for _, r := range e.Rewards {
+		if strings.EqualFold(r.Name, name) {
+			return r, true
+		}
+	}
+	return Reward{}, false
+}
+
+// Redeem 兑换奖励，奖励不存在时返回 ErrUnknownReward，积分不足时返回 ErrInsufficient
+func (e *Economy) Redeem(user biliopen.UserInfo, name string) (Transaction, error) {
+	reward, ok := e.Reward(name)
+	if !ok {
+		return Transaction{}, ErrUnknownReward
+	}
+	tx, err := e.apply(user, -reward.Cost, ReasonRedeem, "", reward.Name)
+	if err != nil {
+		return tx, err
+	}
+	if e.OnRedeem != nil {
+		e.OnRedeem(user, reward, tx)
+	}
+	return tx, nil
+}
+
+// Commands 查询余额和兑换奖励的命令，注册到 command.Dispatcher 后使用：
+//
+//	!积分        查询余额，回调 OnBalance
+//	!兑换 点歌   兑换奖励，回调 OnRedeem，奖励不存在或积分不足时返回 command.UsageError
+func (e *Economy) Commands() []*command.Command {
+	return []*command.Command{
+		{
+			Name:    "积分",
+			Aliases: []string{"points"},
+			Handler: func(ctx *command.Context) error {
+				balance, err := e.Balance(ctx.Danmaku.Identity())
+				if err != nil {
+					return err
+				}
+				if e.OnBalance != nil {
+					e.OnBalance(ctx.Danmaku.UserInfo, balance)
+				}
+				return nil
+			},
+		},
+		{
+			Name:    "兑换",
+			Aliases: []string{"redeem"},
+			Args:    []command.Arg{{Name: "reward", Type: command.ArgRest}},
+			Handler: func(ctx *command.Context) error {
+				_, err := e.Redeem(ctx.Danmaku.UserInfo, ctx.String("reward"))
+				switch {
+				case errors.Is(err, ErrUnknownReward):
+					return &command.UsageError{Usage: e.rewardsUsage(ctx), Reason: "没有这个奖励"}
+				case errors.Is(err, ErrInsufficient):
+					reward, _ := e.Reward(ctx.String("reward"))
+					balance, _ := e.Balance(ctx.Danmaku.Identity())
+					return &command.UsageError{
+						Usage:  e.rewardsUsage(ctx),
+						Reason: fmt.Sprintf("积分不足，需要 %d，当前 %d", reward.Cost, balance),
+					}
+				case err != nil:
+					zap.L().Warn("redeem fail", zap.String("user", ctx.Danmaku.Identity()), zap.Error(err))
+				}
+				return err
+			},
+		},
+	}
+}
+
+// rewardsUsage 兑换命令的用法，列出所有奖励
+func (e *Economy) rewardsUsage(ctx *command.Context) string {
+	names := make([]string, len(e.Rewards))
+	for i, r := range e.Rewards {
+		names[i] = fmt.Sprintf("%s(%d)", r.Name, r.Cost)
+	}
+	return ctx.Prefix + ctx.Name + " <" + strings.Join(names, "|") + ">"
+}
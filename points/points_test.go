@@ -0,0 +1,191 @@
+package points
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	biliopen "github.com/fython/bili-open-live-go"
+	"github.com/fython/bili-open-live-go/command"
+)
+
+func dmEvent(uid int, msgID, msg string) biliopen.Event {
+	return biliopen.Event{Cmd: biliopen.CmdLiveOpenPlatformDm, Data: biliopen.Danmaku{
+		UserInfo: biliopen.UserInfo{UID: uid}, MessageID: msgID, Message: msg,
+	}}
+}
+
+func TestEconomy(t *testing.T) {
+	now := time.Date(2024, 5, 1, 23, 59, 0, 0, time.UTC)
+	var txs []Transaction
+	checkIns := map[bool]int{}
+	e := &Economy{
+		DanmakuPoints:     2,
+		DanmakuInterval:   time.Second * 10,
+		DanmakuDailyCap:   5,
+		CheckInPoints:     10,
+		GiftPointsPerYuan: 10,
+		GuardPoints:       map[biliopen.GuardLevel]int64{biliopen.GuardLevelCaptain: 100},
+		Rewards:           []Reward{{Name: "点歌", Cost: 50}},
+		Location:          time.UTC,
+		OnTransaction:     func(tx Transaction) { txs = append(txs, tx) },
+		OnCheckIn:         func(_ biliopen.UserInfo, first bool, _ int64) { checkIns[first]++ },
+		now:               func() time.Time { return now },
+	}
+	step := func(d time.Duration, ev biliopen.Event) {
+		t.Helper()
+		now = now.Add(d)
+		if err := e.Handle(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 间隔内的弹幕和重复推送的弹幕不计，每日上限 5
+	step(0, dmEvent(1, "m1", "hello"))
+	step(time.Second, dmEvent(1, "m2", "hello"))
+	step(time.Second*10, dmEvent(1, "m1", "hello"))
+	step(0, dmEvent(1, "m3", "hello"))
+	step(time.Second*10, dmEvent(1, "m4", "!积分"))
+	step(0, dmEvent(1, "m5", "hello"))
+	step(time.Second*10, dmEvent(1, "m6", "hello"))
+	if b, _ := e.Balance("uid:1"); b != 5 {
+		t.Fatalf("expect capped balance 5, got %d", b)
+	}
+	// 签到每天一次，跨天后重新计算
+	step(0, dmEvent(1, "m7", "签到"))
+	step(0, dmEvent(1, "m8", "签到"))
+	step(time.Minute, dmEvent(1, "m9", "签到"))
+	step(0, dmEvent(1, "m10", "hello"))
+	if b, _ := e.Balance("uid:1"); b != 27 || checkIns[true] != 2 || checkIns[false] != 1 {
+		t.Fatalf("unexpected balance %d, check-ins %v", b, checkIns)
+	}
+
+	gift := biliopen.Gift{UserInfo: biliopen.UserInfo{UID: 2}, MessageID: "g1", Price: 1000, GiftNum: 5, Paid: true}
+	step(0, biliopen.Event{Cmd: biliopen.CmdLiveOpenPlatformSendGift, Data: gift})
+	step(0, biliopen.Event{Cmd: biliopen.CmdLiveOpenPlatformSendGift, Data: gift})
+	step(0, biliopen.Event{Cmd: biliopen.CmdLiveOpenPlatformGuard, Data: biliopen.Guard{
+		UserInfo: biliopen.UserInfo{UID: 2}, MessageID: "g2", GuardLevel: biliopen.GuardLevelCaptain, GuardNum: 3, GuardUnit: "月",
+	}})
+	if b, _ := e.Balance("uid:2"); b != 350 {
+		t.Fatalf("expect 350, got %d", b)
+	}
+
+	if _, err := e.Redeem(biliopen.UserInfo{UID: 1}, "点歌"); !errors.Is(err, ErrInsufficient) {
+		t.Fatalf("expect ErrInsufficient, got %v", err)
+	}
+	if _, err := e.Redeem(biliopen.UserInfo{UID: 2}, "跳舞"); !errors.Is(err, ErrUnknownReward) {
+		t.Fatalf("expect ErrUnknownReward, got %v", err)
+	}
+	tx, err := e.Redeem(biliopen.UserInfo{UID: 2}, "点歌")
+	if err != nil || tx.Balance != 300 || tx.Amount != -50 || tx.Note != "点歌" {
+		t.Fatalf("unexpected redeem %+v %v", tx, err)
+	}
+	ledger, _ := e.Ledger("")
+	if len(ledger) != len(txs) || len(ledger) != 9 {
+		t.Fatalf("unexpected ledger %+v", ledger)
+	}
+}
+
+func TestEconomyGuardUnit(t *testing.T) {
+	e := &Economy{GuardPoints: map[biliopen.GuardLevel]int64{biliopen.GuardLevelCaptain: 300}}
+	guard := func(id string, uid, num int, unit string) biliopen.Event {
+		return biliopen.Event{Cmd: biliopen.CmdLiveOpenPlatformGuard, Data: biliopen.Guard{
+			UserInfo: biliopen.UserInfo{UID: uid}, MessageID: id, GuardLevel: biliopen.GuardLevelCaptain,
+			GuardNum: num, GuardUnit: unit,
+		}}
+	}
+	// 按时长折算：3 天为 30 积分，"*N<单位>" 形式忽略 guard_num，1 周为 70 积分
+	for _, c := range []struct {
+		ev   biliopen.Event
+		uid  string
+		want int64
+	}{
+		{guard("g1", 1, 1, "*3天"), "uid:1", 30},
+		{guard("g2", 2, 5, "*3天"), "uid:2", 30},
+		{guard("g3", 3, 1, "周"), "uid:3", 70},
+		{guard("g4", 4, 2, "月"), "uid:4", 600},
+	} {
+		if err := e.Handle(c.ev); err != nil {
+			t.Fatal(err)
+		}
+		if b, _ := e.Balance(c.uid); b != c.want {
+			t.Fatalf("expect %s balance %d, got %d", c.uid, c.want, b)
+		}
+	}
+	if err := e.Handle(guard("g5", 5, 1, "年")); err == nil {
+		t.Fatal("expect error for unknown guard unit")
+	}
+	if b, _ := e.Balance("uid:5"); b != 0 {
+		t.Fatalf("unknown unit should not earn points, got %d", b)
+	}
+}
+
+func TestEconomyCommands(t *testing.T) {
+	e := &Economy{Rewards: []Reward{{Name: "点歌", Cost: 50}}}
+	balances := map[string]int64{}
+	e.OnBalance = func(u biliopen.UserInfo, balance int64) { balances[u.Identity()] = balance }
+	d := &command.Dispatcher{}
+	d.MustRegister(e.Commands()...)
+	_, _ = e.Adjust(biliopen.UserInfo{UID: 1}, 60, "补偿")
+
+	dm := func(msg string) biliopen.Danmaku {
+		return biliopen.Danmaku{UserInfo: biliopen.UserInfo{UID: 1}, Message: msg}
+	}
+	if err := d.Dispatch(dm("!积分")); err != nil || balances["uid:1"] != 60 {
+		t.Fatalf("unexpected balance %v %v", balances, err)
+	}
+	if err := d.Dispatch(dm("!兑换 点歌")); err != nil {
+		t.Fatal(err)
+	}
+	var usage *command.UsageError
+	if err := d.Dispatch(dm("!兑换 点歌")); !errors.As(err, &usage) || usage.Usage != "!兑换 <点歌(50)>" {
+		t.Fatalf("expect usage error, got %v", err)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "points.jsonl")
+	s, err := OpenFileStore(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Apply(Transaction{Identity: "a", Amount: 10, Ref: "r1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Apply(Transaction{Identity: "a", Amount: -3}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Apply(Transaction{Identity: "a", Amount: 10, Ref: "r1"}); !errors.Is(err, ErrDuplicate) {
+		t.Fatalf("expect ErrDuplicate, got %v", err)
+	}
+	if _, err = s.Apply(Transaction{Identity: "b", Amount: -1}); !errors.Is(err, ErrInsufficient) {
+		t.Fatalf("expect ErrInsufficient, got %v", err)
+	}
+	_ = s.Close()
+
+	// 模拟写入中途退出
+	f, _ := os.OpenFile(name, os.O_APPEND|os.O_WRONLY, 0)
+	_, _ = f.WriteString(`{"id":3,"identity":"a"`)
+	_ = f.Close()
+
+	s, err = OpenFileStore(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if b, _ := s.Balance("a"); b != 7 {
+		t.Fatalf("expect restored balance 7, got %d", b)
+	}
+	if _, err = s.Apply(Transaction{Identity: "a", Amount: 10, Ref: "r1"}); !errors.Is(err, ErrDuplicate) {
+		t.Fatal("refs should be restored")
+	}
+	tx, err := s.Apply(Transaction{Identity: "b", Amount: 1})
+	if err != nil || tx.ID != 3 {
+		t.Fatalf("unexpected tx %+v %v", tx, err)
+	}
+	ledger, _ := s.Ledger("a")
+	if len(ledger) != 2 || ledger[1].Balance != 7 {
+		t.Fatalf("unexpected ledger %+v", ledger)
+	}
+}
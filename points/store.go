@@ -0,0 +1,257 @@
+package points
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInsufficient 积分不足
+	ErrInsufficient = errors.New("insufficient points")
+	// ErrDuplicate 同一用户已经存在相同 Ref 的流水，例如重复推送的礼物或者当天已经签到
+	ErrDuplicate = errors.New("duplicate transaction")
+)
+
+// Reason 积分变动原因
+type Reason string
+
+const (
+	ReasonDanmaku Reason = "danmaku"
+	ReasonCheckIn Reason = "checkin"
+	ReasonGift    Reason = "gift"
+	ReasonGuard   Reason = "guard"
+	ReasonRedeem  Reason = "redeem"
+	ReasonAdjust  Reason = "adjust"
+)
+
+// Transaction 积分流水，只追加不修改，用于对账和处理争议
+type Transaction struct {
+	// ID 流水 ID，由 Store 分配，从 1 开始递增
+	ID       uint64 `json:"id"`
+	Identity string `json:"identity"`
+	Username string `json:"uname,omitempty"`
+	// Amount 变动数量，增加为正数，扣减为负数
+	Amount int64 `json:"amount"`
+	// Balance 变动后的余额，由 Store 填充
+	Balance int64  `json:"balance"`
+	Reason  Reason `json:"reason"`
+	// Ref 幂等键，例如消息的 msg_id、"checkin:2006-01-02"，同一用户相同 Ref 的流水只会记录一次
+	Ref string `json:"ref,omitempty"`
+	// Note 备注，例如兑换的奖励名称
+	Note string    `json:"note,omitempty"`
+	Time time.Time `json:"time"`
+}
+
+// Store 积分存储，实现需要保证并发安全，以及余额与流水的一致性
+type Store interface {
+	// Apply 追加一条流水并更新余额，成功时返回填充了 ID 和 Balance 的流水，
+	// 扣减后余额小于 0 时返回 ErrInsufficient，Ref 重复时返回 ErrDuplicate
+	Apply(tx Transaction) (Transaction, error)
+	// Balance 用户的余额，没有记录时为 0
+	Balance(identity string) (int64, error)
+	// Ledger 用户的流水，按 ID 排序，identity 为空时返回所有流水
+	Ledger(identity string) ([]Transaction, error)
+}
+
+// ledger 内存中的余额和流水，MemoryStore 和 FileStore 共用
+type ledger struct {
+	balances map[string]int64
+	refs     map[string]bool
+	txs      []Transaction
+	lastID   uint64
+}
+
+func newLedger() *ledger {
+	return &ledger{balances: make(map[string]int64), refs: make(map[string]bool)}
+}
+
+func refKey(identity, ref string) string {
+	return identity + "\x00" + ref
+}
+
+// prepare 检查并填充流水，不修改状态
+func (l *ledger) prepare(tx Transaction) (Transaction, error) {
+	if tx.Identity == "" {
+		return tx, fmt.Errorf("identity is required")
+	}
+	if tx.Ref != "" && l.refs[refKey(tx.Identity, tx.Ref)] {
+		return tx, ErrDuplicate
+	}
+	balance := l.balances[tx.Identity] + tx.Amount
+	if tx.Amount < 0 && balance < 0 {
+		return tx, ErrInsufficient
+	}
+	tx.ID = l.lastID + 1
+	tx.Balance = balance
+	return tx, nil
+}
+
+// commit 记录 prepare 返回的流水
+func (l *ledger) commit(tx Transaction) {
+	l.lastID = tx.ID
+	l.balances[tx.Identity] = tx.Balance
+	if tx.Ref != "" {
+		l.refs[refKey(tx.Identity, tx.Ref)] = true
+	}
+	l.txs = append(l.txs, tx)
+}
+
+func (l *ledger) ledger(identity string) []Transaction {
+	var txs []Transaction
+	for _, tx := range l.txs {
+		if identity == "" || tx.Identity == identity {
+			txs = append(txs, tx)
+		}
+	}
+	return txs
+}
+
+// MemoryStore 内存存储，进程退出后数据丢失，零值可以直接使用
+type MemoryStore struct {
+	mu sync.Mutex
+	l  *ledger
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+func (s *MemoryStore) getLedger() *ledger {
+	if s.l == nil {
+		s.l = newLedger()
+	}
+	return s.l
+}
+
+func (s *MemoryStore) Apply(tx Transaction) (Transaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l := s.getLedger()
+	tx, err := l.prepare(tx)
+	if err != nil {
+		return tx, err
+	}
+	l.commit(tx)
+	return tx, nil
+}
+
+func (s *MemoryStore) Balance(identity string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.getLedger().balances[identity], nil
+}
+
+func (s *MemoryStore) Ledger(identity string) ([]Transaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.getLedger().ledger(identity), nil
+}
+
+// FileStore 基于文件的存储，流水以 JSON Lines 格式追加写入，打开时重放流水恢复余额
+type FileStore struct {
+	mu sync.Mutex
+	f  *os.File
+	l  *ledger
+	// size 已经完整写入的流水长度
+	size int64
+}
+
+var _ Store = (*FileStore)(nil)
+
+// OpenFileStore 打开或创建流水文件，文件末尾写入中途退出留下的不完整的一行会被截断
+func OpenFileStore(name string) (*FileStore, error) {
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open ledger fail: %w", err)
+	}
+	l := newLedger()
+	var valid int64
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			// 没有换行符的最后一行是写入中途退出留下的
+			break
+		}
+		var tx Transaction
+		if err = json.Unmarshal(line, &tx); err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("decode ledger line %d fail: %w", len(l.txs)+1, err)
+		}
+		l.commit(tx)
+		valid += int64(len(line))
+	}
+	if err = f.Truncate(valid); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("truncate ledger fail: %w", err)
+	}
+	if _, err = f.Seek(valid, 0); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("seek ledger fail: %w", err)
+	}
+	return &FileStore{f: f, l: l, size: valid}, nil
+}
+
+func (s *FileStore) Apply(tx Transaction) (Transaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return tx, os.ErrClosed
+	}
+	tx, err := s.l.prepare(tx)
+	if err != nil {
+		return tx, err
+	}
+	line, err := json.Marshal(tx)
+	if err != nil {
+		return tx, fmt.Errorf("marshal transaction fail: %w", err)
+	}
+	line = append(line, '\n')
+	if _, err = s.f.Write(line); err != nil {
+		// 丢弃写入了一部分的流水，避免之后的流水接在不完整的行后面
+		if terr := s.f.Truncate(s.size); terr == nil {
+			_, _ = s.f.Seek(s.size, 0)
+		}
+		return tx, fmt.Errorf("write ledger fail: %w", err)
+	}
+	s.size += int64(len(line))
+	s.l.commit(tx)
+	return tx, nil
+}
+
+func (s *FileStore) Balance(identity string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.l.balances[identity], nil
+}
+
+func (s *FileStore) Ledger(identity string) ([]Transaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.l.ledger(identity), nil
+}
+
+// Sync 将流水刷新到磁盘
+func (s *FileStore) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return os.ErrClosed
+	}
+	return s.f.Sync()
+}
+
+// Close 关闭流水文件
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
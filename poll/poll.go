@@ -0,0 +1,376 @@
+// Package poll 基于弹幕和礼物的直播间投票
+//
+// 观众发送选项编号或关键词投票，每个用户一票，按 UserInfo.Identity 记录，断线重连后重复推送的弹幕不会重复计票；
+// 设置 GiftWeight 后付费礼物会为送礼用户所投的选项增加票数：
+//
+//	p := &poll.Poll{
+//		Title:            "今晚吃什么",
+//		Options:          []poll.Option{{Key: "火锅"}, {Key: "烧烤", Keywords: []string{"BBQ"}}},
+//		Duration:         time.Minute * 3,
+//		SnapshotInterval: time.Second,
+//		OnSnapshot:       func(r poll.Result) { overlay.Push(r) },
+//	}
+//	p.Attach(client)
+//	err := p.Start(ctx)
+package poll
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	biliopen "github.com/fython/bili-open-live-go"
+)
+
+const defaultSnapshotInterval = time.Second
+
+var (
+	// ErrRunning 投票已经开始
+	ErrRunning = errors.New("poll is running")
+	// ErrNoOptions 没有设置选项
+	ErrNoOptions = errors.New("poll has no options")
+)
+
+// Option 投票选项，观众可以发送选项编号（从 1 开始）、Key 或 Keywords 中的任一个投票，忽略大小写
+type Option struct {
+	// Key 选项名称
+	Key string `json:"key"`
+	// Keywords 其他可以投票的关键词
+	Keywords []string `json:"keywords,omitempty"`
+}
+
+// Poll 投票，零值不可用，至少需要设置 Options，并发安全
+//
+// 一个 Poll 可以多次 Start，每次开始时清空上一轮的票数
+type Poll struct {
+	// Title 投票标题
+	Title string
+	// Options 投票选项
+	Options []Option
+	// Prefix 投票弹幕的前缀，例如 "投"，设置后只有 "投1"、"投火锅" 这样的弹幕才会计票
+	Prefix string
+	// AllowRevote 是否允许改票，允许时以最后一次投票为准，否则只有第一次投票有效
+	AllowRevote bool
+	// MinMedalLevel 参与投票需要的粉丝勋章等级，为 0 时不限制
+	MinMedalLevel int
+	// RequireWearingMedal 是否需要佩戴当前主播的粉丝勋章
+	RequireWearingMedal bool
+	// GiftWeight 每 1 元付费礼物增加的票数，为 0 时不统计礼物，
+	// 礼物票数计入送礼用户所投的选项，投票前送出的礼物在投票后计入，改票时一起转移
+	GiftWeight float64
+	// Duration 投票时长，为 0 时需要手动 Stop
+	Duration time.Duration
+	// SnapshotInterval 投票进行中推送 OnSnapshot 的间隔，默认 1 秒
+	SnapshotInterval time.Duration
+	// OnSnapshot 投票进行中定时回调当前结果，用于更新直播画面
+	OnSnapshot func(r Result)
+	// OnEnd 投票结束时回调最终结果，包括到时结束、Stop 和 ctx 取消
+	OnEnd func(r Result)
+
+	mu      sync.Mutex
+	running bool
+	endsAt  time.Time
+	stop    chan struct{}
+	done    chan struct{}
+	voters  map[string]*voter
+	// gifts 已经计入的礼物 msg_id，避免重连后重复计算
+	gifts map[string]bool
+
+	// now 测试时替换当前时间
+	now func() time.Time
+}
+
+// voter 用户的投票记录，option 为 -1 表示只送了礼物还没有投票
+type voter struct {
+	option int
+	gift   float64
+}
+
+// Result 投票结果
+type Result struct {
+	Title string `json:"title"`
+	// Running 投票是否进行中
+	Running bool `json:"running"`
+	// Remaining 剩余时间，没有设置 Duration 时为 0
+	Remaining time.Duration `json:"remaining"`
+	// Voters 投票人数
+	Voters int `json:"voters"`
+	// Votes 总票数，包括礼物票数
+	Votes float64 `json:"votes"`
+	// Options 各选项的结果，顺序同 Poll.Options
+	Options []OptionResult `json:"options"`
+}
+
+// OptionResult 选项结果
+type OptionResult struct {
+	// Index 选项编号，从 1 开始
+	Index int    `json:"index"`
+	Key   string `json:"key"`
+	// Votes 票数，包括礼物票数
+	Votes float64 `json:"votes"`
+	// Voters 投票人数
+	Voters int `json:"voters"`
+	// Percent 票数占比，0-100
+	Percent float64 `json:"percent"`
+}
+
+// Leader 票数最多的选项，平票时取编号较小的，没有投票时返回 false
+func (r Result) Leader() (OptionResult, bool) {
+	var leader OptionResult
+	for _, o := range r.Options {
+		if o.Votes > leader.Votes {
+			leader = o
+		}
+	}
+	return leader, leader.Votes > 0
+}
+
+func (p *Poll) getNow() time.Time {
+	if p.now != nil {
+		return p.now()
+	}
+	return time.Now()
+}
+
+func (p *Poll) getSnapshotInterval() time.Duration {
+	if p.SnapshotInterval <= 0 {
+		return defaultSnapshotInterval
+	}
+	return p.SnapshotInterval
+}
+
+// Start 开始投票，清空上一轮的票数，ctx 取消时结束投票
+func (p *Poll) Start(ctx context.Context) error {
+	if len(p.Options) == 0 {
+		return ErrNoOptions
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.running {
+		return ErrRunning
+	}
+	p.running = true
+	p.voters = make(map[string]*voter)
+	p.gifts = make(map[string]bool)
+	p.endsAt = time.Time{}
+	if p.Duration > 0 {
+		p.endsAt = p.getNow().Add(p.Duration)
+	}
+	p.stop = make(chan struct{})
+	p.done = make(chan struct{})
+	go p.run(ctx, p.stop, p.done)
+	return nil
+}
+
+// run 定时推送结果，到时或者 ctx 取消时结束投票
+func (p *Poll) run(ctx context.Context, stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(p.getSnapshotInterval())
+	defer ticker.Stop()
+	var timeout <-chan time.Time
+	if p.Duration > 0 {
+		timer := time.NewTimer(p.Duration)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	for {
+		select {
+		case <-ticker.C:
+			if p.OnSnapshot != nil {
+				p.OnSnapshot(p.Result())
+			}
+		case <-timeout:
+			p.end(stop)
+			return
+		case <-ctx.Done():
+			p.end(stop)
+			return
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Stop 结束投票并返回最终结果，投票没有开始时直接返回当前结果
+func (p *Poll) Stop() Result {
+	p.mu.Lock()
+	stop, done := p.stop, p.done
+	p.mu.Unlock()
+	if stop == nil {
+		return p.Result()
+	}
+	r, _ := p.end(stop)
+	<-done
+	return r
+}
+
+// end 结束 stop 对应的一轮投票，已经结束时返回 false
+func (p *Poll) end(stop chan struct{}) (Result, bool) {
+	p.mu.Lock()
+	if !p.running || p.stop != stop {
+		p.mu.Unlock()
+		return p.Result(), false
+	}
+	p.running = false
+	close(stop)
+	p.stop = nil
+	r := p.result()
+	p.mu.Unlock()
+	if p.OnEnd != nil {
+		p.OnEnd(r)
+	}
+	return r, true
+}
+
+// Running 投票是否进行中
+func (p *Poll) Running() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.running
+}
+
+// Result 当前结果
+func (p *Poll) Result() Result {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.result()
+}
+
+func (p *Poll) result() Result {
+	r := Result{Title: p.Title, Running: p.running, Options: make([]OptionResult, len(p.Options))}
+	for i, o := range p.Options {
+		r.Options[i] = OptionResult{Index: i + 1, Key: o.Key}
+	}
+	for _, v := range p.voters {
+		if v.option < 0 {
+			continue
+		}
+		o := &r.Options[v.option]
+		o.Votes += 1 + v.gift
+		o.Voters++
+		r.Votes += 1 + v.gift
+		r.Voters++
+	}
+	if r.Votes > 0 {
+		for i := range r.Options {
+			r.Options[i].Percent = r.Options[i].Votes / r.Votes * 100
+		}
+	}
+	if p.running && !p.endsAt.IsZero() {
+		if remaining := p.endsAt.Sub(p.getNow()); remaining > 0 {
+			r.Remaining = remaining
+		}
+	}
+	return r
+}
+
+// Attach 注册弹幕和礼物路由，返回的 RouteID 可以用于 RemoveRoute
+func (p *Poll) Attach(c *biliopen.LiveClient) biliopen.RouteID {
+	return c.Route(biliopen.IsCmd(biliopen.CmdLiveOpenPlatformDm, biliopen.CmdLiveOpenPlatformSendGift), p.Handle)
+}
+
+// Handle 处理弹幕和礼物事件，可以作为 biliopen.Handler 使用，投票没有进行时忽略
+func (p *Poll) Handle(e biliopen.Event) error {
+	switch data := e.Data.(type) {
+	case biliopen.Danmaku:
+		p.Vote(data)
+	case biliopen.Gift:
+		p.Gift(data)
+	}
+	return nil
+}
+
+// Vote 处理一条弹幕，计票时返回 true
+func (p *Poll) Vote(dm biliopen.Danmaku) bool {
+	id := dm.Identity()
+	if id == "" || dm.DMType != biliopen.DanmakuTypeText || !p.eligible(dm.FansMedal) {
+		return false
+	}
+	option := p.match(dm.Message)
+	if option < 0 {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.running {
+		return false
+	}
+	v := p.voters[id]
+	if v == nil {
+		p.voters[id] = &voter{option: option}
+		return true
+	}
+	if v.option >= 0 && !p.AllowRevote {
+		return false
+	}
+	v.option = option
+	return true
+}
+
+// Gift 处理一个礼物，按用户实际支付的金额计入礼物票数时返回 true，免费礼物和重复的礼物不计入
+func (p *Poll) Gift(g biliopen.Gift) bool {
+	id := g.Identity()
+	if p.GiftWeight <= 0 || id == "" || !g.Paid {
+		return false
+	}
+	weight := float64(g.PaidPrice()) / 1000 * p.GiftWeight
+	if weight <= 0 {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.running {
+		return false
+	}
+	if g.MessageID != "" {
+		if p.gifts[g.MessageID] {
+			return false
+		}
+		p.gifts[g.MessageID] = true
+	}
+	v := p.voters[id]
+	if v == nil {
+		v = &voter{option: -1}
+		p.voters[id] = v
+	}
+	v.gift += weight
+	return true
+}
+
+func (p *Poll) eligible(medal biliopen.FansMedal) bool {
+	if p.RequireWearingMedal && !medal.FansMedalWearingStatus {
+		return false
+	}
+	return medal.FansMedalLevel >= p.MinMedalLevel
+}
+
+// match 匹配弹幕对应的选项，没有匹配时返回 -1
+func (p *Poll) match(msg string) int {
+	msg = strings.TrimSpace(msg)
+	if p.Prefix != "" {
+		if !strings.HasPrefix(msg, p.Prefix) {
+			return -1
+		}
+		msg = strings.TrimSpace(msg[len(p.Prefix):])
+	}
+	if n, err := strconv.Atoi(msg); err == nil {
+		if n >= 1 && n <= len(p.Options) {
+			return n - 1
+		}
+		return -1
+	}
+	for i, o := range p.Options {
+		if strings.EqualFold(msg, o.Key) {
+			return i
+		}
+		for _, kw := range o.Keywords {
+			if strings.EqualFold(msg, kw) {
+				return i
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,149 @@
+package poll
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	biliopen "github.com/fython/bili-open-live-go"
+)
+
+func danmaku(uid int, msg string) biliopen.Danmaku {
+	return biliopen.Danmaku{UserInfo: biliopen.UserInfo{UID: uid}, Message: msg}
+}
+
+func TestPoll(t *testing.T) {
+	p := &Poll{
+		Title:      "test",
+		Options:    []Option{{Key: "火锅"}, {Key: "烧烤", Keywords: []string{"BBQ"}}},
+		GiftWeight: 1,
+	}
+	if p.Vote(danmaku(1, "1")) {
+		t.Fatal("should not vote before start")
+	}
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start(context.Background()); err != ErrRunning {
+		t.Fatalf("expect ErrRunning, got %v", err)
+	}
+	for _, dm := range []biliopen.Danmaku{
+		danmaku(1, "1"), danmaku(2, "bbq"), danmaku(3, " 火锅 "), danmaku(4, "3"), danmaku(5, "hi"),
+	} {
+		p.Vote(dm)
+	}
+	// 重连后重复推送的弹幕和礼物不会重复计票
+	if p.Vote(danmaku(1, "2")) {
+		t.Fatal("revote should be rejected")
+	}
+	gift := biliopen.Gift{UserInfo: biliopen.UserInfo{UID: 2}, MessageID: "g1", Price: 1000, GiftNum: 5, Paid: true}
+	if !p.Gift(gift) || p.Gift(gift) {
+		t.Fatal("gift should be counted once")
+	}
+	p.Gift(biliopen.Gift{UserInfo: biliopen.UserInfo{UID: 6}, MessageID: "g2", Price: 1000, GiftNum: 2, Paid: true})
+	p.Gift(biliopen.Gift{UserInfo: biliopen.UserInfo{UID: 7}, MessageID: "g3", Price: 1000, GiftNum: 2})
+	p.Vote(danmaku(6, "1"))
+
+	r := p.Stop()
+	if r.Running || r.Voters != 4 || r.Votes != 11 {
+		t.Fatalf("unexpected result %+v", r)
+	}
+	if r.Options[0].Votes != 5 || r.Options[0].Voters != 3 || r.Options[1].Votes != 6 {
+		t.Fatalf("unexpected options %+v", r.Options)
+	}
+	if leader, ok := r.Leader(); !ok || leader.Key != "烧烤" {
+		t.Fatalf("unexpected leader %+v", leader)
+	}
+	if p.Vote(danmaku(8, "1")) {
+		t.Fatal("should not vote after stop")
+	}
+}
+
+func TestPollBlindGift(t *testing.T) {
+	p := &Poll{Options: []Option{{Key: "A"}, {Key: "B"}}, GiftWeight: 1}
+	_ = p.Start(context.Background())
+	p.Vote(danmaku(1, "B"))
+	// 盲盒按实际支付的 RPrice 计票，而不是开出礼物的价值
+	p.Gift(biliopen.Gift{
+		UserInfo: biliopen.UserInfo{UID: 1}, MessageID: "g1", Price: 5000, RPrice: 1000, GiftNum: 2, Paid: true,
+		BlindGift: biliopen.BlindGiftInfo{Status: true},
+	})
+	r := p.Stop()
+	if r.Options[1].Votes != 3 {
+		t.Fatalf("unexpected options %+v", r.Options)
+	}
+}
+
+func TestPollRevoteAndEligibility(t *testing.T) {
+	p := &Poll{
+		Options:             []Option{{Key: "A"}, {Key: "B"}},
+		Prefix:              "投",
+		AllowRevote:         true,
+		MinMedalLevel:       5,
+		RequireWearingMedal: true,
+	}
+	_ = p.Start(context.Background())
+	defer p.Stop()
+	fan := danmaku(1, "投A")
+	fan.FansMedal = biliopen.FansMedal{FansMedalLevel: 5, FansMedalWearingStatus: true}
+	if p.Vote(danmaku(2, "投A")) || !p.Vote(fan) {
+		t.Fatal("only eligible fan can vote")
+	}
+	fan.Message = "A"
+	if p.Vote(fan) {
+		t.Fatal("vote without prefix should be ignored")
+	}
+	fan.Message = "投 2"
+	if !p.Vote(fan) {
+		t.Fatal("revote should be allowed")
+	}
+	if r := p.Result(); r.Options[0].Votes != 0 || r.Options[1].Votes != 1 || r.Options[1].Percent != 100 {
+		t.Fatalf("unexpected result %+v", r)
+	}
+}
+
+func TestPollTimer(t *testing.T) {
+	snapshots := make(chan Result, 100)
+	ended := make(chan Result, 1)
+	p := &Poll{
+		Options:          []Option{{Key: "A"}},
+		Duration:         time.Millisecond * 100,
+		SnapshotInterval: time.Millisecond * 10,
+		OnSnapshot:       func(r Result) { snapshots <- r },
+		OnEnd:            func(r Result) { ended <- r },
+	}
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	p.Vote(danmaku(1, "a"))
+	select {
+	case r := <-ended:
+		if r.Running || r.Votes != 1 {
+			t.Fatalf("unexpected final result %+v", r)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("poll should end after duration")
+	}
+	if len(snapshots) == 0 {
+		t.Fatal("expect snapshots")
+	}
+	if r := p.Stop(); r.Running || p.Running() {
+		t.Fatal("poll should not be running")
+	}
+
+	// ctx 取消时结束，可以再次开始
+	ctx, cancel := context.WithCancel(context.Background())
+	p.Duration = 0
+	if err := p.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if p.Result().Votes != 0 {
+		t.Fatal("votes should be reset")
+	}
+	cancel()
+	select {
+	case <-ended:
+	case <-time.After(time.Second):
+		t.Fatal("poll should end after ctx cancel")
+	}
+}
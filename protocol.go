@@ -1,6 +1,7 @@
 package biliopen
 
 import (
+	"bufio"
 	"bytes"
 	"crypto/hmac"
 	"crypto/md5"
@@ -8,12 +9,13 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io"
-	"log"
 	"math/rand"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
+
+	"go.uber.org/zap"
 )
 
 const (
@@ -40,21 +42,52 @@ var signatureSourceHeaders = []string{
 	HeaderBiliTimestamp,
 }
 
-func GenerateSignature(appSecret string, header http.Header) string {
-	var buf bytes.Buffer
-	for _, headerKey := range signatureSourceHeaders {
+// SignatureString 返回签名使用的原文，即按字母序排列的 X-Bili- 请求头，以 "key:value" 形式逐行拼接
+func SignatureString(header http.Header) string {
+	var buf strings.Builder
+	for i, headerKey := range signatureSourceHeaders {
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
 		buf.WriteString(strings.ToLower(headerKey))
 		buf.WriteByte(':')
 		buf.WriteString(header.Get(headerKey))
-		buf.WriteByte('\n')
 	}
-	s := buf.Bytes()
-	s = s[:len(s)-1]
+	return buf.String()
+}
+
+// GenerateSignature 使用 appSecret 对 SignatureString 进行 HMAC-SHA256 签名
+func GenerateSignature(appSecret string, header http.Header) string {
 	hm := hmac.New(sha256.New, []byte(appSecret))
-	hm.Write(s)
+	hm.Write([]byte(SignatureString(header)))
 	return hex.EncodeToString(hm.Sum(nil))
 }
 
+// ContentMD5 请求体的 MD5，对应 X-Bili-Content-MD5 请求头
+func ContentMD5(body []byte) string {
+	sum := md5.Sum(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// SignHeader 写入签名相关的请求头和 Authorization，body 为 nil 时不写入 X-Bili-Content-MD5
+func SignHeader(header http.Header, appKey, appSecret string, timestamp int64, nonce string, body []byte) {
+	header.Set(HeaderBiliTimestamp, strconv.FormatInt(timestamp, 10))
+	header.Set(HeaderBiliSignatureMethod, "HMAC-SHA256")
+	header.Set(HeaderBiliSignatureNonce, nonce)
+	header.Set(HeaderBiliAccessKeyId, appKey)
+	header.Set(HeaderBiliSignatureVersion, "1.0")
+	if body != nil {
+		header.Set(HeaderBiliContentMD5, ContentMD5(body))
+	}
+	// generate api signature depends on header values before this line
+	header.Set("Authorization", GenerateSignature(appSecret, header))
+}
+
+// NewSignatureNonce 生成 X-Bili-Signature-Nonce 使用的随机串
+func NewSignatureNonce(timestamp int64) string {
+	return fmt.Sprintf("%d%08d", timestamp, rand.Intn(10e8))
+}
+
 // ApiTransport implements bili open api http transport with auto signature
 //
 // these request headers will be generated in RoundTrip method:
@@ -62,41 +95,108 @@ func GenerateSignature(appSecret string, header http.Header) string {
 // - X-Bili-Signature-Method
 // - X-Bili-Content-MD5
 // - Authorization
+//
+// 设置 Offset 后会根据响应的 Date 头校准本地时钟偏差，并在之后的签名中使用校准后的时间，
+// 收到 4003 请求过期时不论偏差大小都按 Date 头重新校准，没有可用的 Date 头时保留当前偏差，然后使用新的时间戳重试一次
 type ApiTransport struct {
 	AppKey    string
 	AppSecret string
 	Transport http.RoundTripper
+	// Clock 生成时间戳和随机串，默认 SystemClock
+	Clock Clock
+	// Offset 记录服务端时钟偏差，为空时不做校准，多个 ApiTransport 可以共享同一个 Offset
+	Offset *ClockOffset
+	// Limiter 按接口路径限流，为空时不限流
+	Limiter *RateLimiter
 }
 
-func (t ApiTransport) RoundTrip(r *http.Request) (rsp *http.Response, err error) {
-	r = r.Clone(r.Context())
+func (t ApiTransport) getClock() Clock {
+	if t.Clock == nil {
+		return SystemClock{}
+	}
+	return t.Clock
+}
 
-	// generate base api header
-	ts := time.Now().Unix()
-	nonce := fmt.Sprintf("%d%08d", ts, rand.Intn(10e8))
-	r.Header.Set(HeaderBiliTimestamp, strconv.FormatInt(ts, 10))
-	r.Header.Set(HeaderBiliSignatureMethod, "HMAC-SHA256")
-	r.Header.Set(HeaderBiliSignatureNonce, nonce)
-	r.Header.Set(HeaderBiliAccessKeyId, t.AppKey)
-	r.Header.Set(HeaderBiliSignatureVersion, "1.0")
-	// generate content md5
+func (t ApiTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	var bodyBytes []byte
 	if r.Method == http.MethodPost {
-		var body io.ReadCloser
-		body, err = r.GetBody()
+		body, err := r.GetBody()
 		if err != nil {
 			return nil, fmt.Errorf("failed to get body: %w", err)
 		}
 		defer body.Close()
-		bodyBytes, _ := io.ReadAll(body)
-		m := md5.New()
-		m.Write(bodyBytes)
-		r.Header.Set(HeaderBiliContentMD5, hex.EncodeToString(m.Sum(nil)))
+		if bodyBytes, err = io.ReadAll(body); err != nil {
+			return nil, fmt.Errorf("failed to read body: %w", err)
+		}
 	}
-	// generate api signature depends on header values before this line
-	sign := GenerateSignature(t.AppSecret, r.Header)
-	r.Header.Set("Authorization", sign)
+	rsp, code, received, err := t.sendAndObserve(r, bodyBytes)
+	if err != nil {
+		return nil, err
+	}
+	if t.Offset != nil && code == ErrRequestExpired {
+		// 服务端认为时间戳过期时当前偏差已经不可信，即使测量值在容差内也强制更新，
+		// 没有 Date 头时仍然重试，排队等待过久等原因导致的过期可以通过新的时间戳恢复
+		calibrated := t.Offset.calibrate(rsp.Header.Get("Date"), received)
+		zap.L().Info("request expired, retry with recalibrated clock", zap.String("url", r.URL.String()),
+			zap.Bool("calibrated", calibrated), zap.Duration("offset", t.Offset.Get()))
+		rsp.Body.Close()
+		rsp, _, _, err = t.sendAndObserve(r, bodyBytes)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rsp, nil
+}
 
-	log.Printf("%+v", r.Header)
+// sendAndObserve 签名并发送一次请求，记录服务端时间，并把响应中的业务错误码反馈给 Limiter，
+// 过期重试的请求同样经过这里，限流器不会漏记重试的结果
+func (t ApiTransport) sendAndObserve(r *http.Request, bodyBytes []byte) (rsp *http.Response, code CommonErrorCode, received time.Time, err error) {
+	if rsp, err = t.signAndSend(r, bodyBytes); err != nil {
+		return nil, 0, received, err
+	}
+	received = t.getClock().Now()
+	if t.Offset != nil {
+		t.Offset.observe(rsp.Header.Get("Date"), received)
+	}
+	if rsp.StatusCode != http.StatusOK || (t.Offset == nil && t.Limiter == nil) {
+		return rsp, 0, received, nil
+	}
+	if code, err = peekResponseCode(rsp); err != nil {
+		return nil, 0, received, err
+	}
+	if t.Limiter != nil {
+		if code == ErrRateLimited {
+			t.Limiter.Throttled(r.URL.Path)
+		} else {
+			t.Limiter.Succeeded(r.URL.Path)
+		}
+	}
+	return rsp, code, received, nil
+}
+
+// signAndSend 复制请求并写入签名后发送，原请求不会被修改，设置了 Limiter 时先排队等待
+func (t ApiTransport) signAndSend(r *http.Request, bodyBytes []byte) (*http.Response, error) {
+	if t.Limiter != nil {
+		// 排队结束后再生成时间戳，避免等待过久导致请求过期
+		if err := t.Limiter.Wait(r.Context(), r.URL.Path); err != nil {
+			return nil, fmt.Errorf("wait rate limiter fail: %w", err)
+		}
+	}
+	r = r.Clone(r.Context())
+	if bodyBytes != nil {
+		r.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+	}
+	clock := t.getClock()
+	now := clock.Now()
+	if t.Offset != nil {
+		now = now.Add(t.Offset.Get())
+	}
+	ts := now.Unix()
+	SignHeader(r.Header, t.AppKey, t.AppSecret, ts, clock.Nonce(ts), bodyBytes)
+
+	if ce := zap.L().Check(zap.DebugLevel, "sign api request"); ce != nil {
+		ce.Write(zap.String("url", r.URL.String()), zap.Any("header", r.Header))
+	}
 
 	transport := t.Transport
 	if transport == nil {
@@ -105,6 +205,35 @@ func (t ApiTransport) RoundTrip(r *http.Request) (rsp *http.Response, err error)
 	return transport.RoundTrip(r)
 }
 
+// responseCodePeekSize peekResponseCode 最多读取的响应体字节数，官方响应中 code 总是第一个字段
+const responseCodePeekSize = 4096
+
+// peekResponseCode 读取响应体开头的业务错误码，只缓冲前 responseCodePeekSize 字节，
+// 调用方仍然可以从 rsp.Body 流式读取完整的响应体，code 不在缓冲范围内或无法解析时返回 0
+func peekResponseCode(rsp *http.Response) (CommonErrorCode, error) {
+	br := bufio.NewReaderSize(rsp.Body, responseCodePeekSize)
+	body, err := br.Peek(responseCodePeekSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		rsp.Body.Close()
+		return 0, fmt.Errorf("read body fail: %w", err)
+	}
+	rsp.Body = struct {
+		io.Reader
+		io.Closer
+	}{br, rsp.Body}
+	var code CommonErrorCode
+	_ = scanJSONObject(body, func(key, value []byte) error {
+		if string(key) == "code" {
+			if n, err := strconv.Atoi(string(value)); err == nil {
+				code = CommonErrorCode(n)
+			}
+			return errStopScan
+		}
+		return nil
+	})
+	return code, nil
+}
+
 type CommonResponse[T any] struct {
 	Code      CommonErrorCode `json:"code"`
 	Message   string          `json:"message"`
@@ -0,0 +1,448 @@
+// Package queue 观众排队上车
+//
+// 观众发送 "排队" 加入队列、"取消" 离开队列、"!位置" 查询位置，大航海成员和排队期间送出付费礼物的观众可以插队，
+// 主播通过 Next、Kick、Clear、Pause 管理队列，设置 Path 后队列会持久化到文件，重启后通过 Load 恢复：
+//
+//	q := &queue.Queue{Path: "queue.json", GiftValue: 10 * 1000}
+//	if err := q.Load(); err != nil { ... }
+//	q.OnChange = func(c queue.Change) { overlay.Push(c.Members) }
+//	q.OnPosition = func(m queue.Member, pos int) { /* 提示观众 */ }
+//	q.Attach(client)
+//	member, ok := q.Next()
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	biliopen "github.com/fython/bili-open-live-go"
+	"github.com/fython/bili-open-live-go/internal/atomicfile"
+)
+
+var (
+	defaultJoinKeywords     = []string{"排队"}
+	defaultLeaveKeywords    = []string{"取消", "取消排队"}
+	defaultPositionKeywords = []string{"!位置", "！位置"}
+)
+
+// Tier 排队优先级，数值越大越靠前，同一优先级按加入顺序排列
+type Tier int
+
+const (
+	// TierNormal 普通观众
+	TierNormal Tier = iota
+	// TierGift 排队期间送出了不低于 GiftValue 的付费礼物
+	TierGift
+	// TierCaptain 舰长
+	TierCaptain
+	// TierAdmiral 提督
+	TierAdmiral
+	// TierGovernor 总督
+	TierGovernor
+)
+
+func guardTier(level biliopen.GuardLevel) Tier {
+	switch level {
+	case biliopen.GuardLevelGovernor:
+		return TierGovernor
+	case biliopen.GuardLevelAdmiral:
+		return TierAdmiral
+	case biliopen.GuardLevelCaptain:
+		return TierCaptain
+	default:
+		return TierNormal
+	}
+}
+
+// ChangeType 队列变化类型
+type ChangeType string
+
+const (
+	ChangeJoined   ChangeType = "joined"
+	ChangeLeft     ChangeType = "left"
+	ChangePromoted ChangeType = "promoted"
+	ChangeNext     ChangeType = "next"
+	ChangeKicked   ChangeType = "kicked"
+	ChangeCleared  ChangeType = "cleared"
+	ChangePaused   ChangeType = "paused"
+	ChangeResumed  ChangeType = "resumed"
+)
+
+// Member 排队的观众
+type Member struct {
+	Identity string    `json:"identity"`
+	Username string    `json:"uname"`
+	Tier     Tier      `json:"tier"`
+	JoinedAt time.Time `json:"joined_at"`
+	// Seq 加入顺序
+	Seq uint64 `json:"seq"`
+}
+
+// Change 队列变化事件
+type Change struct {
+	Type ChangeType `json:"type"`
+	// Member 变化涉及的观众，Cleared、Paused、Resumed 时为空
+	Member *Member `json:"member,omitempty"`
+	// Members 变化后的完整队列
+	Members []Member `json:"members"`
+	// Paused 变化后是否暂停
+	Paused bool `json:"paused"`
+}
+
+// Queue 排队队列，零值可以直接使用，并发安全
+type Queue struct {
+	// JoinKeywords 加入队列的弹幕，默认为 "排队"
+	JoinKeywords []string
+	// LeaveKeywords 离开队列的弹幕，默认为 "取消" 和 "取消排队"
+	LeaveKeywords []string
+	// PositionKeywords 查询位置的弹幕，默认为 "!位置" 和 "！位置"
+	PositionKeywords []string
+	// MaxSize 队列最大长度，为 0 时不限制
+	MaxSize int
+	// IgnoreGuardLevel 为 true 时大航海成员不能插队
+	IgnoreGuardLevel bool
+	// GiftValue 排队期间单次送出不低于该价值的付费礼物时提升到 TierGift，1000 = 1 元，为 0 时礼物不能插队
+	GiftValue int64
+	// Path 持久化文件路径，为空时不持久化
+	Path string
+
+	// OnChange 队列变化时回调，在锁外调用，可以在回调中访问队列
+	OnChange func(c Change)
+	// OnPosition 观众查询位置时回调，position 从 1 开始，不在队列中时为 0
+	OnPosition func(m Member, position int)
+	// OnSaveError 持久化失败时回调，在持有锁时调用，不能再调用 Queue 的方法，为空时输出警告日志，内存中的状态不会回滚
+	OnSaveError func(err error)
+
+	mu      sync.Mutex
+	members []Member
+	paused  bool
+	seq     uint64
+
+	// now 测试时替换当前时间
+	now func() time.Time
+}
+
+// snapshot 持久化的队列状态
+type snapshot struct {
+	Paused  bool     `json:"paused"`
+	Seq     uint64   `json:"seq"`
+	Members []Member `json:"members"`
+}
+
+func (q *Queue) getNow() time.Time {
+	if q.now != nil {
+		return q.now()
+	}
+	return time.Now()
+}
+
+func (q *Queue) getJoinKeywords() []string {
+	if len(q.JoinKeywords) == 0 {
+		return defaultJoinKeywords
+	}
+	return q.JoinKeywords
+}
+
+func (q *Queue) getLeaveKeywords() []string {
+	if len(q.LeaveKeywords) == 0 {
+		return defaultLeaveKeywords
+	}
+	return q.LeaveKeywords
+}
+
+func (q *Queue) getPositionKeywords() []string {
+	if len(q.PositionKeywords) == 0 {
+		return defaultPositionKeywords
+	}
+	return q.PositionKeywords
+}
+
+// Load 从 Path 恢复队列，文件不存在时不做任何操作
+func (q *Queue) Load() error {
+	if q.Path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(q.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("read queue fail: %w", err)
+	}
+	var s snapshot
+	if err = json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("unmarshal queue fail: %w", err)
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.members = s.Members
+	q.paused = s.Paused
+	q.seq = s.Seq
+	q.sort()
+	return nil
+}
+
+// save 写入临时文件后重命名，失败时通过 OnSaveError 上报并返回错误，调用方需要持有锁
+func (q *Queue) save() error {
+	if q.Path == "" {
+		return nil
+	}
+	data, err := json.Marshal(snapshot{Paused: q.paused, Seq: q.seq, Members: q.members})
+	if err == nil {
+		err = atomicfile.WriteFile(q.Path, data)
+	}
+	if err != nil {
+		err = fmt.Errorf("save queue fail: %w", err)
+		if q.OnSaveError != nil {
+			q.OnSaveError(err)
+		} else {
+			zap.L().Warn("save queue fail", zap.String("path", q.Path), zap.Error(err))
+		}
+	}
+	return err
+}
+
+// sort 按优先级和加入顺序排序，调用方需要持有锁
+func (q *Queue) sort() {
+	sort.SliceStable(q.members, func(i, j int) bool {
+		a, b := q.members[i], q.members[j]
+		if a.Tier != b.Tier {
+			return a.Tier > b.Tier
+		}
+		return a.Seq < b.Seq
+	})
+}
+
+func (q *Queue) index(identity string) int {
+	for i, m := range q.members {
+		if m.Identity == identity {
+			return i
+		}
+	}
+	return -1
+}
+
+// commit 持久化并生成变化事件，调用方需要持有锁
+func (q *Queue) commit(t ChangeType, m *Member) Change {
+	q.save()
+	return Change{Type: t, Member: m, Members: append([]Member(nil), q.members...), Paused: q.paused}
+}
+
+func (q *Queue) emit(c Change) {
+	if q.OnChange != nil {
+		q.OnChange(c)
+	}
+}
+
+// Attach 注册弹幕、礼物和大航海路由，返回的 RouteID 可以用于 RemoveRoute
+func (q *Queue) Attach(c *biliopen.LiveClient) biliopen.RouteID {
+	return c.Route(biliopen.IsCmd(
+		biliopen.CmdLiveOpenPlatformDm,
+		biliopen.CmdLiveOpenPlatformSendGift,
+		biliopen.CmdLiveOpenPlatformGuard,
+	), q.Handle)
+}
+
+// Handle 处理弹幕、礼物和大航海事件，可以作为 biliopen.Handler 使用
+func (q *Queue) Handle(e biliopen.Event) error {
+	switch data := e.Data.(type) {
+	case biliopen.Danmaku:
+		q.handleDanmaku(data)
+	case biliopen.Gift:
+		if q.GiftValue > 0 && biliopen.EventValue(e) >= q.GiftValue {
+			q.Promote(data.Identity(), TierGift)
+		}
+	case biliopen.Guard:
+		if !q.IgnoreGuardLevel {
+			q.Promote(data.Identity(), guardTier(data.GuardLevel))
+		}
+	}
+	return nil
+}
+
+func (q *Queue) handleDanmaku(dm biliopen.Danmaku) {
+	msg := strings.TrimSpace(dm.Message)
+	switch {
+	case containsKeyword(q.getJoinKeywords(), msg):
+		tier := TierNormal
+		if !q.IgnoreGuardLevel {
+			tier = guardTier(dm.GuardLevel)
+		}
+		q.Join(dm.UserInfo, tier)
+	case containsKeyword(q.getLeaveKeywords(), msg):
+		q.Leave(dm.Identity())
+	case containsKeyword(q.getPositionKeywords(), msg):
+		if q.OnPosition == nil {
+			return
+		}
+		m, pos := q.Position(dm.Identity())
+		if pos == 0 {
+			m = Member{Identity: dm.Identity(), Username: dm.Username}
+		}
+		q.OnPosition(m, pos)
+	}
+}
+
+func containsKeyword(keywords []string, msg string) bool {
+	for _, kw := range keywords {
+		if strings.EqualFold(msg, kw) {
+			return true
+		}
+	}
+	return false
+}
+
+// Join 加入队列，返回加入后的位置，已经在队列中时可能提升优先级，暂停或者队列已满时返回 0
+func (q *Queue) Join(user biliopen.UserInfo, tier Tier) int {
+	id := user.Identity()
+	if id == "" {
+		return 0
+	}
+	q.mu.Lock()
+	if i := q.index(id); i >= 0 {
+		q.mu.Unlock()
+		q.Promote(id, tier)
+		_, pos := q.Position(id)
+		return pos
+	}
+	if q.paused || (q.MaxSize > 0 && len(q.members) >= q.MaxSize) {
+		q.mu.Unlock()
+		return 0
+	}
+	q.seq++
+	m := Member{Identity: id, Username: user.Username, Tier: tier, JoinedAt: q.getNow(), Seq: q.seq}
+	q.members = append(q.members, m)
+	q.sort()
+	pos := q.index(id) + 1
+	c := q.commit(ChangeJoined, &m)
+	q.mu.Unlock()
+	q.emit(c)
+	return pos
+}
+
+// Leave 离开队列，不在队列中时返回 false
+func (q *Queue) Leave(identity string) bool {
+	return q.remove(identity, ChangeLeft)
+}
+
+// Kick 将观众移出队列，不在队列中时返回 false
+func (q *Queue) Kick(identity string) bool {
+	return q.remove(identity, ChangeKicked)
+}
+
+func (q *Queue) remove(identity string, t ChangeType) bool {
+	q.mu.Lock()
+	i := q.index(identity)
+	if i < 0 {
+		q.mu.Unlock()
+		return false
+	}
+	m := q.members[i]
+	q.members = append(q.members[:i], q.members[i+1:]...)
+	c := q.commit(t, &m)
+	q.mu.Unlock()
+	q.emit(c)
+	return true
+}
+
+// Promote 提升观众的优先级，不在队列中或者优先级不高于当前优先级时返回 false
+func (q *Queue) Promote(identity string, tier Tier) bool {
+	q.mu.Lock()
+	i := q.index(identity)
+	if i < 0 || q.members[i].Tier >= tier {
+		q.mu.Unlock()
+		return false
+	}
+	q.members[i].Tier = tier
+	m := q.members[i]
+	q.sort()
+	c := q.commit(ChangePromoted, &m)
+	q.mu.Unlock()
+	q.emit(c)
+	return true
+}
+
+// Next 取出队首的观众，队列为空时返回 false，暂停不影响 Next
+func (q *Queue) Next() (Member, bool) {
+	q.mu.Lock()
+	if len(q.members) == 0 {
+		q.mu.Unlock()
+		return Member{}, false
+	}
+	m := q.members[0]
+	q.members = append(q.members[:0], q.members[1:]...)
+	c := q.commit(ChangeNext, &m)
+	q.mu.Unlock()
+	q.emit(c)
+	return m, true
+}
+
+// Clear 清空队列
+func (q *Queue) Clear() {
+	q.mu.Lock()
+	q.members = nil
+	c := q.commit(ChangeCleared, nil)
+	q.mu.Unlock()
+	q.emit(c)
+}
+
+// Pause 暂停排队，暂停期间不能加入，可以离开和查询位置
+func (q *Queue) Pause() {
+	q.setPaused(true, ChangePaused)
+}
+
+// Resume 恢复排队
+func (q *Queue) Resume() {
+	q.setPaused(false, ChangeResumed)
+}
+
+func (q *Queue) setPaused(paused bool, t ChangeType) {
+	q.mu.Lock()
+	if q.paused == paused {
+		q.mu.Unlock()
+		return
+	}
+	q.paused = paused
+	c := q.commit(t, nil)
+	q.mu.Unlock()
+	q.emit(c)
+}
+
+// Paused 是否暂停
+func (q *Queue) Paused() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.paused
+}
+
+// Position 观众在队列中的位置，从 1 开始，不在队列中时返回 0
+func (q *Queue) Position(identity string) (Member, int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	i := q.index(identity)
+	if i < 0 {
+		return Member{}, 0
+	}
+	return q.members[i], i + 1
+}
+
+// Members 当前队列
+func (q *Queue) Members() []Member {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]Member(nil), q.members...)
+}
+
+// Len 队列长度
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.members)
+}
@@ -0,0 +1,100 @@
+package queue
+
+import (
+	"path/filepath"
+	"testing"
+
+	biliopen "github.com/fython/bili-open-live-go"
+)
+
+func dmEvent(uid int, msg string, guard biliopen.GuardLevel) biliopen.Event {
+	return biliopen.Event{Cmd: biliopen.CmdLiveOpenPlatformDm, Data: biliopen.Danmaku{
+		UserInfo:   biliopen.UserInfo{UID: uid},
+		GuardLevel: guard,
+		Message:    msg,
+	}}
+}
+
+func identities(members []Member) []string {
+	ids := make([]string, len(members))
+	for i, m := range members {
+		ids[i] = m.Identity
+	}
+	return ids
+}
+
+func TestQueue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.json")
+	var changes []Change
+	positions := map[string]int{}
+	q := &Queue{
+		Path:       path,
+		GiftValue:  10 * 1000,
+		MaxSize:    4,
+		OnChange:   func(c Change) { changes = append(changes, c) },
+		OnPosition: func(m Member, pos int) { positions[m.Identity] = pos },
+	}
+	_ = q.Handle(dmEvent(1, "排队", 0))
+	_ = q.Handle(dmEvent(2, "排队", 0))
+	_ = q.Handle(dmEvent(3, " 排队 ", biliopen.GuardLevelCaptain))
+	_ = q.Handle(dmEvent(2, "排队", 0)) // 重复加入
+	if got := identities(q.Members()); len(got) != 3 || got[0] != "uid:3" || got[1] != "uid:1" {
+		t.Fatalf("guard should skip ahead, got %v", got)
+	}
+
+	// 礼物价值不足时不插队
+	_ = q.Handle(biliopen.Event{Cmd: biliopen.CmdLiveOpenPlatformSendGift, Data: biliopen.Gift{
+		UserInfo: biliopen.UserInfo{UID: 2}, Price: 1000, GiftNum: 9, Paid: true,
+	}})
+	_ = q.Handle(biliopen.Event{Cmd: biliopen.CmdLiveOpenPlatformSendGift, Data: biliopen.Gift{
+		UserInfo: biliopen.UserInfo{UID: 2}, Price: 1000, GiftNum: 10, Paid: true,
+	}})
+	if got := identities(q.Members()); got[1] != "uid:2" {
+		t.Fatalf("gift should skip ahead, got %v", got)
+	}
+	_ = q.Handle(dmEvent(1, "!位置", 0))
+	_ = q.Handle(dmEvent(9, "！位置", 0))
+	if positions["uid:1"] != 3 || positions["uid:9"] != 0 {
+		t.Fatalf("unexpected positions %v", positions)
+	}
+
+	q.Pause()
+	if q.Join(biliopen.UserInfo{UID: 4}, TierNormal) != 0 {
+		t.Fatal("should not join when paused")
+	}
+	q.Resume()
+	q.Join(biliopen.UserInfo{UID: 4}, TierNormal)
+	if q.Join(biliopen.UserInfo{UID: 5}, TierNormal) != 0 {
+		t.Fatal("should not join when full")
+	}
+	_ = q.Handle(dmEvent(1, "取消", 0))
+	if m, ok := q.Next(); !ok || m.Identity != "uid:3" {
+		t.Fatalf("unexpected next %+v", m)
+	}
+	if !q.Kick("uid:2") || q.Kick("uid:2") {
+		t.Fatal("kick should succeed once")
+	}
+	last := changes[len(changes)-1]
+	if last.Type != ChangeKicked || last.Member.Identity != "uid:2" || len(last.Members) != 1 {
+		t.Fatalf("unexpected change %+v", last)
+	}
+
+	// 重启后恢复
+	q2 := &Queue{Path: path}
+	if err := q2.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if got := identities(q2.Members()); len(got) != 1 || got[0] != "uid:4" {
+		t.Fatalf("unexpected restored queue %v", got)
+	}
+	if pos := q2.Join(biliopen.UserInfo{UID: 6}, TierNormal); pos != 2 {
+		t.Fatalf("expect position 2, got %d", pos)
+	}
+	q2.Clear()
+	if q2.Len() != 0 {
+		t.Fatal("queue should be cleared")
+	}
+	if err := (&Queue{Path: filepath.Join(t.TempDir(), "missing.json")}).Load(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,210 @@
+package biliopen
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultRateLimitInitialBackoff 收到 4009 后暂停请求的初始时间
+	defaultRateLimitInitialBackoff = time.Second
+	// defaultRateLimitMaxBackoff 连续收到 4009 时暂停时间的上限
+	defaultRateLimitMaxBackoff = time.Minute
+)
+
+// RateLimit 令牌桶限流参数
+type RateLimit struct {
+	// Rate 每秒产生的令牌数，小于等于 0 表示不限流
+	Rate float64
+	// Burst 令牌桶容量，即允许的突发请求数，默认为 1
+	Burst int
+}
+
+// RateLimiter 按接口路径划分的令牌桶限流器，零值可以直接使用，默认不限流
+//
+// 超出限制的请求会排队等待而不是直接失败。服务端返回 4009 接口访问限制时，
+// 对应接口会暂停一段时间，连续收到 4009 时暂停时间翻倍，直到请求成功后恢复
+type RateLimiter struct {
+	mu       sync.Mutex
+	fallback RateLimit
+	limits   map[string]RateLimit
+	buckets  map[string]*tokenBucket
+}
+
+// sharedRateLimiters AppKey -> *RateLimiter
+var sharedRateLimiters sync.Map
+
+// SharedRateLimiter 返回 appKey 对应的全局限流器，同一个 AppKey 的所有客户端默认共享
+func SharedRateLimiter(appKey string) *RateLimiter {
+	if l, ok := sharedRateLimiters.Load(appKey); ok {
+		return l.(*RateLimiter)
+	}
+	l, _ := sharedRateLimiters.LoadOrStore(appKey, &RateLimiter{})
+	return l.(*RateLimiter)
+}
+
+// SetDefault 设置未单独配置的接口使用的限流参数
+func (l *RateLimiter) SetDefault(limit RateLimit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.fallback = limit
+	for path, b := range l.buckets {
+		if _, ok := l.limits[path]; !ok {
+			b.setLimit(limit)
+		}
+	}
+}
+
+// SetLimit 设置单个接口的限流参数，path 为接口路径，例如 "/v2/app/heartbeat"
+func (l *RateLimiter) SetLimit(path string, limit RateLimit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limits == nil {
+		l.limits = map[string]RateLimit{}
+	}
+	l.limits[path] = limit
+	if b, ok := l.buckets[path]; ok {
+		b.setLimit(limit)
+	}
+}
+
+// Wait 等待 path 接口可以发送请求，ctx 取消时返回 ctx.Err() 并归还占用的令牌
+//
+// 接口暂停期间不占用令牌，暂停结束后排队的请求重新按令牌桶依次通过，而不是同时放行
+func (l *RateLimiter) Wait(ctx context.Context, path string) error {
+	for {
+		now := time.Now()
+		l.mu.Lock()
+		b := l.bucket(path)
+		if paused := b.pausedUntil.Sub(now); paused > 0 {
+			l.mu.Unlock()
+			if err := sleepContext(ctx, paused); err != nil {
+				return err
+			}
+			continue
+		}
+		d := b.reserve(now)
+		pauses := b.pauses
+		l.mu.Unlock()
+		if d <= 0 {
+			return nil
+		}
+		err := sleepContext(ctx, d)
+		l.mu.Lock()
+		// 等待期间收到 4009 时 Throttled 已经清空了预占的令牌，不需要归还，重新排队
+		throttled := b.pauses != pauses
+		if err != nil && !throttled {
+			b.cancel()
+		}
+		l.mu.Unlock()
+		if err != nil {
+			return err
+		}
+		if !throttled {
+			return nil
+		}
+	}
+}
+
+// Throttled 通知限流器 path 接口收到了 4009，在退避时间内暂停该接口的请求
+func (l *RateLimiter) Throttled(path string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.bucket(path)
+	if b.backoff == 0 {
+		b.backoff = defaultRateLimitInitialBackoff
+	} else if b.backoff *= 2; b.backoff > defaultRateLimitMaxBackoff {
+		b.backoff = defaultRateLimitMaxBackoff
+	}
+	b.pausedUntil = time.Now().Add(b.backoff)
+	b.pauses++
+	if b.limit.Rate > 0 {
+		// 暂停结束时令牌桶为空，之后按速率重新产生令牌
+		b.tokens = 0
+		b.last = b.pausedUntil
+	}
+}
+
+// Succeeded 通知限流器 path 接口请求成功，重置退避时间
+func (l *RateLimiter) Succeeded(path string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b, ok := l.buckets[path]; ok {
+		b.backoff = 0
+	}
+}
+
+// bucket 获取 path 对应的令牌桶，调用方需要持有锁
+func (l *RateLimiter) bucket(path string) *tokenBucket {
+	if b, ok := l.buckets[path]; ok {
+		return b
+	}
+	if l.buckets == nil {
+		l.buckets = map[string]*tokenBucket{}
+	}
+	limit, ok := l.limits[path]
+	if !ok {
+		limit = l.fallback
+	}
+	b := &tokenBucket{}
+	b.setLimit(limit)
+	l.buckets[path] = b
+	return b
+}
+
+// tokenBucket 令牌桶，令牌数可以为负数，表示已经被排队中的请求预占
+type tokenBucket struct {
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+
+	// pausedUntil 收到 4009 后暂停到该时间
+	pausedUntil time.Time
+	backoff     time.Duration
+	// pauses 收到 4009 的次数，用于判断排队期间是否被暂停
+	pauses int
+}
+
+func (b *tokenBucket) burst() float64 {
+	if b.limit.Burst <= 0 {
+		return 1
+	}
+	return float64(b.limit.Burst)
+}
+
+func (b *tokenBucket) setLimit(limit RateLimit) {
+	b.limit = limit
+	if b.last.IsZero() || b.tokens > b.burst() {
+		b.tokens = b.burst()
+	}
+}
+
+// reserve 预占一个令牌，返回需要等待的时间，不考虑暂停
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	var wait time.Duration
+	if b.limit.Rate > 0 {
+		if !b.last.IsZero() && now.After(b.last) {
+			b.tokens += now.Sub(b.last).Seconds() * b.limit.Rate
+			if burst := b.burst(); b.tokens > burst {
+				b.tokens = burst
+			}
+		}
+		// Throttled 会把 last 推到暂停结束时刻，暂停期间排队的请求不能把它拉回去，否则会重复累计令牌
+		if b.last.IsZero() || now.After(b.last) {
+			b.last = now
+		}
+		b.tokens--
+		if b.tokens < 0 {
+			wait = time.Duration(-b.tokens / b.limit.Rate * float64(time.Second))
+		}
+	}
+	return wait
+}
+
+// cancel 归还 reserve 预占的令牌
+func (b *tokenBucket) cancel() {
+	if b.limit.Rate > 0 {
+		b.tokens++
+	}
+}
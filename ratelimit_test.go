@@ -0,0 +1,218 @@
+package biliopen
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterQueue(t *testing.T) {
+	l := &RateLimiter{}
+	l.SetLimit("/a", RateLimit{Rate: 50, Burst: 2})
+	ctx := context.Background()
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := l.Wait(ctx, "/a"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	// 前 2 个请求使用突发容量，之后每 20ms 放行一个
+	if elapsed := time.Since(start); elapsed < time.Millisecond*50 {
+		t.Fatalf("5 requests at 50/s with burst 2 should take about 60ms, took %v", elapsed)
+	}
+	// 未配置的接口不限流
+	for i := 0; i < 10; i++ {
+		if err := l.Wait(ctx, "/b"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRateLimiterCancel(t *testing.T) {
+	l := &RateLimiter{}
+	l.SetDefault(RateLimit{Rate: 1})
+	if err := l.Wait(context.Background(), "/a"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	if err := l.Wait(ctx, "/a"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect deadline exceeded, got %v", err)
+	}
+	// 取消的请求归还令牌，下一个请求不需要等待两个周期
+	l.mu.Lock()
+	tokens := l.buckets["/a"].tokens
+	l.mu.Unlock()
+	if tokens < -0.1 {
+		t.Fatalf("token should be returned after cancel, got %v", tokens)
+	}
+}
+
+func TestRateLimiterResumeAfterPause(t *testing.T) {
+	l := &RateLimiter{}
+	l.SetLimit("/a", RateLimit{Rate: 50, Burst: 5})
+	l.Throttled("/a")
+	l.mu.Lock()
+	b := l.buckets["/a"]
+	b.pausedUntil = time.Now().Add(time.Millisecond * 30)
+	b.last = b.pausedUntil
+	l.mu.Unlock()
+	var mu sync.Mutex
+	var released []time.Time
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := l.Wait(context.Background(), "/a"); err != nil {
+				t.Error(err)
+			}
+			mu.Lock()
+			released = append(released, time.Now())
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	// 暂停结束后令牌桶为空，排队的请求每 20ms 放行一个，而不是在暂停结束时同时放行
+	first, last := released[0], released[0]
+	for _, r := range released {
+		if r.Before(first) {
+			first = r
+		}
+		if r.After(last) {
+			last = r
+		}
+	}
+	if d := last.Sub(first); d < time.Millisecond*50 {
+		t.Fatalf("waiters should be spaced after pause, released within %v", d)
+	}
+}
+
+func TestApiTransportRateLimited(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			_, _ = w.Write([]byte(`{"code":4009,"message":"接口访问限制"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"code":0}`))
+	}))
+	defer srv.Close()
+
+	l := &RateLimiter{}
+	client := &http.Client{Transport: ApiTransport{AppKey: "key", AppSecret: "secret", Limiter: l}}
+	post := func() {
+		rsp, err := client.Post(srv.URL+"/v2/app/heartbeat", "application/json", strings.NewReader(`{}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = rsp.Body.Close()
+	}
+	post()
+	l.mu.Lock()
+	paused := l.buckets["/v2/app/heartbeat"].pausedUntil
+	l.mu.Unlock()
+	if time.Until(paused) <= 0 {
+		t.Fatal("endpoint should be paused after 4009")
+	}
+	// 暂停期间的请求排队等待，ctx 取消时返回
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL+"/v2/app/heartbeat", strings.NewReader(`{}`))
+	if _, err := client.Do(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect deadline exceeded while paused, got %v", err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Fatalf("paused request should not be sent, got %d requests", n)
+	}
+	// 退避结束后恢复，成功后重置退避时间
+	l.mu.Lock()
+	l.buckets["/v2/app/heartbeat"].pausedUntil = time.Time{}
+	l.mu.Unlock()
+	post()
+	l.mu.Lock()
+	backoff := l.buckets["/v2/app/heartbeat"].backoff
+	l.mu.Unlock()
+	if backoff != 0 {
+		t.Fatalf("backoff should reset after success, got %v", backoff)
+	}
+}
+
+func TestTokenBucketLastMonotonic(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	b := &tokenBucket{limit: RateLimit{Rate: 10, Burst: 5}, last: now.Add(time.Second)}
+	// 暂停期间排队的请求不会把 last 拉回到暂停结束之前
+	b.reserve(now)
+	if !b.last.Equal(now.Add(time.Second)) {
+		t.Fatalf("last should not move backwards, got %v", b.last)
+	}
+	// 暂停结束 100ms 后只累计 1 个令牌，而不是从 now 开始的 11 个
+	b.reserve(now.Add(time.Second + time.Millisecond*100))
+	if b.tokens > -0.99 || b.tokens < -1.01 {
+		t.Fatalf("unexpected tokens %v", b.tokens)
+	}
+}
+
+func TestApiTransportRetryRateLimited(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 第一次请求过期，校准后的重试被限流
+		if requests.Add(1) == 1 {
+			_, _ = w.Write([]byte(`{"code":4003}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"code":4009}`))
+	}))
+	defer srv.Close()
+
+	l := &RateLimiter{}
+	client := &http.Client{Transport: ApiTransport{AppKey: "key", AppSecret: "secret", Limiter: l, Offset: &ClockOffset{}}}
+	rsp, err := client.Post(srv.URL+"/v2/app/start", "application/json", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = rsp.Body.Close()
+	l.mu.Lock()
+	paused := l.buckets["/v2/app/start"].pausedUntil
+	l.mu.Unlock()
+	if requests.Load() != 2 || time.Until(paused) <= 0 {
+		t.Fatalf("retried request should report 4009 to limiter, got %d requests", requests.Load())
+	}
+}
+
+func TestSharedRateLimiter(t *testing.T) {
+	if SharedRateLimiter("a") != SharedRateLimiter("a") || SharedRateLimiter("a") == SharedRateLimiter("b") {
+		t.Fatal("rate limiter should be shared by app key")
+	}
+	a := &LiveClient{AppKey: "a"}
+	if a.getRateLimiter() != SharedRateLimiter("a") {
+		t.Fatal("client should use shared rate limiter by default")
+	}
+}
+
+func TestPeekResponseCodeLargeBody(t *testing.T) {
+	body := `{"code":4009,"data":"` + strings.Repeat("x", responseCodePeekSize*2) + `"}`
+	rsp := &http.Response{Body: io.NopCloser(strings.NewReader(body))}
+	code, err := peekResponseCode(rsp)
+	if err != nil || code != ErrRateLimited {
+		t.Fatalf("unexpected code %v %v", code, err)
+	}
+	// 只缓冲开头的部分，调用方仍然可以读取完整的响应体
+	rest, _ := io.ReadAll(rsp.Body)
+	if string(rest) != body {
+		t.Fatalf("body should be restored, got %d bytes", len(rest))
+	}
+}
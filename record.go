@@ -0,0 +1,202 @@
+package biliopen
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// 录制文件格式：每一帧为 8 字节接收时间（Unix 纳秒）+ 4 字节帧长度 + 原始帧数据，均为大端序，
+// 文件只追加写入，多次录制可以写入同一个文件
+
+const recordFrameHeaderSize = 8 + 4
+
+// FrameRecorder 接收 WebSocket 原始帧的录制钩子，在读取循环中调用，实现需要保证并发安全并尽快返回
+type FrameRecorder interface {
+	RecordFrame(receivedAt time.Time, frame []byte) error
+}
+
+// Recorder 将原始帧写入录制文件的 FrameRecorder 实现
+type Recorder struct {
+	mu sync.Mutex
+	w  *bufio.Writer
+	c  io.Closer
+}
+
+// NewRecorder 创建写入 w 的 Recorder，w 实现 io.Closer 时由 Close 一并关闭
+func NewRecorder(w io.Writer) *Recorder {
+	r := &Recorder{w: bufio.NewWriter(w)}
+	if c, ok := w.(io.Closer); ok {
+		r.c = c
+	}
+	return r
+}
+
+// CreateRecordFile 以追加模式打开录制文件，文件不存在时自动创建
+func CreateRecordFile(name string) (*Recorder, error) {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open record file fail: %w", err)
+	}
+	return NewRecorder(f), nil
+}
+
+// RecordFrame 写入一帧，每帧写入后立即 Flush，进程异常退出时不会丢失已接收的数据
+func (r *Recorder) RecordFrame(receivedAt time.Time, frame []byte) error {
+	var header [recordFrameHeaderSize]byte
+	binary.BigEndian.PutUint64(header[:8], uint64(receivedAt.UnixNano()))
+	binary.BigEndian.PutUint32(header[8:], uint32(len(frame)))
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.w.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := r.w.Write(frame); err != nil {
+		return err
+	}
+	return r.w.Flush()
+}
+
+// Close 写入缓冲中剩余的数据并关闭底层文件
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err := r.w.Flush()
+	if r.c != nil {
+		if cerr := r.c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// RecordedFrame 录制文件中的一帧
+type RecordedFrame struct {
+	// ReceivedAt 接收时间
+	ReceivedAt time.Time
+	// Data 原始帧数据，包含 16 字节协议头
+	Data []byte
+}
+
+// RecordReader 顺序读取录制文件
+type RecordReader struct {
+	r *bufio.Reader
+}
+
+// NewRecordReader 创建读取 r 的 RecordReader
+func NewRecordReader(r io.Reader) *RecordReader {
+	return &RecordReader{r: bufio.NewReader(r)}
+}
+
+// Next 读取下一帧，读取完毕时返回 io.EOF，文件末尾的帧不完整时返回 io.ErrUnexpectedEOF
+func (r *RecordReader) Next() (RecordedFrame, error) {
+	var header [recordFrameHeaderSize]byte
+	if _, err := io.ReadFull(r.r, header[:]); err != nil {
+		return RecordedFrame{}, err
+	}
+	size := int64(binary.BigEndian.Uint32(header[8:]))
+	frame := RecordedFrame{
+		ReceivedAt: time.Unix(0, int64(binary.BigEndian.Uint64(header[:8]))),
+	}
+	if size <= int64(wsProtoMaxPackSize)*4 {
+		frame.Data = make([]byte, size)
+		if _, err := io.ReadFull(r.r, frame.Data); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return RecordedFrame{}, err
+		}
+		return frame, nil
+	}
+	// Recorder 不限制帧长度，超大的帧按实际读取到的数据增长缓冲，避免损坏的长度字段一次分配过多内存
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, r.r, size); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return RecordedFrame{}, err
+	}
+	frame.Data = buf.Bytes()
+	return frame, nil
+}
+
+// Replayer 将录制文件回放到 LiveClient，消息经过和线上相同的解析与回调流程
+type Replayer struct {
+	// Client 接收回放消息的客户端，不需要调用 Connect
+	Client *LiveClient
+	// Speed 回放速度倍数，1 为按录制时的间隔实时回放，小于等于 0 时不等待，尽快回放
+	Speed float64
+}
+
+// ReplayFile 回放录制文件
+func (r *Replayer) ReplayFile(ctx context.Context, name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return fmt.Errorf("open record file fail: %w", err)
+	}
+	defer f.Close()
+	return r.Replay(ctx, f)
+}
+
+// Replay 回放 src 中的所有帧，无法解析的帧记录日志后跳过，ctx 取消时提前返回
+func (r *Replayer) Replay(ctx context.Context, src io.Reader) error {
+	ws := &liveWebsocketClient{
+		codec: r.Client.getCodec(),
+		onCmd: r.Client.handleCmd,
+		state: websocketClientStateAuth,
+	}
+	ws.initHandlers()
+	reader := NewRecordReader(src)
+	var first time.Time
+	start := time.Now()
+	for {
+		frame, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read frame fail: %w", err)
+		}
+		if first.IsZero() {
+			first = frame.ReceivedAt
+		}
+		if r.Speed > 0 {
+			offset := time.Duration(float64(frame.ReceivedAt.Sub(first)) / r.Speed)
+			if err = sleepContext(ctx, time.Until(start.Add(offset))); err != nil {
+				return err
+			}
+		} else if err = ctx.Err(); err != nil {
+			return err
+		}
+		msg, err := parseWsProtoMsg(frame.Data)
+		if err != nil {
+			ws.logger().Warn("parse recorded frame fail", zap.Error(err), zap.Time("received_at", frame.ReceivedAt))
+			continue
+		}
+		ws.dispatchMsg(msg)
+	}
+}
+
+// sleepContext 等待 d 时长或者 ctx 取消
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
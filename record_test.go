@@ -0,0 +1,99 @@
+package biliopen
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "live.rec")
+	start := time.Unix(1680000000, 0)
+	frames := [][]byte{
+		testWsFrame(wsProtoOpAuthReply, []byte(`{"code":0}`)),
+		{0x00, 0x01}, // 无法解析的帧也会原样录制，回放时跳过
+		testWsFrame(wsProtoOpSendMsgReply, testDanmakuBody),
+	}
+	// 两次打开同一个文件，验证追加写入
+	for i, frame := range frames {
+		rec, err := CreateRecordFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = rec.RecordFrame(start.Add(time.Duration(i)*time.Millisecond*50), frame); err != nil {
+			t.Fatal(err)
+		}
+		if err = rec.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []Danmaku
+	replayer := &Replayer{
+		Client: &LiveClient{OnDanmaku: func(dm Danmaku) { got = append(got, dm) }},
+		Speed:  2,
+	}
+	begin := time.Now()
+	if err := replayer.ReplayFile(context.Background(), name); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(begin); elapsed < time.Millisecond*50 {
+		t.Fatalf("replay at 2x should take about 50ms, took %v", elapsed)
+	}
+	if len(got) != 1 || got[0].Message != "hello" || got[0].MessageID != "abc" {
+		t.Fatalf("unexpected danmaku %+v", got)
+	}
+}
+
+func TestRecordReaderTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	rec := NewRecorder(&buf)
+	now := time.Now()
+	if err := rec.RecordFrame(now, []byte("frame")); err != nil {
+		t.Fatal(err)
+	}
+	buf.Truncate(buf.Len() - 1)
+	r := NewRecordReader(&buf)
+	if _, err := r.Next(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expect ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+func TestRecordReaderLargeFrame(t *testing.T) {
+	var buf bytes.Buffer
+	rec := NewRecorder(&buf)
+	now := time.Now()
+	large := bytes.Repeat([]byte{'x'}, int(wsProtoMaxPackSize)*4+1)
+	_ = rec.RecordFrame(now, large)
+	_ = rec.RecordFrame(now, []byte("frame"))
+	r := NewRecordReader(bytes.NewReader(buf.Bytes()))
+	if f, err := r.Next(); err != nil || !bytes.Equal(f.Data, large) {
+		t.Fatalf("expect large frame, got %d bytes %v", len(f.Data), err)
+	}
+	if f, err := r.Next(); err != nil || string(f.Data) != "frame" {
+		t.Fatalf("expect frame after large frame, got %q %v", f.Data, err)
+	}
+	// 超大帧不完整时同样返回 ErrUnexpectedEOF
+	r = NewRecordReader(bytes.NewReader(buf.Bytes()[:recordFrameHeaderSize+10]))
+	if _, err := r.Next(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expect ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+func TestReplayCancel(t *testing.T) {
+	var buf bytes.Buffer
+	rec := NewRecorder(&buf)
+	now := time.Now()
+	_ = rec.RecordFrame(now, testWsFrame(wsProtoOpSendMsgReply, testDanmakuBody))
+	_ = rec.RecordFrame(now.Add(time.Hour), testWsFrame(wsProtoOpSendMsgReply, testDanmakuBody))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+	replayer := &Replayer{Client: &LiveClient{}, Speed: 1}
+	if err := replayer.Replay(ctx, &buf); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect deadline exceeded, got %v", err)
+	}
+}
@@ -0,0 +1,473 @@
+// Package roster 大航海名单
+//
+// 根据大航海购买事件维护当前的舰长、提督和总督，按购买数量和单位计算到期时间，支持续费和升级，
+// 高等级生效期间低等级的剩余时长顺延。名单保存在可替换的 Store 中，可以用于弹幕命令的权限判断：
+//
+//	store, err := roster.OpenFileStore("roster.json")
+//	if err != nil { ... }
+//	r := &roster.Roster{Store: store, OnChange: func(c roster.Change) { ... }}
+//	r.Attach(client)
+//	go r.Run(ctx)
+//	d := &command.Dispatcher{RoleFunc: r.RoleFunc}
+package roster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	biliopen "github.com/fython/bili-open-live-go"
+	"github.com/fython/bili-open-live-go/command"
+)
+
+const (
+	// Month 大航海 1 个月的时长
+	Month = biliopen.GuardMonth
+	// Day 大航海 1 天的时长
+	Day = biliopen.GuardDay
+
+	defaultNoticeBefore  = Day * 3
+	defaultCheckInterval = time.Minute
+)
+
+// errDuplicate 重复推送的大航海消息
+var errDuplicate = errors.New("duplicate guard message")
+
+// guardLevels 大航海等级，从高到低
+var guardLevels = []biliopen.GuardLevel{
+	biliopen.GuardLevelGovernor,
+	biliopen.GuardLevelAdmiral,
+	biliopen.GuardLevelCaptain,
+}
+
+// Member 大航海成员
+type Member struct {
+	// Identity 成员唯一标识，见 biliopen.UserInfo.Identity
+	Identity string `json:"identity"`
+	UID      int    `json:"uid,omitempty"`
+	OpenID   string `json:"open_id,omitempty"`
+	Username string `json:"uname,omitempty"`
+	// Expiry 各等级的到期时间，低等级的到期时间已经包含高等级生效期间的顺延
+	Expiry map[biliopen.GuardLevel]time.Time `json:"expiry"`
+	// Level 最近一次购买或检查时的等级，用于判断等级变化，当前等级以 LevelAt 为准
+	Level biliopen.GuardLevel `json:"level"`
+	// Since 首次开通时间
+	Since time.Time `json:"since"`
+	// UpdatedAt 最近一次开通或续费时间
+	UpdatedAt time.Time `json:"updated_at"`
+	// Notified 已经发送过到期提醒的到期时间，续费后到期时间变化会重新提醒
+	Notified time.Time `json:"notified"`
+}
+
+// LevelAt t 时刻的大航海等级，已经过期时为 GuardLevelNone
+func (m Member) LevelAt(t time.Time) biliopen.GuardLevel {
+	for _, l := range guardLevels {
+		if m.Expiry[l].After(t) {
+			return l
+		}
+	}
+	return biliopen.GuardLevelNone
+}
+
+// ExpiresAt t 时刻所在等级的到期时间，到期后可能降为低等级，已经过期时为零值
+func (m Member) ExpiresAt(t time.Time) time.Time {
+	return m.Expiry[m.LevelAt(t)]
+}
+
+// Until 所有等级都到期的时间，即不再是大航海成员的时间
+func (m Member) Until() time.Time {
+	var until time.Time
+	for _, exp := range m.Expiry {
+		if exp.After(until) {
+			until = exp
+		}
+	}
+	return until
+}
+
+func (m Member) clone() Member {
+	if m.Expiry != nil {
+		expiry := make(map[biliopen.GuardLevel]time.Time, len(m.Expiry))
+		for l, exp := range m.Expiry {
+			expiry[l] = exp
+		}
+		m.Expiry = expiry
+	}
+	return m
+}
+
+// extend 为 level 增加 d 的时长，高等级生效期间购买的低等级从高等级到期后开始计算，低等级的剩余时长顺延
+func (m *Member) extend(level biliopen.GuardLevel, d time.Duration, now time.Time) {
+	if m.Expiry == nil {
+		m.Expiry = make(map[biliopen.GuardLevel]time.Time)
+	}
+	for l, exp := range m.Expiry {
+		if !exp.After(now) {
+			delete(m.Expiry, l)
+		}
+	}
+	start := now
+	if exp, ok := m.Expiry[level]; ok {
+		start = exp
+	} else {
+		for _, l := range guardLevels {
+			if l < level && m.Expiry[l].After(start) {
+				start = m.Expiry[l]
+			}
+		}
+	}
+	m.Expiry[level] = start.Add(d)
+	for _, l := range guardLevels {
+		if exp, ok := m.Expiry[l]; ok && l > level {
+			m.Expiry[l] = exp.Add(d)
+		}
+	}
+}
+
+// ChangeType 名单变化类型
+type ChangeType string
+
+const (
+	// ChangeJoined 开通大航海，包括过期后重新开通
+	ChangeJoined ChangeType = "joined"
+	// ChangeRenewed 续费当前等级或购买低等级
+	ChangeRenewed ChangeType = "renewed"
+	// ChangeUpgraded 购买更高等级
+	ChangeUpgraded ChangeType = "upgraded"
+	// ChangeDowngraded 高等级到期后降为低等级
+	ChangeDowngraded ChangeType = "downgraded"
+	// ChangeExpiring 即将到期，每个到期时间只提醒一次
+	ChangeExpiring ChangeType = "expiring"
+	// ChangeExpired 已经过期
+	ChangeExpired ChangeType = "expired"
+)
+
+// Change 名单变化事件
+type Change struct {
+	Type   ChangeType `json:"type"`
+	Member Member     `json:"member"`
+	// Previous 变化前的等级
+	Previous biliopen.GuardLevel `json:"previous"`
+}
+
+// Roster 大航海名单，零值可以直接使用，并发安全
+type Roster struct {
+	// Store 名单存储，默认为 MemoryStore
+	Store Store
+	// NoticeBefore 到期前多久发送 ChangeExpiring，默认 3 天，为负数时不提醒
+	NoticeBefore time.Duration
+	// CheckInterval Run 检查到期的间隔，默认 1 分钟
+	CheckInterval time.Duration
+	// OnChange 名单变化时回调，在锁外调用
+	OnChange func(c Change)
+
+	mu    sync.Mutex
+	store Store
+	// dedup 过滤重连后重复推送的消息
+	dedup biliopen.Deduplicator
+
+	// now 测试时替换当前时间
+	now func() time.Time
+}
+
+func (r *Roster) getStore() Store {
+	if r.Store != nil {
+		return r.Store
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.store == nil {
+		r.store = &MemoryStore{}
+	}
+	return r.store
+}
+
+func (r *Roster) getNow() time.Time {
+	if r.now != nil {
+		return r.now()
+	}
+	return time.Now()
+}
+
+func (r *Roster) getNoticeBefore() time.Duration {
+	if r.NoticeBefore == 0 {
+		return defaultNoticeBefore
+	}
+	return r.NoticeBefore
+}
+
+func (r *Roster) getCheckInterval() time.Duration {
+	if r.CheckInterval <= 0 {
+		return defaultCheckInterval
+	}
+	return r.CheckInterval
+}
+
+func (r *Roster) emit(changes ...Change) {
+	if r.OnChange == nil {
+		return
+	}
+	for _, c := range changes {
+		r.OnChange(c)
+	}
+}
+
+// find 依次按 u 的所有标识查找，兼容迁移前以 UID 保存的成员
+func find(store Store, u biliopen.UserInfo) (Member, bool, error) {
+	for _, identity := range u.Aliases() {
+		if m, ok, err := store.Get(identity); err != nil || ok {
+			return m, ok, err
+		}
+	}
+	return Member{}, false, nil
+}
+
+// Add 为用户增加 num 个单位的大航海时长，单位见 biliopen.GuardDuration，可以用于导入已有的大航海名单
+func (r *Roster) Add(u biliopen.UserInfo, level biliopen.GuardLevel, num int, unit string) (Member, error) {
+	return r.add(u, level, num, unit, "", "")
+}
+
+// add 增加大航海时长，msgID 不为空时在写入成功后记录，已经记录过的消息返回 errDuplicate
+func (r *Roster) add(u biliopen.UserInfo, level biliopen.GuardLevel, num int, unit string, cmd, msgID string) (Member, error) {
+	if !level.IsGuard() {
+		return Member{}, fmt.Errorf("invalid guard level %d", level)
+	}
+	if u.Identity() == "" {
+		return Member{}, fmt.Errorf("user identity is required")
+	}
+	d, err := biliopen.GuardDuration(num, unit)
+	if err != nil {
+		return Member{}, err
+	}
+	store := r.getStore()
+	now := r.getNow()
+	r.mu.Lock()
+	if msgID != "" && r.dedup.Seen(msgID) {
+		r.mu.Unlock()
+		return Member{}, errDuplicate
+	}
+	m, ok, err := find(store, u)
+	if err != nil {
+		r.mu.Unlock()
+		return Member{}, fmt.Errorf("get member fail: %w", err)
+	}
+	if !ok {
+		m = Member{Identity: u.Identity(), Since: now}
+	}
+	if u.UID != 0 {
+		m.UID = u.UID
+	}
+	if u.OpenID != "" {
+		m.OpenID = u.OpenID
+	}
+	if u.Username != "" {
+		m.Username = u.Username
+	}
+	prev := m.LevelAt(now)
+	m.extend(level, d, now)
+	m.Level = m.LevelAt(now)
+	m.UpdatedAt = now
+	if err = store.Put(m); err != nil {
+		r.mu.Unlock()
+		return Member{}, fmt.Errorf("put member fail: %w", err)
+	}
+	// 写入成功后才记录 msg_id，写入失败的消息重新推送时可以再次处理
+	r.dedup.Duplicate(cmd, msgID)
+	r.mu.Unlock()
+
+	c := Change{Type: ChangeRenewed, Member: m, Previous: prev}
+	switch {
+	case !prev.IsGuard():
+		c.Type = ChangeJoined
+	case m.Level < prev:
+		c.Type = ChangeUpgraded
+	}
+	r.emit(c)
+	return m, nil
+}
+
+// Remove 移除成员，例如处理退款
+func (r *Roster) Remove(identity string) error {
+	store := r.getStore()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := store.Delete(identity); err != nil {
+		return fmt.Errorf("delete member fail: %w", err)
+	}
+	return nil
+}
+
+// Get 获取用户的大航海信息，会按 open_id 和 uid 查找，没有开通过或已经过期时返回 false
+func (r *Roster) Get(u biliopen.UserInfo) (Member, bool, error) {
+	store := r.getStore()
+	now := r.getNow()
+	m, ok, err := find(store, u)
+	if err != nil {
+		return Member{}, false, fmt.Errorf("get member fail: %w", err)
+	}
+	if !ok || !m.LevelAt(now).IsGuard() {
+		return Member{}, false, nil
+	}
+	return m, true, nil
+}
+
+// Level 用户当前的大航海等级，不是大航海成员或者查询失败时为 GuardLevelNone
+func (r *Roster) Level(u biliopen.UserInfo) biliopen.GuardLevel {
+	m, ok, err := r.Get(u)
+	if err != nil {
+		zap.L().Warn("get roster member fail", zap.String("identity", u.Identity()), zap.Error(err))
+		return biliopen.GuardLevelNone
+	}
+	if !ok {
+		return biliopen.GuardLevelNone
+	}
+	return m.LevelAt(r.getNow())
+}
+
+// IsGuard 用户当前是否为大航海成员
+func (r *Roster) IsGuard(u biliopen.UserInfo) bool {
+	return r.Level(u).IsGuard()
+}
+
+// GuardAtLeast 事件用户在名单中的等级不低于 level，与 biliopen.GuardAtLeast 不同，不依赖事件中的大航海等级
+func (r *Roster) GuardAtLeast(level biliopen.GuardLevel) biliopen.Predicate {
+	return func(e biliopen.Event) bool {
+		u, ok := biliopen.EventUser(e)
+		return ok && r.Level(u).AtLeast(level)
+	}
+}
+
+// RoleFunc 在 command.RoleOf 的基础上按名单提升角色，可以作为 command.Dispatcher.RoleFunc 使用
+func (r *Roster) RoleFunc(dm biliopen.Danmaku) command.Role {
+	role := command.RoleOf(dm)
+	var guard command.Role
+	switch r.Level(dm.UserInfo) {
+	case biliopen.GuardLevelGovernor:
+		guard = command.RoleGovernor
+	case biliopen.GuardLevelAdmiral:
+		guard = command.RoleAdmiral
+	case biliopen.GuardLevelCaptain:
+		guard = command.RoleCaptain
+	}
+	if guard > role {
+		return guard
+	}
+	return role
+}
+
+// Members 当前的大航海成员，按等级从高到低、到期时间从早到晚排序
+func (r *Roster) Members() ([]Member, error) {
+	return r.filter(func(m Member, now time.Time) bool {
+		return m.LevelAt(now).IsGuard()
+	})
+}
+
+// Expiring 在 within 内完全到期的大航海成员，排序同 Members
+func (r *Roster) Expiring(within time.Duration) ([]Member, error) {
+	return r.filter(func(m Member, now time.Time) bool {
+		return m.LevelAt(now).IsGuard() && !m.Until().After(now.Add(within))
+	})
+}
+
+func (r *Roster) filter(keep func(m Member, now time.Time) bool) ([]Member, error) {
+	list, err := r.getStore().List()
+	if err != nil {
+		return nil, fmt.Errorf("list members fail: %w", err)
+	}
+	now := r.getNow()
+	var members []Member
+	for _, m := range list {
+		if keep(m, now) {
+			members = append(members, m)
+		}
+	}
+	sort.SliceStable(members, func(i, j int) bool {
+		li, lj := members[i].LevelAt(now), members[j].LevelAt(now)
+		if li != lj {
+			return li < lj
+		}
+		return members[i].ExpiresAt(now).Before(members[j].ExpiresAt(now))
+	})
+	return members, nil
+}
+
+// Check 检查到期和即将到期的成员并回调 OnChange，Run 会定期调用
+func (r *Roster) Check() error {
+	store := r.getStore()
+	notice := r.getNoticeBefore()
+	now := r.getNow()
+	r.mu.Lock()
+	list, err := store.List()
+	if err != nil {
+		r.mu.Unlock()
+		return fmt.Errorf("list members fail: %w", err)
+	}
+	var changes []Change
+	for _, m := range list {
+		prev := m.Level
+		cur := m.LevelAt(now)
+		changed := false
+		if cur != prev {
+			m.Level = cur
+			changed = true
+			if cur.IsGuard() {
+				changes = append(changes, Change{Type: ChangeDowngraded, Member: m, Previous: prev})
+			} else {
+				changes = append(changes, Change{Type: ChangeExpired, Member: m, Previous: prev})
+			}
+		}
+		if until := m.Until(); cur.IsGuard() && notice > 0 && !until.After(now.Add(notice)) && !m.Notified.Equal(until) {
+			m.Notified = until
+			changed = true
+			changes = append(changes, Change{Type: ChangeExpiring, Member: m, Previous: cur})
+		}
+		if changed {
+			if err = store.Put(m); err != nil {
+				r.mu.Unlock()
+				r.emit(changes...)
+				return fmt.Errorf("put member fail: %w", err)
+			}
+		}
+	}
+	r.mu.Unlock()
+	r.emit(changes...)
+	return nil
+}
+
+// Run 定期检查到期的成员，直到 ctx 结束
+func (r *Roster) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.getCheckInterval())
+	defer ticker.Stop()
+	for {
+		if err := r.Check(); err != nil {
+			zap.L().Warn("check roster fail", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Attach 注册大航海路由，返回的 RouteID 可以用于 RemoveRoute
+func (r *Roster) Attach(c *biliopen.LiveClient) biliopen.RouteID {
+	return c.Route(biliopen.IsCmd(biliopen.CmdLiveOpenPlatformGuard), r.Handle)
+}
+
+// Handle 处理大航海事件，可以作为 biliopen.Handler 使用，重复推送的消息按 msg_id 只计一次
+func (r *Roster) Handle(e biliopen.Event) error {
+	g, ok := e.Data.(biliopen.Guard)
+	if !ok || !g.GuardLevel.IsGuard() {
+		return nil
+	}
+	if _, err := r.add(g.UserInfo, g.GuardLevel, g.GuardNum, g.GuardUnit, e.Cmd, g.MessageID); err != nil && err != errDuplicate {
+		return err
+	}
+	return nil
+}
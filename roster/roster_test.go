@@ -0,0 +1,165 @@
+package roster
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	biliopen "github.com/fython/bili-open-live-go"
+	"github.com/fython/bili-open-live-go/command"
+)
+
+func guardEvent(u biliopen.UserInfo, msgID string, level biliopen.GuardLevel, num int, unit string) biliopen.Event {
+	return biliopen.Event{Cmd: biliopen.CmdLiveOpenPlatformGuard, Data: biliopen.Guard{
+		UserInfo: u, MessageID: msgID, GuardLevel: level, GuardNum: num, GuardUnit: unit,
+	}}
+}
+
+func TestRoster(t *testing.T) {
+	now := time.Date(2024, 5, 1, 20, 0, 0, 0, time.UTC)
+	var changes []Change
+	r := &Roster{
+		OnChange: func(c Change) { changes = append(changes, c) },
+		now:      func() time.Time { return now },
+	}
+	step := func(d time.Duration, ev biliopen.Event) {
+		t.Helper()
+		now = now.Add(d)
+		if err := r.Handle(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	alice := biliopen.UserInfo{OpenID: "alice", UID: 1, Username: "alice"}
+	step(0, guardEvent(alice, "g1", biliopen.GuardLevelCaptain, 1, "月"))
+	step(0, guardEvent(alice, "g1", biliopen.GuardLevelCaptain, 1, "月"))
+	// 10 天后升级提督，舰长剩余的 20 天顺延到提督到期之后
+	step(Day*10, guardEvent(alice, "g2", biliopen.GuardLevelAdmiral, 1, "月"))
+	m, ok, err := r.Get(biliopen.UserInfo{UID: 1, OpenID: "alice"})
+	if err != nil || !ok || m.LevelAt(now) != biliopen.GuardLevelAdmiral ||
+		!m.ExpiresAt(now).Equal(now.Add(Month)) || !m.Until().Equal(now.Add(Month+Day*20)) {
+		t.Fatalf("unexpected member %+v %v %v", m, ok, err)
+	}
+	// 提督生效期间续费舰长，从舰长到期后开始计算
+	step(0, guardEvent(alice, "g3", biliopen.GuardLevelCaptain, 7, "天"))
+	if m, _, _ = r.Get(alice); !m.Until().Equal(now.Add(Month + Day*27)) {
+		t.Fatalf("unexpected until %v", m.Until())
+	}
+	if len(changes) != 3 || changes[0].Type != ChangeJoined || changes[1].Type != ChangeUpgraded ||
+		changes[1].Previous != biliopen.GuardLevelCaptain || changes[2].Type != ChangeRenewed {
+		t.Fatalf("unexpected changes %+v", changes)
+	}
+
+	d := &command.Dispatcher{RoleFunc: r.RoleFunc}
+	if role := d.RoleFunc(biliopen.Danmaku{UserInfo: biliopen.UserInfo{OpenID: "alice"}}); role != command.RoleAdmiral {
+		t.Fatalf("expect admiral, got %v", role)
+	}
+	if !r.GuardAtLeast(biliopen.GuardLevelAdmiral)(biliopen.Event{Data: biliopen.Danmaku{UserInfo: alice}}) {
+		t.Fatal("expect admiral predicate to match")
+	}
+
+	// 提督到期前 3 天提醒的是完全到期时间，到期后降为舰长
+	changes = nil
+	now = now.Add(Month - Day)
+	if err = r.Check(); err != nil || len(changes) != 0 {
+		t.Fatalf("unexpected changes %+v %v", changes, err)
+	}
+	now = now.Add(Day * 2)
+	_ = r.Check()
+	if len(changes) != 1 || changes[0].Type != ChangeDowngraded || changes[0].Member.Level != biliopen.GuardLevelCaptain {
+		t.Fatalf("unexpected changes %+v", changes)
+	}
+	now = now.Add(Day * 24)
+	_ = r.Check()
+	_ = r.Check()
+	if len(changes) != 2 || changes[1].Type != ChangeExpiring {
+		t.Fatalf("unexpected changes %+v", changes)
+	}
+	if members, _ := r.Expiring(Day * 3); len(members) != 1 || members[0].Identity != "alice" {
+		t.Fatalf("unexpected expiring members %+v", members)
+	}
+	now = now.Add(Day * 3)
+	_ = r.Check()
+	if len(changes) != 3 || changes[2].Type != ChangeExpired || r.IsGuard(alice) {
+		t.Fatalf("unexpected changes %+v", changes)
+	}
+	if members, _ := r.Members(); len(members) != 0 {
+		t.Fatalf("unexpected members %+v", members)
+	}
+	// 过期后重新开通
+	step(0, guardEvent(alice, "g4", biliopen.GuardLevelGovernor, 1, "月"))
+	if len(changes) != 4 || changes[3].Type != ChangeJoined || r.Level(alice) != biliopen.GuardLevelGovernor {
+		t.Fatalf("unexpected changes %+v", changes)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "roster.json")
+	s, err := OpenFileStore(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	r := &Roster{Store: s}
+	if _, err = r.Add(biliopen.UserInfo{UID: 2}, biliopen.GuardLevelCaptain, 3, "月"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = r.Add(biliopen.UserInfo{UID: 3}, biliopen.GuardLevelGovernor, 1, "月"); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = OpenFileStore(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = &Roster{Store: s}
+	members, err := r.Members()
+	if err != nil || len(members) != 2 || members[0].UID != 3 || members[1].UID != 2 {
+		t.Fatalf("unexpected members %+v %v", members, err)
+	}
+	if until := members[1].Until(); until.Before(now.Add(Month*3)) || until.After(time.Now().Add(Month*3)) {
+		t.Fatalf("unexpected until %v", until)
+	}
+	// open_id 找不到时按 uid 查找
+	if !r.IsGuard(biliopen.UserInfo{UID: 2, OpenID: "bob"}) {
+		t.Fatal("expect lookup by uid")
+	}
+	if err = r.Remove("uid:2"); err != nil || r.IsGuard(biliopen.UserInfo{UID: 2}) {
+		t.Fatalf("expect removed, got %v", err)
+	}
+}
+
+type failingStore struct {
+	MemoryStore
+	fail bool
+}
+
+func (s *failingStore) Put(m Member) error {
+	if s.fail {
+		return errors.New("put fail")
+	}
+	return s.MemoryStore.Put(m)
+}
+
+func TestRosterDedupAfterPut(t *testing.T) {
+	s := &failingStore{fail: true}
+	r := &Roster{Store: s}
+	ev := guardEvent(biliopen.UserInfo{OpenID: "bob"}, "g1", biliopen.GuardLevelCaptain, 1, "月")
+	if err := r.Handle(ev); err == nil {
+		t.Fatal("expect put error")
+	}
+	// 写入失败的消息重新推送后仍然会处理
+	s.fail = false
+	if err := r.Handle(ev); err != nil || !r.IsGuard(biliopen.UserInfo{OpenID: "bob"}) {
+		t.Fatalf("expect redelivered guard to be added, got %v", err)
+	}
+}
+
+func TestGuardUnknownUnit(t *testing.T) {
+	// 无法识别的单位返回错误，不记录 msg_id
+	r := &Roster{}
+	ev := guardEvent(biliopen.UserInfo{OpenID: "carol"}, "g1", biliopen.GuardLevelCaptain, 1, "年")
+	if err := r.Handle(ev); err == nil || r.IsGuard(biliopen.UserInfo{OpenID: "carol"}) {
+		t.Fatalf("expect unknown unit error, got %v", err)
+	}
+}
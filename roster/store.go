@@ -0,0 +1,159 @@
+package roster
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/fython/bili-open-live-go/internal/atomicfile"
+)
+
+// Store 舰队名单存储，实现需要保证并发安全
+type Store interface {
+	// Get 按 Identity 获取成员，不存在时返回 false
+	Get(identity string) (Member, bool, error)
+	// Put 新增或覆盖成员
+	Put(m Member) error
+	// Delete 删除成员，不存在时不返回错误
+	Delete(identity string) error
+	// List 所有成员，包括已经过期的成员，按 Identity 排序
+	List() ([]Member, error)
+}
+
+// MemoryStore 内存存储，进程退出后数据丢失，零值可以直接使用
+type MemoryStore struct {
+	mu      sync.Mutex
+	members map[string]Member
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+func (s *MemoryStore) Get(identity string) (Member, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.members[identity]
+	return m.clone(), ok, nil
+}
+
+func (s *MemoryStore) Put(m Member) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.members == nil {
+		s.members = make(map[string]Member)
+	}
+	s.members[m.Identity] = m.clone()
+	return nil
+}
+
+func (s *MemoryStore) Delete(identity string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.members, identity)
+	return nil
+}
+
+func (s *MemoryStore) List() ([]Member, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sortedMembers(s.members), nil
+}
+
+func sortedMembers(members map[string]Member) []Member {
+	list := make([]Member, 0, len(members))
+	for _, m := range members {
+		list = append(list, m.clone())
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Identity < list[j].Identity
+	})
+	return list
+}
+
+// FileStore 基于文件的存储，每次修改后将完整名单写入临时文件再重命名
+type FileStore struct {
+	name string
+
+	mu      sync.Mutex
+	members map[string]Member
+}
+
+var _ Store = (*FileStore)(nil)
+
+// OpenFileStore 打开名单文件，文件不存在时在第一次修改后创建
+func OpenFileStore(name string) (*FileStore, error) {
+	s := &FileStore{name: name, members: make(map[string]Member)}
+	data, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("read roster fail: %w", err)
+	}
+	var list []Member
+	if err = json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("unmarshal roster fail: %w", err)
+	}
+	for _, m := range list {
+		s.members[m.Identity] = m
+	}
+	return s, nil
+}
+
+func (s *FileStore) Get(identity string) (Member, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.members[identity]
+	return m.clone(), ok, nil
+}
+
+func (s *FileStore) Put(m Member) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, existed := s.members[m.Identity]
+	s.members[m.Identity] = m.clone()
+	if err := s.save(); err != nil {
+		// 写入失败时回滚，保证内存与文件一致
+		if existed {
+			s.members[m.Identity] = prev
+		} else {
+			delete(s.members, m.Identity)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *FileStore) Delete(identity string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, existed := s.members[identity]
+	if !existed {
+		return nil
+	}
+	delete(s.members, identity)
+	if err := s.save(); err != nil {
+		s.members[identity] = prev
+		return err
+	}
+	return nil
+}
+
+func (s *FileStore) List() ([]Member, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sortedMembers(s.members), nil
+}
+
+// save 写入临时文件后重命名，调用方需要持有锁
+func (s *FileStore) save() error {
+	data, err := json.Marshal(sortedMembers(s.members))
+	if err != nil {
+		return fmt.Errorf("marshal roster fail: %w", err)
+	}
+	if err = atomicfile.WriteFile(s.name, data); err != nil {
+		return fmt.Errorf("write roster fail: %w", err)
+	}
+	return nil
+}
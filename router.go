@@ -0,0 +1,296 @@
+package biliopen
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+)
+
+// Predicate 事件过滤条件，可以通过 And、Or、Not 组合
+type Predicate func(e Event) bool
+
+// RouteID 路由 ID，用于移除路由
+type RouteID uint64
+
+type route struct {
+	id        RouteID
+	predicate Predicate
+	handler   Handler
+}
+
+// Route 注册路由，满足 p 的事件会交给 h 处理，p 为空时匹配所有事件，可以在连接后随时注册
+//
+// 路由在中间件链的末端、回调之后执行，同一个事件可以匹配多个路由
+func (c *LiveClient) Route(p Predicate, h Handler) RouteID {
+	c.middlewareMu.Lock()
+	defer c.middlewareMu.Unlock()
+	c.routeSeq++
+	r := route{id: RouteID(c.routeSeq), predicate: p, handler: h}
+	var routes []route
+	if old := c.routes.Load(); old != nil {
+		routes = append(routes, *old...)
+	}
+	routes = append(routes, r)
+	c.routes.Store(&routes)
+	return r.id
+}
+
+// RemoveRoute 移除路由，路由不存在时返回 false
+func (c *LiveClient) RemoveRoute(id RouteID) bool {
+	c.middlewareMu.Lock()
+	defer c.middlewareMu.Unlock()
+	old := c.routes.Load()
+	if old == nil {
+		return false
+	}
+	routes := make([]route, 0, len(*old))
+	for _, r := range *old {
+		if r.id != id {
+			routes = append(routes, r)
+		}
+	}
+	if len(routes) == len(*old) {
+		return false
+	}
+	if len(routes) == 0 {
+		c.routes.Store(nil)
+	} else {
+		c.routes.Store(&routes)
+	}
+	return true
+}
+
+// dispatchRoutes 将事件交给所有匹配的路由处理
+func (c *LiveClient) dispatchRoutes(e Event) error {
+	routes := c.routes.Load()
+	if routes == nil {
+		return nil
+	}
+	var errs []error
+	for _, r := range *routes {
+		if r.predicate != nil && !r.predicate(e) {
+			continue
+		}
+		if err := r.handler(e); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// And 所有条件都满足
+func And(ps ...Predicate) Predicate {
+	return func(e Event) bool {
+		for _, p := range ps {
+			if !p(e) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Or 任一条件满足
+func Or(ps ...Predicate) Predicate {
+	return func(e Event) bool {
+		for _, p := range ps {
+			if p(e) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not 条件不满足
+func Not(p Predicate) Predicate {
+	return func(e Event) bool {
+		return !p(e)
+	}
+}
+
+// IsCmd 事件为指定的 cmd 之一
+func IsCmd(cmds ...string) Predicate {
+	return func(e Event) bool {
+		for _, cmd := range cmds {
+			if e.Cmd == cmd {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// DanmakuTypeIs 弹幕类型为指定的类型之一，非弹幕事件不满足
+func DanmakuTypeIs(types ...DanmakuType) Predicate {
+	return func(e Event) bool {
+		dm, ok := e.Data.(Danmaku)
+		if !ok {
+			return false
+		}
+		for _, t := range types {
+			if dm.DMType == t {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MedalLevelAtLeast 粉丝勋章等级不低于 level，没有勋章信息的事件不满足
+func MedalLevelAtLeast(level int) Predicate {
+	return func(e Event) bool {
+		medal, ok := EventFansMedal(e)
+		return ok && medal.FansMedalLevel >= level
+	}
+}
+
+// WearingMedal 佩戴了当前主播的粉丝勋章
+func WearingMedal() Predicate {
+	return func(e Event) bool {
+		medal, ok := EventFansMedal(e)
+		return ok && medal.FansMedalWearingStatus
+	}
+}
+
+// IsAdmin 发送者为房管，只有弹幕事件包含该信息
+func IsAdmin() Predicate {
+	return func(e Event) bool {
+		dm, ok := e.Data.(Danmaku)
+		return ok && bool(dm.Admin)
+	}
+}
+
+// GuardAtLeast 大航海等级不低于 level，例如 GuardAtLeast(GuardLevelCaptain) 匹配所有大航海成员，
+// 大航海购买事件按购买的等级判断
+func GuardAtLeast(level GuardLevel) Predicate {
+	return func(e Event) bool {
+		return EventGuardLevel(e).AtLeast(level)
+	}
+}
+
+// ValueAtLeast 付费价值不低于 value，单位同 Gift.Price，即 1000 = 1 元，计算方式见 EventValue
+func ValueAtLeast(value int64) Predicate {
+	return func(e Event) bool {
+		return EventValue(e) >= value
+	}
+}
+
+// MessageMatches 弹幕或醒目留言的内容匹配正则表达式
+func MessageMatches(re *regexp.Regexp) Predicate {
+	return func(e Event) bool {
+		msg, ok := EventMessage(e)
+		return ok && re.MatchString(msg)
+	}
+}
+
+// UserIn 发送者在列表中，列表项可以为 Identity、OpenID 或者 UID
+func UserIn(users ...string) Predicate {
+	set := make(map[string]bool, len(users))
+	for _, u := range users {
+		set[u] = true
+	}
+	return func(e Event) bool {
+		user, ok := EventUser(e)
+		return ok && matchUser(set, user)
+	}
+}
+
+// UserNotIn 发送者不在列表中，没有用户信息的事件也满足
+func UserNotIn(users ...string) Predicate {
+	return Not(UserIn(users...))
+}
+
+func matchUser(set map[string]bool, user UserInfo) bool {
+	if id := user.Identity(); id != "" && set[id] {
+		return true
+	}
+	if user.OpenID != "" && set[user.OpenID] {
+		return true
+	}
+	return user.UID != 0 && set[strconv.Itoa(user.UID)]
+}
+
+// EventUser 事件的发送者，醒目留言下线等没有用户信息的事件返回 false
+func EventUser(e Event) (UserInfo, bool) {
+	switch data := e.Data.(type) {
+	case Danmaku:
+		return data.UserInfo, true
+	case Gift:
+		return data.UserInfo, true
+	case SuperChat:
+		return data.UserInfo, true
+	case Guard:
+		return data.UserInfo, true
+	case Like:
+		return data.UserInfo, true
+	default:
+		return UserInfo{}, false
+	}
+}
+
+// EventFansMedal 事件发送者的粉丝勋章
+func EventFansMedal(e Event) (FansMedal, bool) {
+	switch data := e.Data.(type) {
+	case Danmaku:
+		return data.FansMedal, true
+	case Gift:
+		return data.FansMedal, true
+	case SuperChat:
+		return data.FansMedal, true
+	case Guard:
+		return data.FansMedal, true
+	case Like:
+		return data.FansMedal, true
+	default:
+		return FansMedal{}, false
+	}
+}
+
+// EventGuardLevel 事件发送者的大航海等级，大航海购买事件为购买的等级
+func EventGuardLevel(e Event) GuardLevel {
+	switch data := e.Data.(type) {
+	case Danmaku:
+		return data.GuardLevel
+	case Gift:
+		return data.GuardLevel
+	case SuperChat:
+		return data.GuardLevel
+	case Guard:
+		return data.GuardLevel
+	default:
+		return GuardLevelNone
+	}
+}
+
+// EventMessage 弹幕或醒目留言的内容
+func EventMessage(e Event) (string, bool) {
+	switch data := e.Data.(type) {
+	case Danmaku:
+		return data.Message, true
+	case SuperChat:
+		return data.Message, true
+	default:
+		return "", false
+	}
+}
+
+// EventValue 事件的付费价值，单位同 Gift.Price，即 1000 = 1 元
+//
+// 付费礼物为 Gift.PaidPrice，即用户实际支付的金额，盲盒按购买盲盒的价格而不是爆出礼物的价值计算，免费礼物为 0，
+// 醒目留言为 RMB * 1000，大航海为 Guard.Price，即本次购买的支付金额，已经包含 GuardNum，其余事件为 0
+func EventValue(e Event) int64 {
+	switch data := e.Data.(type) {
+	case Gift:
+		if !data.Paid {
+			return 0
+		}
+		return data.PaidPrice()
+	case SuperChat:
+		return int64(data.RMB) * 1000
+	case Guard:
+		return int64(data.Price)
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,142 @@
+package biliopen
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestRouter(t *testing.T) {
+	c := &LiveClient{}
+	var commands, bigGifts []Event
+	cmdRoute := c.Route(And(
+		IsCmd(CmdLiveOpenPlatformDm),
+		DanmakuTypeIs(DanmakuTypeText),
+		MedalLevelAtLeast(10),
+		MessageMatches(regexp.MustCompile(`^!`)),
+		UserNotIn("uid:3"),
+	), func(e Event) error {
+		commands = append(commands, e)
+		return nil
+	})
+	c.Route(ValueAtLeast(10000), func(e Event) error {
+		bigGifts = append(bigGifts, e)
+		return errors.New("route error")
+	})
+
+	for _, dm := range []string{
+		`{"uid":1,"msg":"!roll","fans_medal_level":10}`,
+		`{"uid":1,"msg":"roll","fans_medal_level":10}`,
+		`{"uid":1,"msg":"!roll","fans_medal_level":9}`,
+		`{"uid":3,"msg":"!roll","fans_medal_level":20}`,
+		`{"uid":1,"msg":"!roll","fans_medal_level":20,"dm_type":1}`,
+	} {
+		if err := c.handleCmd(CmdLiveOpenPlatformDm, []byte(dm)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(commands) != 1 {
+		t.Fatalf("expect 1 command, got %+v", commands)
+	}
+	// 免费礼物不计价值，路由返回的错误向上传递
+	_ = c.handleCmd(CmdLiveOpenPlatformSendGift, []byte(`{"price":100000,"gift_num":1,"paid":false}`))
+	if err := c.handleCmd(CmdLiveOpenPlatformSendGift, []byte(`{"price":5000,"gift_num":2,"paid":true}`)); err == nil {
+		t.Fatal("expect route error")
+	}
+	_ = c.handleCmd(CmdLiveOpenPlatformSuperChat, []byte(`{"rmb":30}`))
+	if len(bigGifts) != 2 {
+		t.Fatalf("expect 2 big gifts, got %+v", bigGifts)
+	}
+
+	if !c.RemoveRoute(cmdRoute) || c.RemoveRoute(cmdRoute) {
+		t.Fatal("route should be removed once")
+	}
+	_ = c.handleCmd(CmdLiveOpenPlatformDm, []byte(`{"uid":1,"msg":"!roll","fans_medal_level":10}`))
+	if len(commands) != 1 {
+		t.Fatal("removed route should not receive events")
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	p, err := CompileFilter(`cmd=dm dm_type=text medal>=10 wearing !admin guard>=admiral msg~"^!roll \d+$" user!=uid:3`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dm := Danmaku{
+		UserInfo:   UserInfo{UID: 1},
+		FansMedal:  FansMedal{FansMedalLevel: 10, FansMedalWearingStatus: true},
+		GuardLevel: GuardLevelGovernor,
+		Message:    "!roll 6",
+	}
+	if !p(Event{Cmd: CmdLiveOpenPlatformDm, Data: dm}) {
+		t.Fatal("danmaku should match")
+	}
+	dm.GuardLevel = GuardLevelCaptain
+	if p(Event{Cmd: CmdLiveOpenPlatformDm, Data: dm}) {
+		t.Fatal("captain should not match guard>=admiral")
+	}
+	for _, text := range []string{"cmd=unknown", "medal>=x", "foo", `msg~"unterminated`, "guard>=king", "msg~("} {
+		if _, err = CompileFilter(text); err == nil {
+			t.Fatalf("expect error for %q", text)
+		}
+	}
+}
+
+func TestFilterSpecConfig(t *testing.T) {
+	var cfg struct {
+		Filters []FilterSpec `yaml:"filters" json:"filters"`
+	}
+	data := `
+filters:
+  - "cmd=gift value>=1000"
+  - cmd: [dm]
+    users: ["uid:1"]
+    any:
+      - admin: true
+      - guard_min: 舰长
+`
+	if err := yaml.Unmarshal([]byte(data), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Filters) != 2 || cfg.Filters[0].ValueMin != 1000 || len(cfg.Filters[1].Any) != 2 {
+		t.Fatalf("unexpected filters %+v", cfg.Filters)
+	}
+	p, err := cfg.Filters[1].Predicate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin := Danmaku{UserInfo: UserInfo{UID: 1}, Admin: true}
+	if !p(Event{Cmd: CmdLiveOpenPlatformDm, Data: admin}) || p(Event{Cmd: CmdLiveOpenPlatformDm, Data: Danmaku{UserInfo: UserInfo{UID: 1}}}) {
+		t.Fatal("unexpected match result")
+	}
+
+	if err = json.Unmarshal([]byte(`{"filters":["cmd=sc",{"cmd":["like"]}]}`), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Filters[0].Cmd[0] != "sc" || cfg.Filters[1].Cmd[0] != "like" {
+		t.Fatalf("unexpected filters %+v", cfg.Filters)
+	}
+}
+
+func TestEventValue(t *testing.T) {
+	for _, c := range []struct {
+		data any
+		want int64
+	}{
+		{Gift{Price: 100, GiftNum: 5, Paid: true}, 500},
+		{Gift{Price: 100, GiftNum: 5}, 0},
+		// 盲盒按购买盲盒的价格计算，而不是爆出礼物的价值
+		{Gift{Price: 1500, RPrice: 1000, GiftNum: 2, Paid: true, BlindGift: BlindGiftInfo{Status: true}}, 2000},
+		{SuperChat{RMB: 30}, 30000},
+		// 大航海的 Price 已经是本次购买的总金额
+		{Guard{GuardNum: 3, Price: 414000}, 414000},
+		{Like{}, 0},
+	} {
+		if v := EventValue(Event{Data: c.data}); v != c.want {
+			t.Fatalf("EventValue(%T) = %d, want %d", c.data, v, c.want)
+		}
+	}
+}
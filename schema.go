@@ -0,0 +1,146 @@
+package biliopen
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 严格模式下的消息结构漂移检测
+//
+// 模型中带有 schema:"optional" 标签的字段视为可选字段，消息中缺失时不会上报。
+// 可选与否不再由 json 标签的 omitempty 决定，避免为了漂移检测改变模型序列化的结果
+
+// modelSchema 模型声明的 JSON 字段
+type modelSchema struct {
+	fields map[string]modelSchemaField
+}
+
+type modelSchemaField struct {
+	optional bool
+	// nested 字段类型为结构体时的子结构，缺失和多余的字段以 a.b 的形式上报
+	nested *modelSchema
+}
+
+// modelSchemaCache reflect.Type -> *modelSchema
+var modelSchemaCache sync.Map
+
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+func schemaOf(t reflect.Type) *modelSchema {
+	if s, ok := modelSchemaCache.Load(t); ok {
+		return s.(*modelSchema)
+	}
+	s := &modelSchema{fields: map[string]modelSchemaField{}}
+	collectSchemaFields(s, t)
+	actual, _ := modelSchemaCache.LoadOrStore(t, s)
+	return actual.(*modelSchema)
+}
+
+func collectSchemaFields(s *modelSchema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		ft := sf.Type
+		for ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			// 未指定名称的嵌入结构体，字段直接展开在当前层级
+			collectSchemaFields(s, ft)
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		field := modelSchemaField{optional: hasTagOption(sf.Tag.Get("schema"), "optional")}
+		if ft.Kind() == reflect.Struct && !reflect.PointerTo(ft).Implements(jsonUnmarshalerType) {
+			field.nested = schemaOf(ft)
+		}
+		s.fields[name] = field
+	}
+}
+
+// hasTagOption 判断以逗号分隔的标签值中是否包含 option
+func hasTagOption(tag, option string) bool {
+	for tag != "" {
+		var name string
+		name, tag, _ = strings.Cut(tag, ",")
+		if name == option {
+			return true
+		}
+	}
+	return false
+}
+
+// diff 对比消息中的字段和模型声明的字段，返回模型未声明的字段和消息中缺失的必选字段，消息通过 codec 解析
+func (s *modelSchema) diff(codec Codec, data []byte, prefix string, unknown, missing *[]string) error {
+	var obj map[string]json.RawMessage
+	if err := codec.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	if obj == nil {
+		// null 值不做检查
+		return nil
+	}
+	for key, raw := range obj {
+		field, ok := s.fields[key]
+		if !ok {
+			*unknown = append(*unknown, prefix+key)
+			continue
+		}
+		if field.nested != nil && len(raw) > 0 && raw[0] == '{' {
+			if err := field.nested.diff(codec, raw, prefix+key+".", unknown, missing); err != nil {
+				return err
+			}
+		}
+	}
+	for name, field := range s.fields {
+		if _, ok := obj[name]; !ok && !field.optional {
+			*missing = append(*missing, prefix+name)
+		}
+	}
+	return nil
+}
+
+// schemaDriftState 记录每个 cmd 已经上报过的字段，同一个字段只会上报一次
+type schemaDriftState struct {
+	mu       sync.Mutex
+	reported map[string]map[string]struct{}
+}
+
+// filter 过滤掉已经上报过的字段，返回本次需要上报的新字段
+func (s *schemaDriftState) filter(cmd string, unknown, missing []string) (newUnknown, newMissing []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.reported == nil {
+		s.reported = map[string]map[string]struct{}{}
+	}
+	seen := s.reported[cmd]
+	if seen == nil {
+		seen = map[string]struct{}{}
+		s.reported[cmd] = seen
+	}
+	pick := func(fields []string, kind string) (picked []string) {
+		for _, f := range fields {
+			key := kind + f
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			picked = append(picked, f)
+		}
+		sort.Strings(picked)
+		return
+	}
+	return pick(unknown, "+"), pick(missing, "-")
+}
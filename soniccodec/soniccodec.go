@@ -0,0 +1,36 @@
+// Package soniccodec 提供基于 github.com/bytedance/sonic 的 biliopen.Codec 实现
+//
+// 作为独立的模块发布，不使用 sonic 的项目不会引入相关依赖：
+//
+//	go get github.com/fython/bili-open-live-go/soniccodec
+//
+//	client := &biliopen.LiveClient{Codec: soniccodec.Codec{}}
+package soniccodec
+
+import (
+	"github.com/bytedance/sonic"
+
+	biliopen "github.com/fython/bili-open-live-go"
+)
+
+// Codec 基于 sonic 的编解码器，API 为空时使用 sonic.ConfigStd 以保持与标准库一致的行为
+type Codec struct {
+	API sonic.API
+}
+
+var _ biliopen.Codec = Codec{}
+
+func (c Codec) api() sonic.API {
+	if c.API == nil {
+		return sonic.ConfigStd
+	}
+	return c.API
+}
+
+func (c Codec) Marshal(v any) ([]byte, error) {
+	return c.api().Marshal(v)
+}
+
+func (c Codec) Unmarshal(data []byte, v any) error {
+	return c.api().Unmarshal(data, v)
+}
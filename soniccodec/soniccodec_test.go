@@ -0,0 +1,36 @@
+package soniccodec
+
+import (
+	"reflect"
+	"testing"
+
+	biliopen "github.com/fython/bili-open-live-go"
+)
+
+func TestCodecRoundTrip(t *testing.T) {
+	raw := []byte(`{"uname":"a<b>","open_id":"o1","uid":1,"msg":"hello 世界","msg_id":"m1","is_admin":1,"guard_level":3,"fans_medal_level":5,"fans_medal_wearing_status":true,"dm_type":0}`)
+	var want biliopen.Danmaku
+	if err := (biliopen.StdCodec{}).Unmarshal(raw, &want); err != nil {
+		t.Fatal(err)
+	}
+	var got biliopen.Danmaku
+	if err := (Codec{}).Unmarshal(raw, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unmarshal mismatch:\n got %+v\nwant %+v", got, want)
+	}
+
+	data, err := Codec{}.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	std, _ := biliopen.StdCodec{}.Marshal(want)
+	if string(data) != string(std) {
+		t.Fatalf("marshal mismatch:\n got %s\nwant %s", data, std)
+	}
+	var again biliopen.Danmaku
+	if err = (Codec{}).Unmarshal(data, &again); err != nil || !reflect.DeepEqual(again, want) {
+		t.Fatalf("round trip mismatch %+v %v", again, err)
+	}
+}
@@ -0,0 +1,420 @@
+// Package subathon 礼物续时的直播倒计时
+//
+// 付费礼物、醒目留言和大航海按配置为倒计时增加时间，支持上限、暂停、手动调整，设置 Path 后状态会持久化到文件，
+// 进程重启后通过 Load 恢复，运行中的倒计时在进程退出期间继续计时：
+//
+//	t := &subathon.Timer{
+//		Path:         "subathon.json",
+//		PerYuan:      time.Second * 10,
+//		GuardTime:    map[biliopen.GuardLevel]time.Duration{biliopen.GuardLevelCaptain: time.Minute * 30},
+//		MaxRemaining: time.Hour * 12,
+//		OnChange:     func(c subathon.Change) { overlay.Push(c) },
+//	}
+//	if err := t.Load(); err != nil { ... }
+//	t.Attach(client)
+//	t.Start(time.Hour * 2)
+//	go t.Run(ctx)
+package subathon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	biliopen "github.com/fython/bili-open-live-go"
+	"github.com/fython/bili-open-live-go/internal/atomicfile"
+)
+
+const tickInterval = time.Millisecond * 200
+
+// Reason 倒计时变化原因
+type Reason string
+
+const (
+	ReasonStart     Reason = "start"
+	ReasonGift      Reason = "gift"
+	ReasonSuperChat Reason = "superchat"
+	ReasonGuard     Reason = "guard"
+	ReasonAdjust    Reason = "adjust"
+	ReasonPause     Reason = "pause"
+	ReasonResume    Reason = "resume"
+	ReasonExpired   Reason = "expired"
+)
+
+// State 倒计时状态
+type State string
+
+const (
+	StateIdle    State = "idle"
+	StateRunning State = "running"
+	StatePaused  State = "paused"
+	StateEnded   State = "ended"
+)
+
+// Change 倒计时变化事件
+type Change struct {
+	Reason Reason `json:"reason"`
+	// User 触发变化的用户，Start、Adjust、Pause 等主播操作时为空
+	User biliopen.UserInfo `json:"user"`
+	// Requested 按配置计算的增加时间
+	Requested time.Duration `json:"requested"`
+	// Delta 实际增加的时间，受上限影响可能小于 Requested
+	Delta time.Duration `json:"delta"`
+	// Capped 是否受到上限限制
+	Capped bool `json:"capped"`
+	// Note 备注，例如礼物名称
+	Note string `json:"note,omitempty"`
+	// Remaining 变化后的剩余时间
+	Remaining time.Duration `json:"remaining"`
+	// EndsAt 变化后的结束时间，暂停时为零值
+	EndsAt time.Time `json:"ends_at"`
+	State  State     `json:"state"`
+}
+
+// Timer 倒计时，零值可以直接使用但不会因为礼物增加时间，并发安全
+type Timer struct {
+	// PerYuan 付费礼物和醒目留言每 1 元增加的时间，单次增加的时间最多为 1 年
+	PerYuan time.Duration
+	// GuardTime 开通大航海每月增加的时间，按周、天购买时按时长折算，没有配置的等级按 PerYuan 和支付金额计算
+	GuardTime map[biliopen.GuardLevel]time.Duration
+	// MaxRemaining 剩余时间上限，为 0 时不限制
+	MaxRemaining time.Duration
+	// MaxTotal 总时长上限，即开始时长与所有增加时间之和，为 0 时不限制
+	MaxTotal time.Duration
+	// Path 持久化文件路径，为空时不持久化
+	Path string
+	// OnChange 倒计时变化时回调，在锁外调用
+	OnChange func(c Change)
+	// OnSaveError 持久化失败时回调，在持有锁时调用，不能再调用 Timer 的方法，为空时输出警告日志，内存中的状态不会回滚
+	OnSaveError func(err error)
+
+	mu sync.Mutex
+	st timerState
+	// dedup 过滤重连后重复推送的消息
+	dedup biliopen.Deduplicator
+
+	// now 测试时替换当前时间
+	now func() time.Time
+}
+
+// timerState 持久化的倒计时状态，运行时以 EndsAt 为准，暂停时以 Remaining 为准
+type timerState struct {
+	State     State         `json:"state"`
+	EndsAt    time.Time     `json:"ends_at"`
+	Remaining time.Duration `json:"remaining"`
+	Total     time.Duration `json:"total"`
+}
+
+func (t *Timer) getNow() time.Time {
+	if t.now != nil {
+		return t.now()
+	}
+	return time.Now()
+}
+
+// Load 从 Path 恢复倒计时，文件不存在时不做任何操作
+func (t *Timer) Load() error {
+	if t.Path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(t.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("read subathon fail: %w", err)
+	}
+	var st timerState
+	if err = json.Unmarshal(data, &st); err != nil {
+		return fmt.Errorf("unmarshal subathon fail: %w", err)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.st = st
+	return nil
+}
+
+// save 写入临时文件后重命名，失败时通过 OnSaveError 上报并返回错误，调用方需要持有锁
+func (t *Timer) save() error {
+	if t.Path == "" {
+		return nil
+	}
+	data, err := json.Marshal(t.st)
+	if err == nil {
+		err = atomicfile.WriteFile(t.Path, data)
+	}
+	if err != nil {
+		err = fmt.Errorf("save subathon fail: %w", err)
+		if t.OnSaveError != nil {
+			t.OnSaveError(err)
+		} else {
+			zap.L().Warn("save subathon fail", zap.String("path", t.Path), zap.Error(err))
+		}
+	}
+	return err
+}
+
+// remaining 当前剩余时间，运行中到时后转为结束状态，调用方需要持有锁
+func (t *Timer) remaining(now time.Time) time.Duration {
+	switch t.st.State {
+	case StateRunning:
+		if remaining := t.st.EndsAt.Sub(now); remaining > 0 {
+			return remaining
+		}
+		return 0
+	case StatePaused:
+		return t.st.Remaining
+	default:
+		return 0
+	}
+}
+
+// change 生成变化事件并持久化，调用方需要持有锁
+func (t *Timer) change(c Change, now time.Time) Change {
+	c.Remaining = t.remaining(now)
+	c.State = t.st.State
+	if t.st.State == StateRunning {
+		c.EndsAt = t.st.EndsAt
+	}
+	t.save()
+	return c
+}
+
+func (t *Timer) emit(c Change) {
+	if t.OnChange != nil {
+		t.OnChange(c)
+	}
+}
+
+// Start 以 d 为初始时长开始倒计时，会覆盖之前的状态
+func (t *Timer) Start(d time.Duration) {
+	now := t.getNow()
+	t.mu.Lock()
+	t.st = timerState{State: StateRunning, EndsAt: now.Add(d), Total: d}
+	c := t.change(Change{Reason: ReasonStart, Requested: d, Delta: d}, now)
+	t.mu.Unlock()
+	t.emit(c)
+}
+
+// Pause 暂停倒计时，没有运行时返回 false
+func (t *Timer) Pause() bool {
+	now := t.getNow()
+	t.mu.Lock()
+	if t.st.State != StateRunning || t.remaining(now) <= 0 {
+		t.mu.Unlock()
+		return false
+	}
+	t.st.Remaining = t.remaining(now)
+	t.st.State = StatePaused
+	t.st.EndsAt = time.Time{}
+	c := t.change(Change{Reason: ReasonPause}, now)
+	t.mu.Unlock()
+	t.emit(c)
+	return true
+}
+
+// Resume 恢复倒计时，没有暂停时返回 false
+func (t *Timer) Resume() bool {
+	now := t.getNow()
+	t.mu.Lock()
+	if t.st.State != StatePaused {
+		t.mu.Unlock()
+		return false
+	}
+	t.st.State = StateRunning
+	t.st.EndsAt = now.Add(t.st.Remaining)
+	t.st.Remaining = 0
+	c := t.change(Change{Reason: ReasonResume}, now)
+	t.mu.Unlock()
+	t.emit(c)
+	return true
+}
+
+// Adjust 手动调整剩余时间，d 可以为负数，剩余时间不会小于 0，手动调整不受上限限制，没有运行或暂停时返回 false
+func (t *Timer) Adjust(d time.Duration, note string) bool {
+	c, ok := t.add(ReasonAdjust, biliopen.UserInfo{}, d, note, false, "", "")
+	if ok {
+		t.emit(c)
+	}
+	return ok
+}
+
+// add 增加时间，limit 为 true 时受上限限制，cmd 和 msgID 用于过滤重复推送的消息
+func (t *Timer) add(reason Reason, user biliopen.UserInfo, d time.Duration, note string, limit bool, cmd, msgID string) (Change, bool) {
+	now := t.getNow()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	remaining := t.remaining(now)
+	if (t.st.State != StateRunning && t.st.State != StatePaused) || (t.st.State == StateRunning && remaining <= 0) {
+		return Change{}, false
+	}
+	if t.dedup.Seen(msgID) {
+		return Change{}, false
+	}
+	delta := d
+	if limit {
+		if t.MaxRemaining > 0 && addDuration(remaining, delta) > t.MaxRemaining {
+			delta = t.MaxRemaining - remaining
+		}
+		if t.MaxTotal > 0 && addDuration(t.st.Total, delta) > t.MaxTotal {
+			delta = t.MaxTotal - t.st.Total
+		}
+		if delta < 0 {
+			delta = 0
+		}
+	}
+	if addDuration(remaining, delta) < 0 {
+		delta = -remaining
+	}
+	t.st.Total = addDuration(t.st.Total, delta)
+	if t.st.State == StateRunning {
+		t.st.EndsAt = t.st.EndsAt.Add(delta)
+	} else {
+		t.st.Remaining = addDuration(t.st.Remaining, delta)
+	}
+	t.dedup.Duplicate(cmd, msgID)
+	return t.change(Change{
+		Reason: reason, User: user, Requested: d, Delta: delta, Capped: delta < d, Note: note,
+	}, now), true
+}
+
+// Remaining 当前剩余时间
+func (t *Timer) Remaining() time.Duration {
+	now := t.getNow()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.remaining(now)
+}
+
+// State 当前状态，运行中剩余时间为 0 但还没有被 Run 检测到时也返回 StateEnded
+func (t *Timer) State() State {
+	now := t.getNow()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.st.State == "" {
+		return StateIdle
+	}
+	if t.st.State == StateRunning && t.remaining(now) <= 0 {
+		return StateEnded
+	}
+	return t.st.State
+}
+
+// Run 检测倒计时结束，结束时回调 ReasonExpired 事件，阻塞直到 ctx 取消
+func (t *Timer) Run(ctx context.Context) error {
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			t.checkExpired()
+		}
+	}
+}
+
+func (t *Timer) checkExpired() {
+	now := t.getNow()
+	t.mu.Lock()
+	if t.st.State != StateRunning || t.remaining(now) > 0 {
+		t.mu.Unlock()
+		return
+	}
+	t.st.State = StateEnded
+	c := t.change(Change{Reason: ReasonExpired}, now)
+	t.mu.Unlock()
+	t.emit(c)
+}
+
+// Attach 注册礼物、醒目留言和大航海路由，返回的 RouteID 可以用于 RemoveRoute
+func (t *Timer) Attach(c *biliopen.LiveClient) biliopen.RouteID {
+	return c.Route(biliopen.IsCmd(
+		biliopen.CmdLiveOpenPlatformSendGift,
+		biliopen.CmdLiveOpenPlatformSuperChat,
+		biliopen.CmdLiveOpenPlatformGuard,
+	), t.Handle)
+}
+
+// Handle 处理礼物、醒目留言和大航海事件，可以作为 biliopen.Handler 使用，重复推送的消息按 msg_id 只计一次
+func (t *Timer) Handle(e biliopen.Event) error {
+	var (
+		reason Reason
+		msgID  string
+		note   string
+		d      time.Duration
+	)
+	value := biliopen.EventValue(e)
+	switch data := e.Data.(type) {
+	case biliopen.Gift:
+		reason, msgID, note = ReasonGift, data.MessageID, data.GiftName
+		d = t.valueTime(value)
+	case biliopen.SuperChat:
+		reason, msgID = ReasonSuperChat, data.MessageID
+		d = t.valueTime(value)
+	case biliopen.Guard:
+		reason, msgID, note = ReasonGuard, data.MessageID, data.GuardLevel.String()
+		if per, ok := t.GuardTime[data.GuardLevel]; ok {
+			bought, err := data.Duration()
+			if err != nil {
+				return fmt.Errorf("guard time fail: %w", err)
+			}
+			// 按购买时长折算月数，按周、天购买时不足一个月的部分按比例计算
+			d = scaleDuration(per, int64(bought/biliopen.GuardDay), uint64(biliopen.GuardMonth/biliopen.GuardDay))
+		} else {
+			d = t.valueTime(value)
+		}
+	default:
+		return nil
+	}
+	if d <= 0 {
+		return nil
+	}
+	user, _ := biliopen.EventUser(e)
+	if c, ok := t.add(reason, user, d, note, true, e.Cmd, msgID); ok {
+		t.emit(c)
+	}
+	return nil
+}
+
+// maxStep 单次增加时间的上限，配置或金额异常时换算结果不会溢出
+const maxStep = time.Hour * 24 * 365
+
+// valueTime 付费价值对应的时间，1000 = 1 元
+func (t *Timer) valueTime(value int64) time.Duration {
+	return scaleDuration(t.PerYuan, value, 1000)
+}
+
+// scaleDuration 计算 d * n / div，使用 128 位中间结果避免溢出，结果不超过 maxStep，d 或 n 不为正数时返回 0
+func scaleDuration(d time.Duration, n int64, div uint64) time.Duration {
+	if d <= 0 || n <= 0 {
+		return 0
+	}
+	hi, lo := bits.Mul64(uint64(d), uint64(n))
+	if hi >= div {
+		return maxStep
+	}
+	if q, _ := bits.Div64(hi, lo, div); q < uint64(maxStep) {
+		return time.Duration(q)
+	}
+	return maxStep
+}
+
+// addDuration 饱和加法，结果溢出时返回 time.Duration 的最大或最小值
+func addDuration(a, b time.Duration) time.Duration {
+	sum := a + b
+	if b > 0 && sum < a {
+		return math.MaxInt64
+	}
+	if b < 0 && sum > a {
+		return math.MinInt64
+	}
+	return sum
+}
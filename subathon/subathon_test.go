@@ -0,0 +1,141 @@
+package subathon
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	biliopen "github.com/fython/bili-open-live-go"
+)
+
+func TestTimer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "subathon.json")
+	now := time.Unix(1700000000, 0)
+	var changes []Change
+	tm := &Timer{
+		Path:         path,
+		PerYuan:      time.Second * 10,
+		GuardTime:    map[biliopen.GuardLevel]time.Duration{biliopen.GuardLevelCaptain: time.Minute * 30},
+		MaxRemaining: time.Hour * 2,
+		OnChange:     func(c Change) { changes = append(changes, c) },
+		now:          func() time.Time { return now },
+	}
+	gift := biliopen.Event{Cmd: biliopen.CmdLiveOpenPlatformSendGift, Data: biliopen.Gift{
+		UserInfo: biliopen.UserInfo{UID: 1}, MessageID: "g1", GiftName: "小花花", Price: 1000, GiftNum: 6, Paid: true,
+	}}
+	_ = tm.Handle(gift)
+	if len(changes) != 0 || tm.State() != StateIdle {
+		t.Fatal("gift before start should be ignored")
+	}
+
+	tm.Start(time.Hour)
+	now = now.Add(time.Minute * 10)
+	_ = tm.Handle(gift)
+	_ = tm.Handle(gift) // 重复推送
+	if tm.Remaining() != time.Minute*51 {
+		t.Fatalf("unexpected remaining %s", tm.Remaining())
+	}
+	last := changes[len(changes)-1]
+	if len(changes) != 2 || last.Reason != ReasonGift || last.User.UID != 1 || last.Delta != time.Minute || last.Note != "小花花" {
+		t.Fatalf("unexpected change %+v", last)
+	}
+
+	_ = tm.Handle(biliopen.Event{Cmd: biliopen.CmdLiveOpenPlatformGuard, Data: biliopen.Guard{
+		UserInfo: biliopen.UserInfo{UID: 2}, MessageID: "g2", GuardLevel: biliopen.GuardLevelCaptain, GuardNum: 3, GuardUnit: "月",
+	}})
+	last = changes[len(changes)-1]
+	if !last.Capped || last.Requested != time.Minute*90 || last.Delta != time.Minute*69 || tm.Remaining() != time.Hour*2 {
+		t.Fatalf("expect capped change, got %+v", last)
+	}
+
+	// 暂停期间不计时，可以手动调整
+	if !tm.Pause() || tm.Pause() {
+		t.Fatal("pause should succeed once")
+	}
+	now = now.Add(time.Hour)
+	tm.Adjust(-time.Minute*20, "惩罚")
+	_ = tm.Handle(biliopen.Event{Cmd: biliopen.CmdLiveOpenPlatformSuperChat, Data: biliopen.SuperChat{MessageID: "s1", RMB: 30}})
+	if tm.Remaining() != time.Minute*105 || tm.State() != StatePaused {
+		t.Fatalf("unexpected remaining %s", tm.Remaining())
+	}
+
+	// 重启后恢复
+	tm2 := &Timer{Path: path, now: func() time.Time { return now }}
+	if err := tm2.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if tm2.Remaining() != time.Minute*105 || !tm2.Resume() {
+		t.Fatal("unexpected restored timer")
+	}
+	now = now.Add(time.Minute * 100)
+	tm2.Adjust(-time.Hour, "")
+	if tm2.Remaining() != 0 || tm2.State() != StateEnded {
+		t.Fatalf("timer should end, remaining %s", tm2.Remaining())
+	}
+
+	ended := make(chan Change, 1)
+	tm2.OnChange = func(c Change) { ended <- c }
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = tm2.Run(ctx) }()
+	select {
+	case c := <-ended:
+		if c.Reason != ReasonExpired || c.State != StateEnded {
+			t.Fatalf("unexpected change %+v", c)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expect expired change")
+	}
+	if tm2.Adjust(time.Minute, "") {
+		t.Fatal("ended timer should not be adjusted")
+	}
+}
+
+func TestGuardUnit(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tm := &Timer{
+		GuardTime: map[biliopen.GuardLevel]time.Duration{biliopen.GuardLevelCaptain: time.Hour * 30},
+		now:       func() time.Time { return now },
+	}
+	tm.Start(time.Hour)
+	guard := func(id string, num int, unit string) biliopen.Event {
+		return biliopen.Event{Cmd: biliopen.CmdLiveOpenPlatformGuard, Data: biliopen.Guard{
+			MessageID: id, GuardLevel: biliopen.GuardLevelCaptain, GuardNum: num, GuardUnit: unit,
+		}}
+	}
+	// "*3天" 忽略 guard_num，按 3 天折算为每月时间的 1/10
+	if err := tm.Handle(guard("g1", 5, "*3天")); err != nil || tm.Remaining() != time.Hour*4 {
+		t.Fatalf("unexpected remaining %s %v", tm.Remaining(), err)
+	}
+	if err := tm.Handle(guard("g2", 1, "周")); err != nil || tm.Remaining() != time.Hour*11 {
+		t.Fatalf("unexpected remaining %s %v", tm.Remaining(), err)
+	}
+	if err := tm.Handle(guard("g3", 1, "年")); err == nil || tm.Remaining() != time.Hour*11 {
+		t.Fatalf("expect unknown unit error, got %v", err)
+	}
+}
+
+func TestValueTimeOverflow(t *testing.T) {
+	tm := &Timer{PerYuan: time.Hour}
+	if d := tm.valueTime(10 * 1000); d != time.Hour*10 {
+		t.Fatalf("unexpected time %v", d)
+	}
+	// 金额或配置异常大时不会溢出为负数，而是限制在 maxStep
+	if d := tm.valueTime(math.MaxInt64); d != maxStep {
+		t.Fatalf("expect capped time, got %v", d)
+	}
+	if d := scaleDuration(time.Duration(math.MaxInt64), 3, 1); d != maxStep {
+		t.Fatalf("expect capped time, got %v", d)
+	}
+	if d := scaleDuration(time.Hour, -1, 1); d != 0 {
+		t.Fatalf("expect 0 for negative value, got %v", d)
+	}
+	tm.Start(time.Hour)
+	tm.Adjust(time.Duration(math.MaxInt64), "")
+	tm.Adjust(time.Duration(math.MaxInt64), "")
+	if r := tm.Remaining(); r <= 0 {
+		t.Fatalf("remaining should saturate, got %v", r)
+	}
+}
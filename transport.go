@@ -0,0 +1,138 @@
+package biliopen
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+
+	"nhooyr.io/websocket"
+)
+
+const (
+	// defaultRequestTimeout API 请求默认超时
+	defaultRequestTimeout = time.Second * 60
+	// defaultUserAgent WebSocket 握手请求默认的 User-Agent
+	defaultUserAgent = "bili-open-live-go/1.0"
+)
+
+// transportKey 创建底层 Transport 时使用的配置，变化后重新创建
+type transportKey struct {
+	tlsConfig        *tls.Config
+	proxyURL         string
+	dialTimeout      time.Duration
+	handshakeTimeout time.Duration
+}
+
+// getBaseTransport 获取 API 请求和 WebSocket 握手共用的底层 RoundTripper
+//
+// 优先使用 LiveClient.Transport，否则基于 http.DefaultTransport 按 TLSConfig、ProxyURL 和 DialTimeout 创建，
+// 创建后缓存在客户端中，重连时可以复用连接池，这些配置变化后会重新创建并关闭旧连接池中的空闲连接
+func (c *LiveClient) getBaseTransport() http.RoundTripper {
+	if c.Transport != nil {
+		return c.Transport
+	}
+	key := transportKey{
+		tlsConfig:        c.TLSConfig,
+		dialTimeout:      c.DialTimeout,
+		handshakeTimeout: c.HandshakeTimeout,
+	}
+	if c.ProxyURL != nil {
+		key.proxyURL = c.ProxyURL.String()
+	}
+	c.transportMu.Lock()
+	defer c.transportMu.Unlock()
+	if c.transport != nil {
+		if c.transportKey == key {
+			return c.transport
+		}
+		c.transport.CloseIdleConnections()
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if c.TLSConfig != nil {
+		t.TLSClientConfig = c.TLSConfig.Clone()
+	}
+	if c.ProxyURL != nil {
+		// net/http 原生支持 http、https 和 socks5 代理
+		t.Proxy = http.ProxyURL(c.ProxyURL)
+	}
+	if c.DialTimeout > 0 {
+		dialer := &net.Dialer{Timeout: c.DialTimeout, KeepAlive: 30 * time.Second}
+		t.DialContext = dialer.DialContext
+	}
+	if c.HandshakeTimeout > 0 {
+		t.TLSHandshakeTimeout = c.HandshakeTimeout
+	}
+	c.transport = t
+	c.transportKey = key
+	return t
+}
+
+// baseTransport 每次请求时重新获取底层 RoundTripper，已经创建的 API 请求客户端也能使用修改后的配置
+type baseTransport struct {
+	c *LiveClient
+}
+
+func (t baseTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.c.getBaseTransport().RoundTrip(req)
+}
+
+func (c *LiveClient) getRateLimiter() *RateLimiter {
+	if c.RateLimiter != nil {
+		return c.RateLimiter
+	}
+	return SharedRateLimiter(c.AppKey)
+}
+
+// newApiClient 创建带自动签名的 API 请求客户端
+func (c *LiveClient) newApiClient() *http.Client {
+	timeout := c.RequestTimeout
+	if timeout <= 0 {
+		timeout = defaultRequestTimeout
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: ApiTransport{
+			AppKey:    c.AppKey,
+			AppSecret: c.AppSecret,
+			Transport: baseTransport{c},
+			Clock:     c.Clock,
+			Offset:    &c.clockOffset,
+			Limiter:   c.getRateLimiter(),
+		},
+	}
+}
+
+// newWsDialer 创建 WebSocket 连接使用的拨号参数
+func (c *LiveClient) newWsDialer() wsDialer {
+	header := http.Header{"User-Agent": []string{defaultUserAgent}}
+	for k, v := range c.Header {
+		header[k] = append([]string(nil), v...)
+	}
+	return wsDialer{
+		options: websocket.DialOptions{
+			HTTPClient: &http.Client{Transport: c.getBaseTransport()},
+			HTTPHeader: header,
+		},
+		handshakeTimeout: c.HandshakeTimeout,
+	}
+}
+
+// wsDialer WebSocket 拨号参数
+type wsDialer struct {
+	options          websocket.DialOptions
+	handshakeTimeout time.Duration
+}
+
+// dial 建立 WebSocket 连接，handshakeTimeout 覆盖从拨号到握手完成的整个过程
+func (d wsDialer) dial(ctx context.Context, url string) (*websocket.Conn, error) {
+	if d.handshakeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.handshakeTimeout)
+		defer cancel()
+	}
+	opts := d.options
+	conn, _, err := websocket.Dial(ctx, url, &opts)
+	return conn, err
+}
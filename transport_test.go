@@ -0,0 +1,388 @@
+package biliopen_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	biliopen "github.com/fython/bili-open-live-go"
+	"nhooyr.io/websocket"
+)
+
+// newTestLiveServer 启动一个自签名证书的本地服务，模拟开放平台 API 和长连服务
+//
+// maxConns 大于 0 时，服务端推送弹幕后会主动断开长连，并且只接受前 maxConns 次连接，用于测试断线重连
+func newTestLiveServer(t *testing.T, dmBody string, maxConns int32) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	var conns atomic.Int32
+	var srv *httptest.Server
+	mux.HandleFunc("/v2/app/start", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Test") != "yes" {
+			t.Errorf("missing extra header on api request")
+		}
+		if r.Header.Get("Authorization") == "" {
+			t.Errorf("missing signature on api request")
+		}
+		wss := "wss" + strings.TrimPrefix(srv.URL, "https") + "/sub"
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"code": 0,
+			"data": map[string]any{
+				"game_info":      map[string]any{"game_id": "game"},
+				"websocket_info": map[string]any{"auth_body": "{}", "wss_link": []string{wss}},
+			},
+		})
+	})
+	mux.HandleFunc("/v2/app/heartbeat", func(w http.ResponseWriter, r *http.Request) {
+		// 项目心跳默认不发送，X-Test-Heartbeat 为 block 时模拟一直没有响应的心跳请求
+		if r.Header.Get("X-Test-Heartbeat") != "block" {
+			t.Errorf("unexpected app heartbeat")
+			return
+		}
+		// 读完请求体后服务端才能感知客户端取消请求
+		_, _ = io.Copy(io.Discard, r.Body)
+		<-r.Context().Done()
+	})
+	mux.HandleFunc("/v2/app/end", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"code":0}`))
+	})
+	mux.HandleFunc("/sub", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Test") != "yes" {
+			t.Errorf("missing extra header on websocket handshake")
+		}
+		if n := conns.Add(1); maxConns > 0 && n > maxConns {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		conn, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			t.Errorf("accept fail: %v", err)
+			return
+		}
+		defer conn.Close(websocket.StatusNormalClosure, "")
+		ctx := r.Context()
+		if _, _, err = conn.Read(ctx); err != nil {
+			return
+		}
+		_ = conn.Write(ctx, websocket.MessageBinary, testFrame(8, `{"code":0}`))
+		_ = conn.Write(ctx, websocket.MessageBinary, testFrame(5, dmBody))
+		if maxConns > 0 {
+			_ = conn.Close(websocket.StatusGoingAway, "kick")
+			return
+		}
+		_, _, _ = conn.Read(ctx)
+	})
+	srv = httptest.NewTLSServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func testFrame(op uint32, body string) []byte {
+	b := binary.BigEndian.AppendUint32(nil, uint32(16+len(body)))
+	b = binary.BigEndian.AppendUint16(b, 16)
+	b = binary.BigEndian.AppendUint16(b, 0)
+	b = binary.BigEndian.AppendUint32(b, op)
+	b = binary.BigEndian.AppendUint32(b, 0)
+	return append(b, body...)
+}
+
+func TestClientSelfSignedServer(t *testing.T) {
+	srv := newTestLiveServer(t, `{"cmd":"LIVE_OPEN_PLATFORM_DM","data":{"msg":"hello"}}`, 0)
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+
+	var record bytes.Buffer
+	dmCh := make(chan biliopen.Danmaku, 1)
+	client := &biliopen.LiveClient{
+		Recorder:         biliopen.NewRecorder(&record),
+		ApiHost:          srv.URL,
+		AppKey:           "key",
+		AppSecret:        "secret",
+		ProjectID:        1,
+		TLSConfig:        &tls.Config{RootCAs: pool},
+		Header:           http.Header{"X-Test": []string{"yes"}},
+		DialTimeout:      time.Second * 5,
+		HandshakeTimeout: time.Second * 5,
+		OnDanmaku: func(dm biliopen.Danmaku) {
+			dmCh <- dm
+		},
+	}
+	ctx := context.Background()
+	if err := client.Connect(ctx, "code"); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Disconnect(ctx)
+
+	select {
+	case dm := <-dmCh:
+		if dm.Message != "hello" {
+			t.Fatalf("unexpected danmaku %+v", dm)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("timeout waiting for danmaku")
+	}
+
+	// 回放录制的原始帧，应当得到同样的弹幕
+	replayed := 0
+	replayer := &biliopen.Replayer{Client: &biliopen.LiveClient{OnDanmaku: func(dm biliopen.Danmaku) {
+		if dm.Message == "hello" {
+			replayed++
+		}
+	}}}
+	if err := replayer.Replay(ctx, bytes.NewReader(record.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if replayed != 1 {
+		t.Fatalf("expect 1 replayed danmaku, got %d", replayed)
+	}
+}
+
+func TestClientReconnect(t *testing.T) {
+	srv := newTestLiveServer(t, `{"cmd":"LIVE_OPEN_PLATFORM_DM","data":{"msg":"hello"}}`, 2)
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+
+	dmCh := make(chan biliopen.Danmaku, 2)
+	closeCh := make(chan error, 1)
+	client := &biliopen.LiveClient{
+		ApiHost:   srv.URL,
+		AppKey:    "key",
+		AppSecret: "secret",
+		ProjectID: 1,
+		TLSConfig: &tls.Config{RootCAs: pool},
+		Header:    http.Header{"X-Test": []string{"yes"}},
+		Reconnect: biliopen.ReconnectPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond * 10},
+		OnDanmaku: func(dm biliopen.Danmaku) {
+			dmCh <- dm
+		},
+		OnClose: func(err error) {
+			closeCh <- err
+		},
+	}
+	if err := client.Connect(context.Background(), "code"); err != nil {
+		t.Fatal(err)
+	}
+	// 首次连接和第一次重连各收到一条弹幕，之后的重连全部失败
+	for i := 0; i < 2; i++ {
+		select {
+		case <-dmCh:
+		case <-time.After(time.Second * 5):
+			t.Fatalf("timeout waiting for danmaku #%d", i+1)
+		}
+	}
+	select {
+	case err := <-closeCh:
+		if err == nil {
+			t.Fatal("expect close error after reconnect attempts exhausted")
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("timeout waiting for close")
+	}
+	if client.IsActive() {
+		t.Fatal("client should be inactive after close")
+	}
+}
+
+func TestCallApi(t *testing.T) {
+	srv := newTestLiveServer(t, "", 0)
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	client := &biliopen.LiveClient{
+		ApiHost:   srv.URL,
+		AppKey:    "key",
+		AppSecret: "secret",
+		TLSConfig: &tls.Config{RootCAs: pool},
+		Header:    http.Header{"X-Test": []string{"yes"}},
+	}
+	var rsp biliopen.CommonResponse[json.RawMessage]
+	if err := client.CallApi(context.Background(), "/v2/app/start", json.RawMessage(`{"code":"x"}`), &rsp); err != nil {
+		t.Fatal(err)
+	}
+	if rsp.Err() != nil || !strings.Contains(string(rsp.Data), "game_id") {
+		t.Fatalf("unexpected response %v", rsp)
+	}
+}
+
+func TestCallApiRawBody(t *testing.T) {
+	var body []byte
+	var contentMD5 string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		contentMD5 = r.Header.Get(biliopen.HeaderBiliContentMD5)
+		_, _ = w.Write([]byte(`{"code":0}`))
+	}))
+	defer srv.Close()
+	client := &biliopen.LiveClient{ApiHost: srv.URL, AppKey: "key", AppSecret: "secret"}
+	// []byte 请求体原样发送，不会被压缩空白或转义 HTML 字符
+	raw := []byte(`{ "msg": "<a&b>" }`)
+	var rsp biliopen.CommonResponse[json.RawMessage]
+	if err := client.CallApi(context.Background(), "/raw", raw, &rsp); err != nil {
+		t.Fatal(err)
+	}
+	header := http.Header{}
+	biliopen.SignHeader(header, "key", "secret", 0, "", raw)
+	if !bytes.Equal(body, raw) || contentMD5 != header.Get(biliopen.HeaderBiliContentMD5) {
+		t.Fatalf("unexpected body %s md5 %s", body, contentMD5)
+	}
+}
+
+func TestClientProxy(t *testing.T) {
+	newProxy := func(hits *atomic.Int32) *url.URL {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// 通过代理的请求使用绝对地址
+			if r.URL.Host != "open.test" || r.Header.Get("Authorization") == "" {
+				t.Errorf("unexpected proxied request %s %v", r.URL, r.Header)
+			}
+			hits.Add(1)
+			_, _ = w.Write([]byte(`{"code":0,"data":{}}`))
+		}))
+		t.Cleanup(srv.Close)
+		u, _ := url.Parse(srv.URL)
+		return u
+	}
+	var first, second atomic.Int32
+	client := &biliopen.LiveClient{
+		ApiHost:   "http://open.test",
+		AppKey:    "key",
+		AppSecret: "secret",
+		ProxyURL:  newProxy(&first),
+	}
+	call := func() {
+		t.Helper()
+		var rsp biliopen.CommonResponse[json.RawMessage]
+		if err := client.CallApi(context.Background(), "/v2/app/heartbeat", map[string]any{}, &rsp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	call()
+	// 修改代理后从下一次请求开始生效
+	client.ProxyURL = newProxy(&second)
+	call()
+	if first.Load() != 1 || second.Load() != 1 {
+		t.Fatalf("unexpected proxy hits %d %d", first.Load(), second.Load())
+	}
+}
+
+func TestClientAppHeartbeat(t *testing.T) {
+	srv := newTestLiveServer(t, `{"cmd":"LIVE_OPEN_PLATFORM_DM","data":{"msg":"hello"}}`, 0)
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	client := &biliopen.LiveClient{
+		ApiHost:              srv.URL,
+		AppKey:               "key",
+		AppSecret:            "secret",
+		ProjectID:            1,
+		TLSConfig:            &tls.Config{RootCAs: pool},
+		Header:               http.Header{"X-Test": []string{"yes"}, "X-Test-Heartbeat": []string{"block"}},
+		AppHeartbeatInterval: time.Millisecond * 10,
+	}
+	ctx := context.Background()
+	if err := client.Connect(ctx, "code"); err != nil {
+		t.Fatal(err)
+	}
+	// 心跳请求没有响应时 Disconnect 不应该被阻塞
+	time.Sleep(time.Millisecond * 100)
+	start := time.Now()
+	if err := client.Disconnect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("disconnect blocked by app heartbeat for %v", d)
+	}
+}
+
+func TestClientReconnectAfterConnReset(t *testing.T) {
+	var (
+		subs   atomic.Int32
+		raw    atomic.Pointer[net.Conn]
+		srv    *httptest.Server
+		dmBody = `{"cmd":"LIVE_OPEN_PLATFORM_DM","data":{"msg":"hello"}}`
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v2/app/start", func(w http.ResponseWriter, r *http.Request) {
+		wss := "wss" + strings.TrimPrefix(srv.URL, "https") + "/sub"
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"code": 0,
+			"data": map[string]any{
+				"game_info":      map[string]any{"game_id": "game"},
+				"websocket_info": map[string]any{"auth_body": "{}", "wss_link": []string{wss}},
+			},
+		})
+	})
+	mux.HandleFunc("/v2/app/end", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"code":0}`))
+	})
+	mux.HandleFunc("/sub", func(w http.ResponseWriter, r *http.Request) {
+		n := subs.Add(1)
+		conn, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			t.Errorf("accept fail: %v", err)
+			return
+		}
+		defer conn.Close(websocket.StatusNormalClosure, "")
+		ctx := r.Context()
+		if _, _, err = conn.Read(ctx); err != nil {
+			return
+		}
+		_ = conn.Write(ctx, websocket.MessageBinary, testFrame(8, `{"code":0}`))
+		_ = conn.Write(ctx, websocket.MessageBinary, testFrame(5, dmBody))
+		if n == 1 {
+			// 不发送关闭帧，直接断开底层 TCP 连接，模拟连接被重置
+			if c := raw.Load(); c != nil {
+				_ = (*c).(*tls.Conn).NetConn().Close()
+			}
+			return
+		}
+		_, _, _ = conn.Read(ctx)
+	})
+	srv = httptest.NewUnstartedServer(mux)
+	srv.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateHijacked {
+			raw.CompareAndSwap(nil, &c)
+		}
+	}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+
+	dmCh := make(chan biliopen.Danmaku, 2)
+	client := &biliopen.LiveClient{
+		ApiHost:   srv.URL,
+		AppKey:    "key",
+		AppSecret: "secret",
+		ProjectID: 1,
+		TLSConfig: &tls.Config{RootCAs: pool},
+		Reconnect: biliopen.ReconnectPolicy{MaxAttempts: 1, InitialBackoff: time.Millisecond * 10},
+		OnDanmaku: func(dm biliopen.Danmaku) {
+			dmCh <- dm
+		},
+	}
+	if err := client.Connect(context.Background(), "code"); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Disconnect(context.Background()) }()
+	// 连接被重置后应当重连，并在新连接上继续收到弹幕
+	for i := 0; i < 2; i++ {
+		select {
+		case <-dmCh:
+		case <-time.After(time.Second * 5):
+			t.Fatalf("timeout waiting for danmaku #%d", i+1)
+		}
+	}
+	if n := subs.Load(); n != 2 {
+		t.Fatalf("expect 2 websocket connections, got %d", n)
+	}
+}
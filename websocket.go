@@ -1,9 +1,12 @@
 package biliopen
 
 import (
+	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"sync"
 )
 
 // WebSocket 协议文档见 https://open-live.bilibili.com/document/657d8e34-f926-a133-16c0-300c1afc6e6b
@@ -47,50 +50,95 @@ type wsProtoMsg struct {
 	Operation  wsProtoOp
 	SequenceID int32
 	Body       []byte
+
+	// buf 持有 Body 所引用的底层读缓冲，由 releaseWsProtoMsg 归还到 wsBufPool
+	buf *bytes.Buffer
 }
 
-// writeWsProtoMsg 将 wsProtoMsg 序列化数据写入 io.Writer 中
-func writeWsProtoMsg(w io.Writer, p *wsProtoMsg) error {
-	packSize := int32(wsProtoRawHeaderSize + len(p.Body))
-	data := []any{
-		packSize,
-		int16(wsProtoRawHeaderSize),
-		p.Version,
-		int32(p.Operation),
-		p.SequenceID,
-		p.Body,
+// wsBufPool 读写 WebSocket 帧使用的缓冲池，避免每个包都重新分配
+var wsBufPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// wsProtoMsgPool 接收消息对象池，消息在 eventLoop 处理完毕后归还
+var wsProtoMsgPool = sync.Pool{
+	New: func() any { return new(wsProtoMsg) },
+}
+
+// acquireWsProtoMsg 从对象池中取出一个空白的 wsProtoMsg
+func acquireWsProtoMsg() *wsProtoMsg {
+	return wsProtoMsgPool.Get().(*wsProtoMsg)
+}
+
+// releaseWsProtoMsg 归还 wsProtoMsg 以及其持有的读缓冲，调用后不能再访问 p.Body
+func releaseWsProtoMsg(p *wsProtoMsg) {
+	if p.buf != nil {
+		putWsBuf(p.buf)
 	}
-	for _, d := range data {
-		if err := binary.Write(w, binary.BigEndian, d); err != nil {
-			return err
-		}
+	*p = wsProtoMsg{}
+	wsProtoMsgPool.Put(p)
+}
+
+// putWsBuf 归还缓冲，过大的缓冲直接丢弃，避免偶发的大包长期占用内存
+func putWsBuf(buf *bytes.Buffer) {
+	if buf.Cap() > int(wsProtoMaxPackSize)*4 {
+		return
 	}
-	return nil
+	buf.Reset()
+	wsBufPool.Put(buf)
+}
+
+// appendWsProtoMsg 将 wsProtoMsg 序列化后追加到 dst 末尾
+func appendWsProtoMsg(dst []byte, p *wsProtoMsg) []byte {
+	packSize := uint32(wsProtoRawHeaderSize + len(p.Body))
+	dst = binary.BigEndian.AppendUint32(dst, packSize)
+	dst = binary.BigEndian.AppendUint16(dst, uint16(wsProtoRawHeaderSize))
+	dst = binary.BigEndian.AppendUint16(dst, uint16(p.Version))
+	dst = binary.BigEndian.AppendUint32(dst, uint32(p.Operation))
+	dst = binary.BigEndian.AppendUint32(dst, uint32(p.SequenceID))
+	return append(dst, p.Body...)
+}
+
+// writeWsProtoMsg 将 wsProtoMsg 序列化数据写入 io.Writer 中，头部和消息体只调用一次 Write
+func writeWsProtoMsg(w io.Writer, p *wsProtoMsg) error {
+	buf := wsBufPool.Get().(*bytes.Buffer)
+	defer putWsBuf(buf)
+	buf.Grow(wsProtoRawHeaderSize + len(p.Body))
+	_, err := w.Write(appendWsProtoMsg(buf.Bytes(), p))
+	return err
 }
 
 // parseWsProtoMsg 从 []byte 中反序列化 wsProtoMsg
 func parseWsProtoMsg(buf []byte) (p *wsProtoMsg, err error) {
 	p = new(wsProtoMsg)
+	return p, parseWsProtoMsgInto(p, buf)
+}
+
+// parseWsProtoMsgInto 从 []byte 中反序列化到已有的 wsProtoMsg，Body 直接引用 buf 不做拷贝
+func parseWsProtoMsgInto(p *wsProtoMsg, buf []byte) error {
+	if len(buf) < wsProtoRawHeaderSize {
+		return fmt.Errorf("buffer length %d is smaller than header size %d", len(buf), wsProtoRawHeaderSize)
+	}
 	packSize := int32(binary.BigEndian.Uint32(buf[wsProtoPackOffset:wsProtoHeaderOffset]))
 	headerLength := int16(binary.BigEndian.Uint16(buf[wsProtoHeaderOffset:wsProtoVerOffset]))
 	p.Version = int16(binary.BigEndian.Uint16(buf[wsProtoVerOffset:wsProtoOperationOffset]))
 	p.Operation = wsProtoOp(binary.BigEndian.Uint32(buf[wsProtoOperationOffset:wsProtoSeqIdOffset]))
 	p.SequenceID = int32(binary.BigEndian.Uint32(buf[wsProtoSeqIdOffset:]))
 	if packSize < 0 || packSize > wsProtoMaxPackSize {
-		return p, fmt.Errorf("invalid pack size: %d", packSize)
+		return fmt.Errorf("invalid pack size: %d", packSize)
 	}
 	if len(buf) < int(packSize) {
-		return p, fmt.Errorf("buffer length %d is smaller than packet size %d", len(buf), packSize)
+		return fmt.Errorf("buffer length %d is smaller than packet size %d", len(buf), packSize)
 	}
 	if headerLength != wsProtoRawHeaderSize {
-		return p, fmt.Errorf("unsupported header size: %d", headerLength)
+		return fmt.Errorf("unsupported header size: %d", headerLength)
 	}
 	bodySize := int(packSize - int32(headerLength))
 	if bodySize <= 0 {
-		return p, fmt.Errorf("invalid body size: %d", bodySize)
+		return fmt.Errorf("invalid body size: %d", bodySize)
 	}
 	p.Body = buf[headerLength:packSize]
-	return p, nil
+	return nil
 }
 
 // wsAuthResponse WebSocket 协议登录结果
@@ -98,7 +146,189 @@ type wsAuthResponse struct {
 	Code int64 `json:"code"`
 }
 
+// wsCmdEnvelope op 为 wsProtoOpSendMsgReply 的消息外层结构，Data 保留 data 字段的原始 JSON，
+// 确定 cmd 后再反序列化到具体的模型，避免对整个消息体重复解析
+type wsCmdEnvelope struct {
+	Cmd  string
+	Data []byte
+}
+
+// decodeWsCmdEnvelope 单次扫描消息体顶层字段，读出 cmd 并截取 data 的原始 JSON
+//
+// 扫描过程不做内存分配，Data 直接引用 body，仅在 body 有效期内可用
+func decodeWsCmdEnvelope(body []byte) (env wsCmdEnvelope, err error) {
+	err = scanJSONObject(body, func(key, value []byte) error {
+		switch string(key) {
+		case "cmd":
+			if len(value) < 2 || value[0] != '"' {
+				return fmt.Errorf("cmd is not a string")
+			}
+			env.Cmd = internWsCmd(value[1 : len(value)-1])
+		case "data":
+			env.Data = value
+		}
+		return nil
+	})
+	return env, err
+}
+
+// lookupJSONString 在 JSON 对象的顶层字段中查找字符串类型的 key，不存在或者不是字符串时返回 false
+//
+// 返回值引用 body 且不处理转义字符，适用于 msg_id 这类不包含转义的字段
+func lookupJSONString(body []byte, key string) (value []byte, ok bool) {
+	_ = scanJSONObject(body, func(k, v []byte) error {
+		if string(k) == key && len(v) >= 2 && v[0] == '"' {
+			value, ok = v[1:len(v)-1], true
+			return errStopScan
+		}
+		return nil
+	})
+	return value, ok
+}
+
+// errStopScan 在 scanJSONObject 的回调中返回，提前结束扫描
+var errStopScan = errors.New("stop scan")
+
+// scanJSONObject 依次扫描 JSON 对象的顶层字段，key 不包含引号，value 为原始 JSON，两者都直接引用 body
+func scanJSONObject(body []byte, fn func(key, value []byte) error) error {
+	i := skipJSONSpace(body, 0)
+	if i >= len(body) || body[i] != '{' {
+		return fmt.Errorf("not a json object")
+	}
+	i++
+	for {
+		i = skipJSONSpace(body, i)
+		if i >= len(body) {
+			return io.ErrUnexpectedEOF
+		}
+		if body[i] == '}' {
+			return nil
+		}
+		if body[i] != '"' {
+			return fmt.Errorf("unexpected char %q at offset %d", body[i], i)
+		}
+		keyEnd, err := skipJSONValue(body, i)
+		if err != nil {
+			return err
+		}
+		key := body[i+1 : keyEnd-1]
+		i = skipJSONSpace(body, keyEnd)
+		if i >= len(body) || body[i] != ':' {
+			return fmt.Errorf("expect ':' after key %q", key)
+		}
+		i = skipJSONSpace(body, i+1)
+		valueEnd, err := skipJSONValue(body, i)
+		if err != nil {
+			return err
+		}
+		if err = fn(key, body[i:valueEnd]); err != nil {
+			if err == errStopScan {
+				return nil
+			}
+			return err
+		}
+		i = skipJSONSpace(body, valueEnd)
+		if i < len(body) && body[i] == ',' {
+			i++
+		}
+	}
+}
+
+// skipJSONSpace 跳过空白字符，返回下一个有效字符的位置
+func skipJSONSpace(b []byte, i int) int {
+	for i < len(b) {
+		switch b[i] {
+		case ' ', '\t', '\n', '\r':
+			i++
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// skipJSONValue 跳过从 i 开始的一个 JSON 值，返回值结束后的位置
+func skipJSONValue(b []byte, i int) (int, error) {
+	if i >= len(b) {
+		return i, io.ErrUnexpectedEOF
+	}
+	depth := 0
+	for i < len(b) {
+		switch b[i] {
+		case '"':
+			i++
+			for i < len(b) && b[i] != '"' {
+				if b[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			if i >= len(b) {
+				return i, io.ErrUnexpectedEOF
+			}
+			i++
+		case '{', '[':
+			depth++
+			i++
+			continue
+		case '}', ']':
+			if depth == 0 {
+				return i, nil
+			}
+			depth--
+			i++
+		case ',', ' ', '\t', '\n', '\r':
+			if depth == 0 {
+				return i, nil
+			}
+			i++
+			continue
+		default:
+			i++
+			continue
+		}
+		if depth == 0 {
+			return i, nil
+		}
+	}
+	if depth != 0 {
+		return i, io.ErrUnexpectedEOF
+	}
+	return i, nil
+}
+
+// internWsCmd 将已知的 cmd 转换为常量字符串，避免每条消息都分配一次内存
+func internWsCmd(b []byte) string {
+	switch string(b) {
+	case CmdLiveOpenPlatformDm:
+		return CmdLiveOpenPlatformDm
+	case CmdLiveOpenPlatformSendGift:
+		return CmdLiveOpenPlatformSendGift
+	case CmdLiveOpenPlatformSuperChat:
+		return CmdLiveOpenPlatformSuperChat
+	case CmdLiveOpenPlatformSuperChatDel:
+		return CmdLiveOpenPlatformSuperChatDel
+	case CmdLiveOpenPlatformGuard:
+		return CmdLiveOpenPlatformGuard
+	case CmdLiveOpenPlatformLike:
+		return CmdLiveOpenPlatformLike
+	default:
+		return string(b)
+	}
+}
+
+// 在 Websocket 协议中接收到的消息类型
 const (
-	// CmdLiveOpenPlatformDm 在 Websocket 协议中接收到的消息类型：开放平台弹幕，目前只实现了这个类型
+	// CmdLiveOpenPlatformDm 弹幕，对应 Danmaku
 	CmdLiveOpenPlatformDm = "LIVE_OPEN_PLATFORM_DM"
+	// CmdLiveOpenPlatformSendGift 礼物，对应 Gift
+	CmdLiveOpenPlatformSendGift = "LIVE_OPEN_PLATFORM_SEND_GIFT"
+	// CmdLiveOpenPlatformSuperChat 醒目留言，对应 SuperChat
+	CmdLiveOpenPlatformSuperChat = "LIVE_OPEN_PLATFORM_SUPER_CHAT"
+	// CmdLiveOpenPlatformSuperChatDel 醒目留言下线，对应 SuperChatDel
+	CmdLiveOpenPlatformSuperChatDel = "LIVE_OPEN_PLATFORM_SUPER_CHAT_DEL"
+	// CmdLiveOpenPlatformGuard 大航海，对应 Guard
+	CmdLiveOpenPlatformGuard = "LIVE_OPEN_PLATFORM_GUARD"
+	// CmdLiveOpenPlatformLike 点赞，对应 Like
+	CmdLiveOpenPlatformLike = "LIVE_OPEN_PLATFORM_LIKE"
 )
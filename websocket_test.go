@@ -0,0 +1,135 @@
+package biliopen
+
+import (
+	"bytes"
+	"testing"
+)
+
+var testDanmakuBody = []byte(`{"cmd":"LIVE_OPEN_PLATFORM_DM","data":{"room_id":1,"uid":2,"uname":"user","msg":"hello","msg_id":"abc","fans_medal_level":12,"fans_medal_name":"medal","fans_medal_wearing_status":true,"timestamp":1680000000,"uface":"http://i0.hdslb.com/face.jpg","emoji_img_url":"","dm_type":0}}`)
+
+func testWsFrame(op wsProtoOp, body []byte) []byte {
+	return appendWsProtoMsg(nil, &wsProtoMsg{Operation: op, SequenceID: 1, Body: body})
+}
+
+func TestWsProtoMsgRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	in := &wsProtoMsg{Version: 1, Operation: wsProtoOpAuth, SequenceID: 42, Body: []byte(`{"key":"value"}`)}
+	if err := writeWsProtoMsg(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	out, err := parseWsProtoMsg(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Version != in.Version || out.Operation != in.Operation || out.SequenceID != in.SequenceID {
+		t.Fatalf("header mismatch: got %+v, want %+v", out, in)
+	}
+	if !bytes.Equal(out.Body, in.Body) {
+		t.Fatalf("body mismatch: got %q, want %q", out.Body, in.Body)
+	}
+}
+
+func TestParseWsProtoMsgShortBuffer(t *testing.T) {
+	frame := testWsFrame(wsProtoOpSendMsgReply, testDanmakuBody)
+	for _, n := range []int{0, 4, wsProtoRawHeaderSize - 1, len(frame) - 1} {
+		if _, err := parseWsProtoMsg(frame[:n]); err == nil {
+			t.Errorf("expect error for buffer length %d", n)
+		}
+	}
+}
+
+func TestDecodeWsCmdEnvelope(t *testing.T) {
+	env, err := decodeWsCmdEnvelope(testDanmakuBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.Cmd != CmdLiveOpenPlatformDm {
+		t.Fatalf("unexpected cmd %q", env.Cmd)
+	}
+	if !bytes.HasPrefix(env.Data, []byte(`{"room_id":1`)) || !bytes.HasSuffix(env.Data, []byte(`"dm_type":0}`)) {
+		t.Fatalf("unexpected data %s", env.Data)
+	}
+
+	env, err = decodeWsCmdEnvelope([]byte(` { "data" : [1, {"a":"}\""}] , "extra": null, "cmd" : "X" } `))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.Cmd != "X" || string(env.Data) != `[1, {"a":"}\""}]` {
+		t.Fatalf("unexpected envelope %q %s", env.Cmd, env.Data)
+	}
+
+	for _, body := range []string{``, `[]`, `{"cmd":"X"`, `{"cmd":1}`, `{"data":{"a":1}`} {
+		if _, err = decodeWsCmdEnvelope([]byte(body)); err == nil {
+			t.Errorf("expect error for %q", body)
+		}
+	}
+}
+
+func TestHandleOpMsgDanmaku(t *testing.T) {
+	var got []Danmaku
+	lc := &LiveClient{OnDanmaku: func(dm Danmaku) { got = append(got, dm) }}
+	c := &liveWebsocketClient{codec: StdCodec{}, onCmd: lc.handleCmd}
+	msg, err := parseWsProtoMsg(testWsFrame(wsProtoOpSendMsgReply, testDanmakuBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.handleOpMsg(msg); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("expect 1 danmaku, got %d", len(got))
+	}
+	if dm := got[0]; dm.Message != "hello" || dm.MessageID != "abc" || dm.FansMedalLevel != 12 || !dm.FansMedalWearingStatus {
+		t.Fatalf("unexpected danmaku %+v", dm)
+	}
+}
+
+func BenchmarkAppendWsProtoMsg(b *testing.B) {
+	msg := &wsProtoMsg{Operation: wsProtoOpHeartbeat, Body: []byte(`{"code":0}`)}
+	buf := make([]byte, 0, 64)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf = appendWsProtoMsg(buf[:0], msg)
+	}
+}
+
+func BenchmarkParseWsProtoMsg(b *testing.B) {
+	frame := testWsFrame(wsProtoOpSendMsgReply, testDanmakuBody)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(frame)))
+	for i := 0; i < b.N; i++ {
+		msg := acquireWsProtoMsg()
+		if err := parseWsProtoMsgInto(msg, frame); err != nil {
+			b.Fatal(err)
+		}
+		releaseWsProtoMsg(msg)
+	}
+}
+
+// BenchmarkHandleOpMsg 覆盖从原始帧到弹幕回调的完整解码路径
+func BenchmarkHandleOpMsg(b *testing.B) {
+	frame := testWsFrame(wsProtoOpSendMsgReply, testDanmakuBody)
+	for _, tc := range []struct {
+		name  string
+		codec Codec
+	}{
+		{"std", StdCodec{}},
+		{"jsoniter", JsoniterCodec{}},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			lc := &LiveClient{Codec: tc.codec, OnDanmaku: func(Danmaku) {}}
+			c := &liveWebsocketClient{codec: tc.codec, onCmd: lc.handleCmd}
+			c.eventHandler = map[wsProtoOp]func(*wsProtoMsg) error{wsProtoOpSendMsgReply: c.handleOpMsg}
+			b.ReportAllocs()
+			b.SetBytes(int64(len(frame)))
+			for i := 0; i < b.N; i++ {
+				msg := acquireWsProtoMsg()
+				if err := parseWsProtoMsgInto(msg, frame); err != nil {
+					b.Fatal(err)
+				}
+				c.dispatchMsg(msg)
+				releaseWsProtoMsg(msg)
+			}
+		})
+	}
+}